@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	ossignal "os/signal"
+	"strings"
+	"syscall"
+
+	"minidocker/internal/pty"
+	"minidocker/pb"
+)
+
+// attach connects the local terminal to the terminal of job p until the job terminates
+// or the detach key sequence is typed. If replay is true the output produced before attaching is printed.
+func attach(ctx context.Context, c pb.SchedulerClient, p uint64, replay bool) error {
+	keys, err := parseDetachKeys(*detachKeys)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Attach(ctx)
+	if err != nil {
+		return err
+	}
+
+	first := &pb.AttachRequest{Pid: p, Replay: replay}
+	if rows, cols, err := pty.GetSize(os.Stdin); err == nil {
+		first.Resize = &pb.WindowSize{Rows: uint32(rows), Cols: uint32(cols)}
+	}
+	if err := stream.Send(first); err != nil {
+		return err
+	}
+
+	restore, err := pty.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("error setting terminal in raw mode: %w", err)
+	}
+	defer restore()
+
+	// Forward window size changes
+	winch := make(chan os.Signal, 1)
+	ossignal.Notify(winch, syscall.SIGWINCH)
+	defer ossignal.Stop(winch)
+	go func() {
+		for range winch {
+			if rows, cols, err := pty.GetSize(os.Stdin); err == nil {
+				stream.Send(&pb.AttachRequest{Pid: p, Resize: &pb.WindowSize{Rows: uint32(rows), Cols: uint32(cols)}})
+			}
+		}
+	}()
+
+	// Forward stdin until the detach sequence is found
+	detached := make(chan struct{})
+	go func() {
+		detector := &detachDetector{keys: keys}
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				input, detach := detector.scan(buf[:n])
+				if len(input) > 0 {
+					if sendErr := stream.Send(&pb.AttachRequest{Pid: p, Input: input}); sendErr != nil {
+						return
+					}
+				}
+				if detach {
+					close(detached)
+					cancel()
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		response, err := stream.Recv()
+		select {
+		case <-detached:
+			restore()
+			fmt.Printf("\ndetached from process %d\n", p)
+			return nil
+		default:
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		os.Stdout.Write(response.Output)
+	}
+}
+
+// detachDetector finds the detach key sequence in the input stream, bytes matching
+// the beginning of the sequence are held back until the sequence is complete or broken.
+type detachDetector struct {
+	keys    []byte
+	matched int
+}
+
+// scan returns the bytes to forward to the job and true if the detach sequence was typed
+func (d *detachDetector) scan(in []byte) ([]byte, bool) {
+	var out []byte
+	for _, b := range in {
+		if b == d.keys[d.matched] {
+			d.matched++
+			if d.matched == len(d.keys) {
+				return out, true
+			}
+			continue
+		}
+		out = append(out, d.keys[:d.matched]...)
+		d.matched = 0
+		if b == d.keys[0] {
+			d.matched = 1
+			continue
+		}
+		out = append(out, b)
+	}
+	return out, false
+}
+
+// parseDetachKeys parses a comma separated sequence of keys in the docker format,
+// like "ctrl-p,ctrl-q", single characters are taken literally.
+func parseDetachKeys(s string) ([]byte, error) {
+	var keys []byte
+	for _, k := range strings.Split(s, ",") {
+		switch {
+		case len(k) == 1:
+			keys = append(keys, k[0])
+		case strings.HasPrefix(k, "ctrl-") && len(k) == 6:
+			c := k[5]
+			switch {
+			case c >= 'a' && c <= 'z':
+				keys = append(keys, c-'a'+1)
+			case c >= '@' && c <= '_':
+				keys = append(keys, c-'@')
+			default:
+				return nil, fmt.Errorf("invalid detach key %q", k)
+			}
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", k)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"minidocker/internal/archive"
+	"minidocker/pb"
+)
+
+// copyChunkSize is the size of the messages uploading archives
+const copyChunkSize = 32 * 1024
+
+// copyFiles implements "cp": one of src and dest must be in the pid:path format
+// and refer to the job sandbox, the other one is a local path.
+func copyFiles(ctx context.Context, c pb.SchedulerClient, src, dest string) error {
+	if pid, path, ok := parseJobPath(src); ok {
+		stream, err := c.CopyOut(ctx, &pb.CopyOutRequest{Pid: pid, Path: path})
+		if err != nil {
+			return err
+		}
+		return extractStream(func() ([]byte, error) {
+			chunk, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return chunk.Data, nil
+		}, dest)
+	}
+	if pid, path, ok := parseJobPath(dest); ok {
+		return copyIn(ctx, c, src, pid, path)
+	}
+	return fmt.Errorf("either source or destination must be in the pid:path format")
+}
+
+// copyArtifacts extracts the artifacts of job pid into the local directory dest
+func copyArtifacts(ctx context.Context, c pb.SchedulerClient, pid uint64, dest string) error {
+	stream, err := c.Artifacts(ctx, &pb.ArtifactsRequest{Pid: pid})
+	if err != nil {
+		return err
+	}
+	return extractStream(func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.Data, nil
+	}, dest)
+}
+
+// copyIn uploads the local path src into the directory path of the sandbox of job pid
+func copyIn(ctx context.Context, c pb.SchedulerClient, src string, pid uint64, path string) error {
+	stream, err := c.CopyIn(ctx)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(writer)
+		err := archive.Write(tw, src)
+		if err == nil {
+			err = tw.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	buf := make([]byte, copyChunkSize)
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			// io.EOF from Send means the server closed the stream, the error is returned by CloseAndRecv
+			if err := stream.Send(&pb.CopyInRequest{Pid: pid, Path: path, Data: buf[:n]}); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// extractStream extracts into dest the tar archive received by recv
+func extractStream(recv func() ([]byte, error), dest string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		for {
+			data, err := recv()
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				writer.CloseWithError(err)
+				return
+			}
+			if _, err := writer.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+	err := archive.Extract(reader, dest)
+	reader.Close()
+	return err
+}
+
+// parseJobPath parses the pid:path format
+func parseJobPath(s string) (uint64, string, bool) {
+	pid, path, found := strings.Cut(s, ":")
+	if !found {
+		return 0, "", false
+	}
+	n, err := strconv.ParseUint(pid, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return n, path, true
+}
+
+// stringList is a flag.Value collecting the values of a repeated flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"minidocker/internal/archive"
+	"minidocker/pb"
+)
+
+// importImage uploads the OCI image layout directory or the docker save archive at path
+func importImage(ctx context.Context, c pb.SchedulerClient, path, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	stream, err := c.ImportImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if info.IsDir() {
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			tw := tar.NewWriter(pipeWriter)
+			err := archive.Write(tw, path)
+			if err == nil {
+				err = tw.Close()
+			}
+			pipeWriter.CloseWithError(err)
+		}()
+		defer pipeReader.Close()
+		reader = pipeReader
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	buf := make([]byte, copyChunkSize)
+	// The name is sent with the first message even if the archive is empty
+	request := &pb.ImportImageRequest{Name: name}
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 || request != nil {
+			if request == nil {
+				request = &pb.ImportImageRequest{}
+			}
+			request.Data = buf[:n]
+			// io.EOF from Send means the server closed the stream, the error is returned by CloseAndRecv
+			if err := stream.Send(request); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			request = nil
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	for _, img := range r.Images {
+		fmt.Printf("Imported %s %s\n", img.Name, shortID(img.Id))
+	}
+	return nil
+}
+
+// images prints the imported images
+func images(ctx context.Context, c pb.SchedulerClient) error {
+	r, err := c.ListImages(ctx, &pb.ListImagesRequest{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-30s %-14s %-26s %-10s %s\n", "NAME", "ID", "IMPORTED", "SIZE", "COMMAND")
+	for _, img := range r.Images {
+		command := strings.Join(append(img.Entrypoint, img.Cmd...), " ")
+		fmt.Printf("%-30s %-14s %-26s %-10s %s\n", img.Name, shortID(img.Id), img.Imported.AsTime().Local().Format(time.RFC3339), formatBytes(img.Size), command)
+	}
+	return nil
+}
+
+// removeImage removes the image named name
+func removeImage(ctx context.Context, c pb.SchedulerClient, name string) error {
+	if _, err := c.RemoveImage(ctx, &pb.RemoveImageRequest{Name: name}); err != nil {
+		return err
+	}
+	fmt.Printf("Image %s removed\n", name)
+	return nil
+}
+
+// diff writes to file the layer archive of the changes job pid made to the root filesystem of its image
+func diff(ctx context.Context, c pb.SchedulerClient, pid uint64, file string) error {
+	stream, err := c.Diff(ctx, &pb.DiffRequest{Pid: pid})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	for err == nil {
+		var chunk *pb.ArchiveChunk
+		if chunk, err = stream.Recv(); err == nil {
+			_, err = f.Write(chunk.Data)
+		}
+	}
+	if err == io.EOF {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		// A partial layer is not kept
+		os.Remove(file)
+	}
+	return err
+}
+
+// commit imports the image of job pid extended by the changes of the job as the image name
+func commit(ctx context.Context, c pb.SchedulerClient, pid uint64, name string) error {
+	r, err := c.Commit(ctx, &pb.CommitRequest{Pid: pid, Name: name})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Committed %s %s\n", r.Image.Name, shortID(r.Image.Id))
+	return nil
+}
+
+// shortID returns the first 12 hexadecimal characters of an image ID
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	return id[:min(12, len(id))]
+}
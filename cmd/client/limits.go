@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"minidocker/pb"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// limitFlags are the resource limit flags shared by the run and update commands
+type limitFlags struct {
+	fs         *flag.FlagSet
+	cpu        *uint
+	cpus       *string
+	cpuPeriod  *uint
+	cpuBurst   *uint
+	cpuWeight  *uint
+	cpusetCpus *string
+	cpusetMems *string
+	mem        *uint
+	memHigh    *uint
+	memLow     *uint
+	memMin     *uint
+	swap       *uint
+	noSwap     *bool
+	ioWeight   *uint
+	rbps       *uint
+	wbps       *uint
+	pids       *uint
+	devices    deviceLimits
+}
+
+// newLimitFlags defines the limit flags in fs, limits not set are left to the defaults of the server policy
+func newLimitFlags(fs *flag.FlagSet) *limitFlags {
+	f := &limitFlags{
+		fs:         fs,
+		cpu:        fs.Uint("cpu", 0, "Set process maximum cpu usage as percentage, 0 means no limit"),
+		mem:        fs.Uint("mem", 0, "Set process maximum memory expressed in MB, 0 means no limit"),
+		rbps:       fs.Uint("rbps", 0, "Set process maximum read speed in bytes/s, 0 means no limit"),
+		wbps:       fs.Uint("wbps", 0, "Set process maximum write speed in bytes/s, 0 means no limit"),
+		cpus:       fs.String("cpus", "", "Set process maximum cpu usage across all cores like 500m or 2.5, overrides -cpu"),
+		cpuPeriod:  fs.Uint("cpu-period", 0, "Set the period in microseconds the cpu limit is enforced over, default 100000"),
+		cpuBurst:   fs.Uint("cpu-burst", 0, "Set the unused cpu quota in microseconds the process can accumulate for later periods"),
+		cpuWeight:  fs.Uint("cpu-weight", 0, "Set process share of CPU time relative to other processes (1-10000)"),
+		cpusetCpus: fs.String("cpuset-cpus", "", "Pin the process to a list of CPUs like 0-2,4"),
+		cpusetMems: fs.String("cpuset-mems", "", "Pin the process to a list of memory nodes like 0"),
+		memHigh:    fs.Uint("mem-high", 0, "Set process memory in MB above which it is throttled, defaults to -mem"),
+		memLow:     fs.Uint("mem-low", 0, "Set process memory in MB protected from reclaim when possible"),
+		memMin:     fs.Uint("mem-min", 0, "Set process memory in MB never reclaimed"),
+		swap:       fs.Uint("swap", 0, "Set process maximum swap expressed in MB, 0 means no limit"),
+		noSwap:     fs.Bool("no-swap", false, "Prevent the process from using swap"),
+		ioWeight:   fs.Uint("io-weight", 0, "Set process share of IO relative to other processes (1-10000)"),
+		pids:       fs.Uint("pids", 0, "Set process maximum number of processes and threads, 0 means no limit"),
+	}
+	fs.Var(deviceFlag{&f.devices, func(d *pb.IODeviceLimit, n uint64) { d.ReadBPS = n }},
+		"device-read-bps", "Limit read bytes/s from a device or the device of a mount point as path:value, can be repeated")
+	fs.Var(deviceFlag{&f.devices, func(d *pb.IODeviceLimit, n uint64) { d.WriteBPS = n }},
+		"device-write-bps", "Limit write bytes/s to a device or the device of a mount point as path:value, can be repeated")
+	fs.Var(deviceFlag{&f.devices, func(d *pb.IODeviceLimit, n uint64) { d.ReadIOPS = n }},
+		"device-read-iops", "Limit read operations/s from a device or the device of a mount point as path:value, can be repeated")
+	fs.Var(deviceFlag{&f.devices, func(d *pb.IODeviceLimit, n uint64) { d.WriteIOPS = n }},
+		"device-write-iops", "Limit write operations/s to a device or the device of a mount point as path:value, can be repeated")
+	return f
+}
+
+// limits returns the limits set by the flags
+func (f *limitFlags) limits() *pb.ResourceLimits {
+	return &pb.ResourceLimits{
+		CpuPercentage: uint32(*f.cpu),
+		MemoryMB:      uint64(*f.mem),
+		ReadBPS:       uint32(*f.rbps),
+		WriteBPS:      uint32(*f.wbps),
+		Cpus:          *f.cpus,
+		CpuPeriodUsec: uint32(*f.cpuPeriod),
+		CpuBurstUsec:  uint32(*f.cpuBurst),
+		CpuWeight:     uint32(*f.cpuWeight),
+		CpusetCpus:    *f.cpusetCpus,
+		CpusetMems:    *f.cpusetMems,
+		MemoryHighMB:  uint64(*f.memHigh),
+		MemoryLowMB:   uint64(*f.memLow),
+		MemoryMinMB:   uint64(*f.memMin),
+		MemorySwapMB:  uint64(*f.swap),
+		NoSwap:        *f.noSwap,
+		IoWeight:      uint32(*f.ioWeight),
+		PidsMax:       uint32(*f.pids),
+		Devices:       f.devices,
+	}
+}
+
+// merge returns current with the limits given on the command line, a device flag replaces
+// every limit of its device. Setting a flag to 0 removes the limit.
+func (f *limitFlags) merge(current *pb.ResourceLimits) *pb.ResourceLimits {
+	if current == nil {
+		current = &pb.ResourceLimits{}
+	}
+	set := f.limits()
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "cpu":
+			current.CpuPercentage = set.CpuPercentage
+		case "mem":
+			current.MemoryMB = set.MemoryMB
+		case "rbps":
+			current.ReadBPS = set.ReadBPS
+		case "wbps":
+			current.WriteBPS = set.WriteBPS
+		case "cpus":
+			current.Cpus = set.Cpus
+		case "cpu-period":
+			current.CpuPeriodUsec = set.CpuPeriodUsec
+		case "cpu-burst":
+			current.CpuBurstUsec = set.CpuBurstUsec
+		case "cpu-weight":
+			current.CpuWeight = set.CpuWeight
+		case "cpuset-cpus":
+			current.CpusetCpus = set.CpusetCpus
+		case "cpuset-mems":
+			current.CpusetMems = set.CpusetMems
+		case "mem-high":
+			current.MemoryHighMB = set.MemoryHighMB
+		case "mem-low":
+			current.MemoryLowMB = set.MemoryLowMB
+		case "mem-min":
+			current.MemoryMinMB = set.MemoryMinMB
+		case "swap":
+			current.MemorySwapMB = set.MemorySwapMB
+		case "no-swap":
+			current.NoSwap = set.NoSwap
+		case "io-weight":
+			current.IoWeight = set.IoWeight
+		case "pids":
+			current.PidsMax = set.PidsMax
+		}
+	})
+	merged := deviceLimits(current.Devices)
+	for _, d := range f.devices {
+		*merged.get(d.Device) = pb.IODeviceLimit{Device: d.Device, ReadBPS: d.ReadBPS, WriteBPS: d.WriteBPS, ReadIOPS: d.ReadIOPS, WriteIOPS: d.WriteIOPS}
+	}
+	current.Devices = merged
+	return current
+}
+
+type deviceLimits []*pb.IODeviceLimit
+
+// get returns the limits of device adding them if missing
+func (l *deviceLimits) get(device string) *pb.IODeviceLimit {
+	for _, d := range *l {
+		if d.Device == device {
+			return d
+		}
+	}
+	d := &pb.IODeviceLimit{Device: device}
+	*l = append(*l, d)
+	return d
+}
+
+// deviceFlag is a flag.Value setting one limit of a device from values formatted as path:value
+type deviceFlag struct {
+	limits *deviceLimits
+	set    func(*pb.IODeviceLimit, uint64)
+}
+
+func (f deviceFlag) String() string {
+	return ""
+}
+
+func (f deviceFlag) Set(v string) error {
+	i := strings.LastIndex(v, ":")
+	if i <= 0 {
+		return fmt.Errorf("invalid device limit %q, expected path:value", v)
+	}
+	n, err := strconv.ParseUint(v[i+1:], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid device limit %q: %w", v, err)
+	}
+	f.set(f.limits.get(v[:i]), n)
+	return nil
+}
+
+// formatLimits lists the limits that are set as name=value pairs, devices are listed by name
+func formatLimits(l *pb.ResourceLimits) string {
+	var fields []string
+	l.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() {
+			var devices []string
+			for _, d := range l.Devices {
+				devices = append(devices, d.Device)
+			}
+			fields = append(fields, fmt.Sprintf("%s=%s", fd.JSONName(), strings.Join(devices, ",")))
+			return true
+		}
+		fields = append(fields, fmt.Sprintf("%s=%v", fd.JSONName(), v))
+		return true
+	})
+	return strings.Join(fields, " ")
+}
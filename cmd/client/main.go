@@ -12,19 +12,61 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"minidocker/pb"
 	"minidocker/signal"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 var runFlags = flag.NewFlagSet("run", flag.ExitOnError)
-var processCPU = runFlags.Uint("cpu", 10, "Set process maximum cpu usage as percentage")
-var processMEM = runFlags.Uint("mem", 1024, "Set process maximum memory expressed in MB")
-var processRBPS = runFlags.Uint("rbps", 10, "Set process maximum read speed in bytes/s")
-var processWBPS = runFlags.Uint("wbps", 10, "Set process maximum write speed in bytes/s")
+var runLimits = newLimitFlags(runFlags)
+var stdinFile = runFlags.String("stdin-file", "", "Upload the file content as process standard input, - reads the local standard input")
+var interactive = runFlags.Bool("it", false, "Allocate a pseudo-terminal and attach the local terminal to the process")
+var runImage = runFlags.String("image", "", "Run the process in an imported image, without executable the image entrypoint and command are run")
+var hardened = runFlags.Bool("hardened", false, "Mount the sandbox read only but the tmpfs and the read-write mounts, which can not hold executables")
+var profile = runFlags.String("profile", "", "Start the process with the limits of a server profile, the limit flags override it")
+
+var artifactPaths stringList
+var runMounts mountList
+var runVolumes volumeList
+var runTmpfs tmpfsList
+
+var cpFlags = flag.NewFlagSet("cp", flag.ExitOnError)
+var cpArtifacts = cpFlags.Bool("artifacts", false, "Copy the artifacts saved when the process terminated: cp -artifacts pid dest")
+
+var statsFlags = flag.NewFlagSet("stats", flag.ExitOnError)
+var statsNoStream = statsFlags.Bool("no-stream", false, "Print the statistics once instead of refreshing them")
+
+var updateFlags = flag.NewFlagSet("update", flag.ExitOnError)
+var updateLimits = newLimitFlags(updateFlags)
+
+var reportFlags = flag.NewFlagSet("report", flag.ExitOnError)
+var reportFrom = reportFlags.String("from", "", "Include the processes terminated from this time, RFC3339 or YYYY-MM-DD")
+var reportTo = reportFlags.String("to", "", "Include the processes terminated before this time, RFC3339 or YYYY-MM-DD")
+var reportFormat = reportFlags.String("format", "csv", "Output format: csv or json")
+
+var importFlags = flag.NewFlagSet("import", flag.ExitOnError)
+var importName = importFlags.String("name", "", "Name of the image, it replaces the name recorded in the archive")
+
+var volumeCreateFlags = flag.NewFlagSet("volume create", flag.ExitOnError)
+var volumeSize = volumeCreateFlags.Uint64("size", 0, "Cap the size of the volume in megabytes, 0 leaves it bounded by the server disk")
+
+var attachFlags = flag.NewFlagSet("attach", flag.ExitOnError)
+var detachKeys = attachFlags.String("detach-keys", "ctrl-p,ctrl-q", "Key sequence to detach from the process terminal")
+
+func init() {
+	runFlags.Var(&artifactPaths, "artifact", "Path inside the sandbox saved when the process terminates, can be repeated")
+	runFlags.Var(&runMounts, "mount", "Bind mount a host path in the sandbox as source:target[:ro,propagation], can be repeated")
+	runFlags.Var(&runVolumes, "volume", "Mount a volume in the sandbox as name:target[:ro], can be repeated")
+	runFlags.Var(&runTmpfs, "tmpfs", "Mount a tmpfs in the sandbox as target[:size=MB,mode=octal,noexec,nosuid], can be repeated")
+	// run -it shares the detach sequence with attach
+	runFlags.StringVar(detachKeys, "detach-keys", *detachKeys, "Key sequence to detach from the process terminal when using -it")
+}
 
 var commonFlags = flag.NewFlagSet("common", flag.ExitOnError)
 var serverAddr = commonFlags.String("addr", "localhost:8080", "Server address in host:port format")
@@ -41,6 +83,22 @@ func main() {
 				"\t%s [flags] command\nCommands:\n"+
 				"\t- run [run flags] executable [args]\n"+
 				"\t- output pid\n"+
+				"\t- attach [attach flags] pid\n"+
+				"\t- cp [cp flags] pid:path dest | src pid:path\n"+
+				"\t- stats [stats flags] pid\n"+
+				"\t- update [update flags] pid\n"+
+				"\t- host\n"+
+				"\t- quota\n"+
+				"\t- profiles\n"+
+				"\t- report [report flags]\n"+
+				"\t- import [import flags] path\n"+
+				"\t- images\n"+
+				"\t- rmi name\n"+
+				"\t- diff pid file\n"+
+				"\t- commit pid name\n"+
+				"\t- volume create [volume create flags] name\n"+
+				"\t- volume ls\n"+
+				"\t- volume rm name\n"+
 				"\t- stop pid\n"+
 				"Flags:\n",
 			filepath.Base(os.Args[0]))
@@ -82,8 +140,8 @@ func main() {
 			os.Exit(1)
 		}
 
-		// No arguments passed to run command so we print error and exit
-		if len(runFlags.Args()) == 0 {
+		// No arguments passed to run command so we print error and exit, images have a default command
+		if len(runFlags.Args()) == 0 && *runImage == "" {
 			fmt.Println("No arguments to command run")
 			runFlags.Usage()
 			os.Exit(1)
@@ -97,6 +155,174 @@ func main() {
 
 		client := buildSchedulerClient()
 		commandError = run(ctx, client, runFlags.Arg(0), args)
+	case "cp":
+		cpFlags.Usage = func() {
+			fmt.Println("cp command flags:")
+			cpFlags.PrintDefaults()
+		}
+		if err := cpFlags.Parse(commonFlags.Args()[1:]); err != nil || cpFlags.NArg() != 2 {
+			cpFlags.Usage()
+			os.Exit(1)
+		}
+		client := buildSchedulerClient()
+		if *cpArtifacts {
+			pid, err := strconv.Atoi(cpFlags.Arg(0))
+			if err != nil {
+				fmt.Printf("could not parse PID \"%s\":%v\n", cpFlags.Arg(0), err)
+				return
+			}
+			commandError = copyArtifacts(ctx, client, uint64(pid), cpFlags.Arg(1))
+		} else {
+			commandError = copyFiles(ctx, client, cpFlags.Arg(0), cpFlags.Arg(1))
+		}
+	case "stats":
+		statsFlags.Usage = func() {
+			fmt.Println("stats command flags:")
+			statsFlags.PrintDefaults()
+		}
+		if err := statsFlags.Parse(commonFlags.Args()[1:]); err != nil {
+			fmt.Println(err)
+			statsFlags.Usage()
+			os.Exit(1)
+		}
+		pid, err := strconv.Atoi(statsFlags.Arg(0))
+		if err != nil {
+			fmt.Printf("could not parse PID \"%s\":%v\n", statsFlags.Arg(0), err)
+			return
+		}
+		client := buildSchedulerClient()
+		commandError = stats(ctx, client, uint64(pid), *statsNoStream)
+		// We want to ignore context cancelled errors as it's expected when using SIGTERM
+		if commandError == context.Canceled {
+			commandError = nil
+		}
+	case "attach":
+		attachFlags.Usage = func() {
+			fmt.Println("attach command flags:")
+			attachFlags.PrintDefaults()
+		}
+		if err := attachFlags.Parse(commonFlags.Args()[1:]); err != nil {
+			fmt.Println(err)
+			attachFlags.Usage()
+			os.Exit(1)
+		}
+		pid, err := strconv.Atoi(attachFlags.Arg(0))
+		if err != nil {
+			fmt.Printf("could not parse PID \"%s\":%v\n", attachFlags.Arg(0), err)
+			return
+		}
+		client := buildSchedulerClient()
+		commandError = attach(ctx, client, uint64(pid), false)
+	case "update":
+		updateFlags.Usage = func() {
+			fmt.Println("update command flags:")
+			updateFlags.PrintDefaults()
+		}
+		if err := updateFlags.Parse(commonFlags.Args()[1:]); err != nil {
+			fmt.Println(err)
+			updateFlags.Usage()
+			os.Exit(1)
+		}
+		pid, err := strconv.Atoi(updateFlags.Arg(0))
+		if err != nil {
+			fmt.Printf("could not parse PID \"%s\":%v\n", updateFlags.Arg(0), err)
+			return
+		}
+		client := buildSchedulerClient()
+		commandError = update(ctx, client, uint64(pid))
+	case "stop":
+		pid, err := strconv.Atoi(commonFlags.Arg(1))
+		if err != nil {
+			fmt.Printf("could not parse PID \"%s\":%v\n", commonFlags.Arg(1), err)
+			return
+		}
+		client := buildSchedulerClient()
+		commandError = stop(ctx, client, uint64(pid))
+	case "report":
+		reportFlags.Usage = func() {
+			fmt.Println("report command flags:")
+			reportFlags.PrintDefaults()
+		}
+		if err := reportFlags.Parse(commonFlags.Args()[1:]); err != nil {
+			fmt.Println(err)
+			reportFlags.Usage()
+			os.Exit(1)
+		}
+		client := buildSchedulerClient()
+		commandError = report(ctx, client, os.Stdout)
+	case "import":
+		importFlags.Usage = func() {
+			fmt.Println("import command flags:")
+			importFlags.PrintDefaults()
+		}
+		if err := importFlags.Parse(commonFlags.Args()[1:]); err != nil || importFlags.NArg() != 1 {
+			importFlags.Usage()
+			os.Exit(1)
+		}
+		client := buildSchedulerClient()
+		commandError = importImage(ctx, client, importFlags.Arg(0), *importName)
+	case "images":
+		client := buildSchedulerClient()
+		commandError = images(ctx, client)
+	case "rmi":
+		if commonFlags.NArg() != 2 {
+			commonFlags.Usage()
+			os.Exit(1)
+		}
+		client := buildSchedulerClient()
+		commandError = removeImage(ctx, client, commonFlags.Arg(1))
+	case "diff", "commit":
+		if commonFlags.NArg() != 3 {
+			commonFlags.Usage()
+			os.Exit(1)
+		}
+		pid, err := strconv.Atoi(commonFlags.Arg(1))
+		if err != nil {
+			fmt.Printf("could not parse PID \"%s\":%v\n", commonFlags.Arg(1), err)
+			return
+		}
+		client := buildSchedulerClient()
+		if commonFlags.Arg(0) == "diff" {
+			commandError = diff(ctx, client, uint64(pid), commonFlags.Arg(2))
+		} else {
+			commandError = commit(ctx, client, uint64(pid), commonFlags.Arg(2))
+		}
+	case "volume":
+		switch commonFlags.Arg(1) {
+		case "create":
+			volumeCreateFlags.Usage = func() {
+				fmt.Println("volume create command flags:")
+				volumeCreateFlags.PrintDefaults()
+			}
+			if err := volumeCreateFlags.Parse(commonFlags.Args()[2:]); err != nil || volumeCreateFlags.NArg() != 1 {
+				volumeCreateFlags.Usage()
+				os.Exit(1)
+			}
+			client := buildSchedulerClient()
+			commandError = createVolume(ctx, client, volumeCreateFlags.Arg(0), *volumeSize)
+		case "ls":
+			client := buildSchedulerClient()
+			commandError = volumes(ctx, client)
+		case "rm":
+			if commonFlags.NArg() != 3 {
+				commonFlags.Usage()
+				os.Exit(1)
+			}
+			client := buildSchedulerClient()
+			commandError = removeVolume(ctx, client, commonFlags.Arg(2))
+		default:
+			commonFlags.Usage()
+			os.Exit(1)
+		}
+	case "profiles":
+		client := buildSchedulerClient()
+		commandError = profiles(ctx, client)
+	case "quota":
+		client := buildSchedulerClient()
+		commandError = quota(ctx, client)
+	case "host":
+		client := buildSchedulerClient()
+		commandError = hostStats(ctx, client)
 	case "output":
 		pid, err := strconv.Atoi(commonFlags.Arg(1))
 		if err != nil {
@@ -116,11 +342,23 @@ func main() {
 
 	if commandError != nil {
 		cancelFunc()
-		fmt.Println(commandError)
+		printError(commandError)
 		os.Exit(1)
 	}
 }
 
+// printError prints err followed by the fields rejected by the server, if any
+func printError(err error) {
+	fmt.Println(err)
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.FieldViolations {
+				fmt.Printf("  %s: %s\n", v.Field, v.Description)
+			}
+		}
+	}
+}
+
 func get(ctx context.Context, c pb.SchedulerClient, p uint64) error {
 	r, err := c.Get(ctx, &pb.GetRequest{Pid: p})
 	if err != nil {
@@ -130,6 +368,101 @@ func get(ctx context.Context, c pb.SchedulerClient, p uint64) error {
 		return fmt.Errorf("pid %d does not exists", p)
 	}
 	fmt.Printf("PID: %d, Status: %s\n", r.Pid, r.Status)
+	switch r.Cause {
+	case "Exited":
+		fmt.Printf("Exited with code %d\n", r.ExitCode)
+	case "Signaled":
+		fmt.Println("Terminated by a signal")
+	case "OOMKilled":
+		limit := "no limit"
+		if r.MemoryMax > 0 {
+			limit = "a limit of " + formatBytes(r.MemoryMax)
+		}
+		fmt.Printf("Killed by the OOM killer: memory usage peaked at %s with %s, consider raising -mem\n", formatBytes(r.PeakMemory), limit)
+	}
+	if a := r.Accounting; a != nil {
+		var read, write uint64
+		for _, io := range a.Io {
+			read += io.ReadBytes
+			write += io.WriteBytes
+		}
+		fmt.Printf("Used %.2fs user and %.2fs system CPU, %s peak memory, %s / %s block IO, %d peak pids\n",
+			float64(a.CpuUserUsec)/1e6, float64(a.CpuSystemUsec)/1e6, formatBytes(a.MemoryPeak),
+			formatBytes(read), formatBytes(write), a.PidsPeak)
+	}
+	for _, e := range r.History {
+		fmt.Printf("%s %s %s\n", e.Time.AsTime().Local().Format(time.RFC3339), e.Type, e.Message)
+	}
+	return nil
+}
+
+// stop terminates job p, a job held by the admission control is never started
+func stop(ctx context.Context, c pb.SchedulerClient, p uint64) error {
+	if _, err := c.Stop(ctx, &pb.StopRequest{Pid: p}); err != nil {
+		return err
+	}
+	fmt.Printf("Process %d stopped\n", p)
+	return nil
+}
+
+// profiles prints the server profiles the user may start processes with
+func profiles(ctx context.Context, c pb.SchedulerClient) error {
+	r, err := c.ListProfiles(ctx, &pb.ListProfilesRequest{})
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Profiles {
+		limits := formatLimits(p.Limits)
+		if limits == "" {
+			limits = "no limits"
+		}
+		fmt.Printf("%s: %s\n  %s\n", p.Name, p.Description, limits)
+	}
+	return nil
+}
+
+// quota prints the quota of the user and the resources reserved by its jobs
+func quota(ctx context.Context, c pb.SchedulerClient) error {
+	r, err := c.Quota(ctx, &pb.QuotaRequest{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User: %s, Role: %s\n", r.User, r.Role)
+	if r.Limits == nil {
+		fmt.Printf("No quota, %d active jobs\n", r.Jobs)
+		return nil
+	}
+	limit := func(v uint64, unit string) string {
+		if v == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d%s", v, unit)
+	}
+	maxCpus := r.Limits.MaxCpus
+	if maxCpus == "" {
+		maxCpus = "unlimited"
+	}
+	fmt.Printf("%-14s %-10s %s\n", "RESOURCE", "USED", "LIMIT")
+	fmt.Printf("%-14s %-10d %s\n", "jobs", r.Jobs, limit(uint64(r.Limits.MaxJobs), ""))
+	fmt.Printf("%-14s %-10s %s\n", "cpus", r.Cpus, maxCpus)
+	fmt.Printf("%-14s %-10s %s\n", "memory", fmt.Sprintf("%dMB", r.MemoryMB), limit(r.Limits.MaxMemoryMB, "MB"))
+	fmt.Printf("%-14s %-10d %s\n", "jobs per hour", r.JobsLastHour, limit(uint64(r.Limits.MaxJobsPerHour), ""))
+	return nil
+}
+
+// update changes the limits given on the command line of a running job keeping the others
+func update(ctx context.Context, c pb.SchedulerClient, p uint64) error {
+	r, err := c.Get(ctx, &pb.GetRequest{Pid: p})
+	if err != nil {
+		return err
+	}
+	if !r.Found {
+		return fmt.Errorf("pid %d does not exists", p)
+	}
+	if _, err := c.Update(ctx, &pb.UpdateRequest{Pid: p, Limits: updateLimits.merge(r.Limits)}); err != nil {
+		return err
+	}
+	fmt.Printf("Process %d updated\n", p)
 	return nil
 }
 
@@ -151,14 +484,19 @@ func output(ctx context.Context, c pb.SchedulerClient, p uint64) error {
 
 // run executes the Executer Start command
 func run(ctx context.Context, c pb.SchedulerClient, cmd string, args []string) error {
-	limits := &pb.ResourceLimits{
-		CpuPercentage: uint32(*processCPU),
-		MemoryMB:      uint64(*processMEM),
-		ReadBPS:       uint32(*processRBPS),
-		WriteBPS:      uint32(*processWBPS),
-	}
+	limits := runLimits.limits()
 
-	r, err := c.Start(ctx, &pb.CreateRequest{Cmd: cmd, Args: args, Limits: limits})
+	request := &pb.CreateRequest{Cmd: cmd, Args: args, Limits: limits, Tty: *interactive, Artifacts: artifactPaths, Profile: *profile, Image: *runImage, Mounts: runMounts, Volumes: runVolumes, Tmpfs: runTmpfs, Hardened: *hardened}
+	var r *pb.CreateResponse
+	var err error
+	if *stdinFile != "" {
+		if *interactive {
+			return fmt.Errorf("-stdin-file can not be used together with -it")
+		}
+		r, err = startWithInput(ctx, c, request, *stdinFile)
+	} else {
+		r, err = c.Start(ctx, request)
+	}
 	if err != nil {
 		return err
 	}
@@ -167,10 +505,53 @@ func run(ctx context.Context, c pb.SchedulerClient, cmd string, args []string) e
 		return errors.New(*r.Error)
 	}
 
+	if *interactive {
+		return attach(ctx, c, r.Pid, true)
+	}
 	fmt.Printf("Process ID: %d\n", r.Pid)
 	return nil
 }
 
+// startWithInput starts the process uploading the content of path as its standard input
+func startWithInput(ctx context.Context, c pb.SchedulerClient, request *pb.CreateRequest, path string) (*pb.CreateResponse, error) {
+	input := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	stream, err := c.StartWithInput(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&pb.StartInputRequest{Request: request}); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := input.Read(buf)
+		if n > 0 {
+			// io.EOF from Send means the server closed the stream: the process stopped reading
+			if err := stream.Send(&pb.StartInputRequest{Data: buf[:n]}); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return nil, readErr
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
 func buildSchedulerClient() pb.SchedulerClient {
 	conn, err := buildGRPCClient()
 	if err != nil {
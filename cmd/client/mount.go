@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"minidocker/pb"
+)
+
+// mountList is a flag.Value collecting the bind mounts of run, each one is written
+// source:target[:options] where options is a comma separated list of ro, rw and a propagation type
+type mountList []*pb.Mount
+
+func (l *mountList) String() string {
+	mounts := make([]string, 0, len(*l))
+	for _, m := range *l {
+		mounts = append(mounts, m.Source+":"+m.Target)
+	}
+	return strings.Join(mounts, ",")
+}
+
+func (l *mountList) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid mount %s, the format is source:target[:options]", value)
+	}
+	m := &pb.Mount{Source: parts[0], Target: parts[1]}
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			switch option {
+			case "ro":
+				m.ReadOnly = true
+			case "rw":
+				m.ReadOnly = false
+			default:
+				// The propagation type is validated by the server
+				m.Propagation = option
+			}
+		}
+	}
+	*l = append(*l, m)
+	return nil
+}
+
+// tmpfsList is a flag.Value collecting the tmpfs of run, each one is written target[:options] where options
+// is a comma separated list of size=MB, mode=octal permissions, noexec and nosuid
+type tmpfsList []*pb.Tmpfs
+
+func (l *tmpfsList) String() string {
+	targets := make([]string, 0, len(*l))
+	for _, t := range *l {
+		targets = append(targets, t.Target)
+	}
+	return strings.Join(targets, ",")
+}
+
+func (l *tmpfsList) Set(value string) error {
+	target, options, _ := strings.Cut(value, ":")
+	if target == "" {
+		return fmt.Errorf("invalid tmpfs %s, the format is target[:options]", value)
+	}
+	t := &pb.Tmpfs{Target: target}
+	if options != "" {
+		for _, option := range strings.Split(options, ",") {
+			name, arg, _ := strings.Cut(option, "=")
+			var err error
+			switch name {
+			case "size":
+				t.SizeMB, err = strconv.ParseUint(arg, 10, 64)
+			case "mode":
+				var mode uint64
+				mode, err = strconv.ParseUint(arg, 8, 32)
+				t.Mode = uint32(mode)
+			case "noexec":
+				t.NoExec = true
+			case "nosuid":
+				t.NoSuid = true
+			default:
+				return fmt.Errorf("invalid tmpfs option %s", option)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid tmpfs option %s: %w", option, err)
+			}
+		}
+	}
+	*l = append(*l, t)
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"minidocker/pb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// reportJob is the accounting record of a job exported by report
+type reportJob struct {
+	Pid              uint64         `json:"pid"`
+	User             string         `json:"user"`
+	Command          string         `json:"command"`
+	Status           string         `json:"status"`
+	Cause            string         `json:"cause"`
+	ExitCode         int32          `json:"exit_code"`
+	StartedAt        time.Time      `json:"started_at"`
+	TerminatedAt     time.Time      `json:"terminated_at"`
+	CPUUserSeconds   float64        `json:"cpu_user_seconds"`
+	CPUSystemSeconds float64        `json:"cpu_system_seconds"`
+	MemoryPeakBytes  uint64         `json:"memory_peak_bytes"`
+	PidsPeak         uint64         `json:"pids_peak"`
+	Devices          []reportDevice `json:"devices"`
+}
+
+// reportDevice is the IO of a job on a block device
+type reportDevice struct {
+	Device     string `json:"device"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
+}
+
+// report writes to w the accounting of the jobs terminated between -from and -to in the -format format
+func report(ctx context.Context, c pb.SchedulerClient, w io.Writer) error {
+	request := &pb.ReportRequest{}
+	var err error
+	if request.From, err = parseReportTime(*reportFrom); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if request.To, err = parseReportTime(*reportTo); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+	if *reportFormat != "csv" && *reportFormat != "json" {
+		return fmt.Errorf("unknown format %s, csv or json are supported", *reportFormat)
+	}
+
+	r, err := c.Report(ctx, request)
+	if err != nil {
+		return err
+	}
+	jobs := make([]reportJob, 0, len(r.Jobs))
+	for _, j := range r.Jobs {
+		jobs = append(jobs, newReportJob(j))
+	}
+	if *reportFormat == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jobs)
+	}
+	return writeReportCSV(w, jobs)
+}
+
+// parseReportTime parses a RFC3339 time or a date in the local time zone, empty is no bound
+func parseReportTime(s string) (*timestamppb.Timestamp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.ParseInLocation(time.DateOnly, s, time.Local); err != nil {
+			return nil, fmt.Errorf("%s is neither a RFC3339 time nor a YYYY-MM-DD date", s)
+		}
+	}
+	return timestamppb.New(t), nil
+}
+
+func newReportJob(j *pb.JobReport) reportJob {
+	job := reportJob{
+		Pid:              j.Pid,
+		User:             j.User,
+		Command:          strings.Join(append([]string{j.Cmd}, j.Args...), " "),
+		Status:           j.Status,
+		Cause:            j.Cause,
+		ExitCode:         j.ExitCode,
+		StartedAt:        j.StartedAt.AsTime(),
+		TerminatedAt:     j.TerminatedAt.AsTime(),
+		CPUUserSeconds:   float64(j.Accounting.GetCpuUserUsec()) / 1e6,
+		CPUSystemSeconds: float64(j.Accounting.GetCpuSystemUsec()) / 1e6,
+		MemoryPeakBytes:  j.Accounting.GetMemoryPeak(),
+		PidsPeak:         j.Accounting.GetPidsPeak(),
+		Devices:          []reportDevice{},
+	}
+	for _, io := range j.Accounting.GetIo() {
+		job.Devices = append(job.Devices, reportDevice{
+			Device:     fmt.Sprintf("%d:%d", io.Major, io.Minor),
+			ReadBytes:  io.ReadBytes,
+			WriteBytes: io.WriteBytes,
+			ReadOps:    io.ReadOps,
+			WriteOps:   io.WriteOps,
+		})
+	}
+	return job
+}
+
+// writeReportCSV writes a row per job with the IO summed over the devices,
+// the devices column details the IO per device as "maj:min rbytes wbytes rios wios" separated by ";"
+func writeReportCSV(w io.Writer, jobs []reportJob) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"pid", "user", "command", "status", "cause", "exit_code", "started_at", "terminated_at",
+		"cpu_user_seconds", "cpu_system_seconds", "memory_peak_bytes", "pids_peak",
+		"read_bytes", "write_bytes", "read_ops", "write_ops", "devices"})
+	for _, j := range jobs {
+		var total reportDevice
+		var devices []string
+		for _, d := range j.Devices {
+			total.ReadBytes += d.ReadBytes
+			total.WriteBytes += d.WriteBytes
+			total.ReadOps += d.ReadOps
+			total.WriteOps += d.WriteOps
+			devices = append(devices, fmt.Sprintf("%s %d %d %d %d", d.Device, d.ReadBytes, d.WriteBytes, d.ReadOps, d.WriteOps))
+		}
+		writer.Write([]string{
+			strconv.FormatUint(j.Pid, 10),
+			j.User,
+			j.Command,
+			j.Status,
+			j.Cause,
+			strconv.Itoa(int(j.ExitCode)),
+			j.StartedAt.Format(time.RFC3339),
+			j.TerminatedAt.Format(time.RFC3339),
+			strconv.FormatFloat(j.CPUUserSeconds, 'f', 6, 64),
+			strconv.FormatFloat(j.CPUSystemSeconds, 'f', 6, 64),
+			strconv.FormatUint(j.MemoryPeakBytes, 10),
+			strconv.FormatUint(j.PidsPeak, 10),
+			strconv.FormatUint(total.ReadBytes, 10),
+			strconv.FormatUint(total.WriteBytes, 10),
+			strconv.FormatUint(total.ReadOps, 10),
+			strconv.FormatUint(total.WriteOps, 10),
+			strings.Join(devices, ";"),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"minidocker/pb"
+)
+
+// stats prints the resource usage of job p, refreshing it until the job terminates
+// unless noStream is set, like "docker stats"
+func stats(ctx context.Context, c pb.SchedulerClient, p uint64, noStream bool) error {
+	if noStream {
+		r, err := c.Stats(ctx, &pb.StatsRequest{Pid: p})
+		if err != nil {
+			return err
+		}
+		printStats(r, nil)
+		return nil
+	}
+
+	stream, err := c.WatchStats(ctx, &pb.WatchStatsRequest{Pid: p})
+	if err != nil {
+		return err
+	}
+	var previous *pb.StatsResponse
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// Clear the screen and move the cursor home
+		fmt.Print("\033[H\033[2J")
+		printStats(r, previous)
+		previous = r
+	}
+}
+
+// printStats prints a statistics sample, CPU % is computed against the previous sample if available
+func printStats(r, previous *pb.StatsResponse) {
+	cpu := "--"
+	if previous != nil {
+		elapsed := r.Time.AsTime().Sub(previous.Time.AsTime()).Microseconds()
+		if elapsed > 0 {
+			// As docker, 100% is a full core
+			cpu = fmt.Sprintf("%.2f%%", float64(r.CpuUsageUsec-previous.CpuUsageUsec)/float64(elapsed)*100)
+		}
+	}
+	limit := "unlimited"
+	if r.MemoryMax > 0 {
+		limit = formatBytes(r.MemoryMax)
+	}
+	var read, write uint64
+	for _, io := range r.Io {
+		read += io.ReadBytes
+		write += io.WriteBytes
+	}
+
+	fmt.Printf("%-8s %-10s %-24s %-10s %-20s %-10s %s\n", "PID", "CPU %", "MEM USAGE / LIMIT", "MEM PEAK", "BLOCK I/O", "PIDS", "OOM KILLS")
+	fmt.Printf("%-8d %-10s %-24s %-10s %-20s %-10d %d\n",
+		r.Pid,
+		cpu,
+		formatBytes(r.MemoryCurrent)+" / "+limit,
+		formatBytes(r.MemoryPeak),
+		formatBytes(read)+" / "+formatBytes(write),
+		r.PidsCurrent,
+		r.MemoryEvents.GetOomKill())
+	if r.NrThrottled > 0 {
+		fmt.Printf("\nthrottled %d of %d periods for %.2fs\n", r.NrThrottled, r.NrPeriods, float64(r.ThrottledUsec)/1e6)
+	}
+	if r.Pressure != nil {
+		fmt.Println()
+		printPressure(r.Pressure)
+	}
+}
+
+// hostStats prints the pressure of the host and the jobs held by the admission control
+func hostStats(ctx context.Context, c pb.SchedulerClient) error {
+	r, err := c.HostStats(ctx, &pb.HostStatsRequest{})
+	if err != nil {
+		return err
+	}
+	printPressure(r.Pressure)
+	fmt.Printf("\nqueued jobs: %d\n", r.Queued)
+	return nil
+}
+
+// printPressure prints the share of time tasks stalled on each resource, like /proc/pressure
+func printPressure(p *pb.ResourcePressure) {
+	fmt.Printf("%-10s %-8s %-8s %-8s %-8s %-8s %s\n", "PRESSURE", "SOME 10s", "60s", "300s", "FULL 10s", "60s", "300s")
+	for _, r := range []struct {
+		name     string
+		pressure *pb.Pressure
+	}{{"cpu", p.Cpu}, {"memory", p.Memory}, {"io", p.Io}} {
+		some, full := r.pressure.GetSome(), r.pressure.GetFull()
+		fmt.Printf("%-10s %-8.2f %-8.2f %-8.2f %-8.2f %-8.2f %.2f\n", r.name,
+			some.GetAvg10(), some.GetAvg60(), some.GetAvg300(),
+			full.GetAvg10(), full.GetAvg60(), full.GetAvg300())
+	}
+}
+
+// formatBytes formats b with binary units
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), strings.ToUpper("kmgtpe")[exp])
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"minidocker/pb"
+)
+
+// volumeList is a flag.Value collecting the volumes mounted by run, each one is written name:target[:ro]
+type volumeList []*pb.VolumeMount
+
+func (l *volumeList) String() string {
+	volumes := make([]string, 0, len(*l))
+	for _, v := range *l {
+		volumes = append(volumes, v.Name+":"+v.Target)
+	}
+	return strings.Join(volumes, ",")
+}
+
+func (l *volumeList) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid volume %s, the format is name:target[:ro]", value)
+	}
+	v := &pb.VolumeMount{Name: parts[0], Target: parts[1]}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			v.ReadOnly = true
+		case "rw":
+		default:
+			return fmt.Errorf("invalid volume option %s, ro or rw was expected", parts[2])
+		}
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+// createVolume creates the volume named name, a sizeMB other than 0 caps its size
+func createVolume(ctx context.Context, c pb.SchedulerClient, name string, sizeMB uint64) error {
+	r, err := c.CreateVolume(ctx, &pb.CreateVolumeRequest{Name: name, SizeMB: sizeMB})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Volume %s created\n", r.Volume.Name)
+	return nil
+}
+
+// volumes prints the volumes of the user
+func volumes(ctx context.Context, c pb.SchedulerClient) error {
+	r, err := c.ListVolumes(ctx, &pb.ListVolumesRequest{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-30s %-12s %-26s %s\n", "NAME", "OWNER", "CREATED", "SIZE")
+	for _, v := range r.Volumes {
+		size := "-"
+		if v.SizeMB != 0 {
+			size = formatBytes(v.SizeMB << 20)
+		}
+		fmt.Printf("%-30s %-12s %-26s %s\n", v.Name, v.Owner, v.Created.AsTime().Local().Format(time.RFC3339), size)
+	}
+	return nil
+}
+
+// removeVolume removes the volume named name and its data
+func removeVolume(ctx context.Context, c pb.SchedulerClient, name string) error {
+	if _, err := c.RemoveVolume(ctx, &pb.RemoveVolumeRequest{Name: name}); err != nil {
+		return err
+	}
+	fmt.Printf("Volume %s removed\n", name)
+	return nil
+}
@@ -22,6 +22,14 @@ var listenAdd = flag.String("listen", "localhost:8080", "Listen address in host:
 var caChainFile = flag.String("ca", "ca/ca.crt", "CA location")
 var certFile = flag.String("cert", "ca/server.crt", "Client certificate location")
 var privateKeyFile = flag.String("key", "ca/server.key", "Server private key location")
+var configFile = flag.String("config", "", "JSON file with the quotas of users and roles")
+var maxCPUPressure = flag.Float64("max-cpu-pressure", 0, "Hold new jobs while the host CPU pressure (some avg10 %) is above it, 0 disables the check")
+var maxMemoryPressure = flag.Float64("max-memory-pressure", 0, "Hold new jobs while the host memory pressure (some avg10 %) is above it, 0 disables the check")
+var maxIOPressure = flag.Float64("max-io-pressure", 0, "Hold new jobs while the host IO pressure (some avg10 %) is above it, 0 disables the check")
+var dataRoot = flag.String("data-root", "/var/lib/minidocker", "Directory holding the imported images")
+var userns = flag.String("userns", "", "Run the jobs in user namespaces mapping root in the sandbox to the first subordinate id of this user in /etc/subuid and /etc/subgid, a server not started as root always maps its own ids")
+var cgroupRoot = flag.String("cgroup-root", "/sys/fs/cgroup", "Cgroup holding the cgroups of the jobs, a server not started as root needs one delegated to its user")
+var admissionInterval = flag.Duration("admission-interval", time.Second, "Interval between the host pressure checks admitting held jobs")
 
 func main() {
 	flag.Parse()
@@ -50,12 +58,30 @@ func main() {
 		grpc.ConnectionTimeout(5*time.Second),
 	)
 
-	exec, err := executor.New()
+	options := []executor.Option{executor.WithAdmission(executor.AdmissionThresholds{
+		CPU:    *maxCPUPressure,
+		Memory: *maxMemoryPressure,
+		IO:     *maxIOPressure,
+	}, *admissionInterval), executor.WithDataRoot(*dataRoot), executor.WithCgroupRoot(*cgroupRoot)}
+	if *userns != "" {
+		ns, err := executor.SubordinateIDs(*userns)
+		if err != nil {
+			log.Error("failed to read subordinate ids", "user", *userns, "error", err)
+			os.Exit(1)
+		}
+		options = append(options, executor.WithUserNamespace(ns))
+	}
+	exec, err := executor.New(options...)
 	if err != nil {
 		log.Error("failed to start executor", "error", err)
 		os.Exit(1)
 	}
-	server := &server.SchedulerServer{Executor: exec}
+	config, err := server.LoadConfig(*configFile)
+	if err != nil {
+		log.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	server := server.NewSchedulerServer(exec, config)
 	pb.RegisterSchedulerServer(grpcServer, server)
 
 	signal.SetupSignalHandler(func(s os.Signal) {
@@ -14,6 +14,19 @@ var cpuPercent = flag.Uint("cpu", 0, "cpu %, 0 means no limit is applied")
 var memoryMB = flag.Uint("mem", 0, "memory in megabytes, 0 means no limits is applied")
 var rbps = flag.Uint("rbps", 0, "Read bytes/s, no limit is applied if value us not bigger then 1")
 var wbps = flag.Uint("wbps", 0, "Write bytes/s, no limit is applied if value us not bigger then 1")
+var cpus = flag.String("cpus", "", "cpu quantity across all cores like 500m or 2.5, overrides -cpu")
+var cpuPeriod = flag.Uint("cpu-period", 0, "cpu limit period in microseconds, 0 means 100000")
+var cpuBurst = flag.Uint("cpu-burst", 0, "cpu burst in microseconds, 0 means no burst")
+var cpuWeight = flag.Uint("cpu-weight", 0, "cpu weight (1-10000), 0 means the default weight")
+var cpusetCpus = flag.String("cpuset-cpus", "", "list of cpus the process can run on, empty means all")
+var cpusetMems = flag.String("cpuset-mems", "", "list of memory nodes the process can use, empty means all")
+var memoryHighMB = flag.Uint("mem-high", 0, "memory throttling threshold in megabytes, 0 means same as -mem")
+var memoryLowMB = flag.Uint("mem-low", 0, "best effort memory protection in megabytes")
+var memoryMinMB = flag.Uint("mem-min", 0, "hard memory protection in megabytes")
+var swapMB = flag.Uint("swap", 0, "swap in megabytes, 0 means no limit is applied")
+var noSwap = flag.Bool("no-swap", false, "disable swap")
+var ioWeight = flag.Uint("io-weight", 0, "io weight (1-10000), 0 means the default weight")
+var pidsMax = flag.Uint("pids", 0, "maximum number of processes, 0 means no limit is applied")
 
 // This is just a test utility for system testing.
 func main() {
@@ -33,13 +46,35 @@ func main() {
 		fmt.Println(e)
 		os.Exit(1)
 	}
+	var cpuMillis uint
+	if *cpus != "" {
+		if cpuMillis, e = executor.ParseCPUQuantity(*cpus); e != nil {
+			fmt.Println(e)
+			os.Exit(1)
+		}
+	}
 	config := &executor.ProcessConfig{
-		Cmd:        flag.Args()[0],
-		Args:       flag.Args()[1:],
-		CPUPercent: *cpuPercent,
-		MemoryMB:   *memoryMB,
-		ReadBPS:    *rbps,
-		WriteBPS:   *wbps}
+		Cmd:  flag.Args()[0],
+		Args: flag.Args()[1:],
+		Limits: executor.Limits{
+			CPUPercent:    *cpuPercent,
+			CPUMillis:     cpuMillis,
+			CPUPeriodUsec: *cpuPeriod,
+			CPUBurstUsec:  *cpuBurst,
+			CPUWeight:     *cpuWeight,
+			CpusetCpus:    *cpusetCpus,
+			CpusetMems:    *cpusetMems,
+			MemoryMB:      *memoryMB,
+			MemoryHighMB:  *memoryHighMB,
+			MemoryLowMB:   *memoryLowMB,
+			MemoryMinMB:   *memoryMinMB,
+			MemorySwapMB:  *swapMB,
+			NoSwap:        *noSwap,
+			IOWeight:      *ioWeight,
+			ReadBPS:       *rbps,
+			WriteBPS:      *wbps,
+			PidsMax:       *pidsMax,
+		}}
 
 	pid, err := s.Start(config)
 	if err != nil {
@@ -0,0 +1,141 @@
+package executor
+
+import (
+	"fmt"
+	log "log/slog"
+	"time"
+)
+
+// defaultAdmissionInterval is how often the host pressure is checked to admit queued jobs
+const defaultAdmissionInterval = time.Second
+
+// AdmissionThresholds are the host pressure limits above which new jobs are held Queued.
+// Each value is the percentage of time at least one task stalled on the resource over
+// the last 10 seconds ("some avg10"), 0 disables the check for the resource.
+type AdmissionThresholds struct {
+	CPU    float64
+	Memory float64
+	IO     float64
+}
+
+func (t AdmissionThresholds) enabled() bool {
+	return t.CPU > 0 || t.Memory > 0 || t.IO > 0
+}
+
+// exceeded describes the first resource whose pressure is above its threshold, empty if none is
+func (t AdmissionThresholds) exceeded(p ResourcePressure) string {
+	for _, r := range []struct {
+		name      string
+		pressure  float64
+		threshold float64
+	}{
+		{"cpu", p.CPU.Some.Avg10, t.CPU},
+		{"memory", p.Memory.Some.Avg10, t.Memory},
+		{"io", p.IO.Some.Avg10, t.IO},
+	} {
+		if r.threshold > 0 && r.pressure > r.threshold {
+			return fmt.Sprintf("%s pressure %.2f%% above %.2f%%", r.name, r.pressure, r.threshold)
+		}
+	}
+	return ""
+}
+
+// Option configures an Executor
+type Option func(*Executor)
+
+// WithAdmission holds new jobs Queued while the host pressure is above thresholds. The pressure
+// is checked every interval and queued jobs are started one at a time in submission order.
+func WithAdmission(thresholds AdmissionThresholds, interval time.Duration) Option {
+	return func(s *Executor) {
+		s.admission = thresholds
+		s.admissionInterval = interval
+		if s.admissionInterval <= 0 {
+			s.admissionInterval = defaultAdmissionInterval
+		}
+	}
+}
+
+// HostPressure returns the pressure of the cgroup holding the jobs of the Executor
+func (s *Executor) HostPressure() (ResourcePressure, error) {
+	return s.hostPressure()
+}
+
+// QueuedJobs returns the number of jobs held by the admission control
+func (s *Executor) QueuedJobs() int {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	return len(s.queue)
+}
+
+// hold queues p if other jobs are already waiting or the host pressure is above the admission thresholds
+func (s *Executor) hold(p *process) (bool, error) {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	var reason string
+	if len(s.queue) > 0 {
+		// Jobs are admitted in order, a new job can not overtake the queue
+		reason = fmt.Sprintf("%d jobs queued before it", len(s.queue))
+	} else if reason = s.pressureExceeded(); reason == "" {
+		return false, nil
+	}
+	if err := p.hold(reason); err != nil {
+		return false, err
+	}
+	s.queue = append(s.queue, p)
+	s.register(p)
+	return true, nil
+}
+
+// pressureExceeded describes why the host is under pressure, empty if jobs can be admitted.
+// Jobs are admitted if the pressure can not be read so that a kernel without PSI does not block them.
+func (s *Executor) pressureExceeded() string {
+	pressure, err := s.hostPressure()
+	if err != nil {
+		log.Warn("error reading host pressure, admitting jobs", "error", err)
+		return ""
+	}
+	return s.admission.exceeded(pressure)
+}
+
+// admitQueued starts the queued jobs while the host pressure is below the admission thresholds,
+// a single job is started per interval so that the pressure accounts for it before admitting the next.
+func (s *Executor) admitQueued() {
+	ticker := time.NewTicker(s.admissionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.admitNext()
+		}
+	}
+}
+
+func (s *Executor) admitNext() {
+	// The lock is held while starting so that StopProcess does not see a job leaving the queue half started
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	if len(s.queue) == 0 || s.pressureExceeded() != "" {
+		return
+	}
+	p := s.queue[0]
+	s.queue = s.queue[1:]
+	if err := p.Start(); err != nil {
+		log.Warn("error starting queued job", "job", p.ID, "error", err)
+		p.abort(err)
+	}
+}
+
+// dequeue removes p from the queue, false means p was not queued
+func (s *Executor) dequeue(p *process) bool {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	for i, queued := range s.queue {
+		if queued == p {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+//go:build linux
+
+package executor
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAdmission(t *testing.T) {
+	var underPressure atomic.Bool
+	underPressure.Store(true)
+	s := &Executor{
+		admission:         AdmissionThresholds{CPU: 50},
+		admissionInterval: 10 * time.Millisecond,
+		done:              make(chan struct{}),
+		hostPressure: func() (ResourcePressure, error) {
+			if underPressure.Load() {
+				return ResourcePressure{CPU: Pressure{Some: PressureValues{Avg10: 80}}}, nil
+			}
+			return ResourcePressure{}, nil
+		},
+		id:     uuid.New(),
+		jobs:   map[uint64]*process{},
+		nextID: -1,
+		wg:     &sync.WaitGroup{},
+	}
+	defer s.Stop()
+
+	first, err := s.Start(&ProcessConfig{Cmd: "echo", Args: []string{"first"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	second, err := s.Start(&ProcessConfig{Cmd: "echo", Args: []string{"second"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if info := s.Get(first); info.State != Queued.String() || info.OsPid != -1 {
+		t.Fatalf("expected a queued job without pid but %s/%d was found", info.State, info.OsPid)
+	}
+	// The output of a queued job can be followed until it terminates
+	output, err := s.Stdout(first)
+	if err != nil {
+		t.Fatalf("unexpected error reading the output of a queued job: %s", err)
+	}
+	defer output.Close()
+	if s.QueuedJobs() != 2 {
+		t.Fatalf("expected 2 queued jobs but %d were found", s.QueuedJobs())
+	}
+
+	s.StopProcess(second)
+	if info := s.Get(second); info.State != Failed.String() || info.Error == nil {
+		t.Fatalf("expected a failed job but %s was found", info.State)
+	}
+	aborted, err := s.Stdout(second)
+	if err != nil {
+		t.Fatalf("unexpected error reading the output of an aborted job: %s", err)
+	}
+	defer aborted.Close()
+	if content, _ := io.ReadAll(aborted); len(content) != 0 {
+		t.Fatalf("expected no output but '%s' was found", content)
+	}
+
+	// A queued job has no terminal yet, Attach waits for it to start
+	tty, err := s.Start(&ProcessConfig{Cmd: "echo", Args: []string{"tty"}, TTY: true})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Attach(ctx, tty, true); err != context.DeadlineExceeded {
+		t.Fatalf("expected attach to wait for the queued job but %v was returned", err)
+	}
+	attached := make(chan error, 1)
+	go func() {
+		reader, _, err := s.Attach(context.Background(), tty, true)
+		if err == nil {
+			reader.Close()
+		}
+		attached <- err
+	}()
+
+	go s.admitQueued()
+	time.Sleep(50 * time.Millisecond)
+	if info := s.Get(first); info.State != Queued.String() {
+		t.Fatalf("job was started under pressure")
+	}
+	underPressure.Store(false)
+	s.Wait()
+
+	if err := <-attached; err != nil {
+		t.Fatalf("unexpected error attaching to the admitted job: %s", err)
+	}
+
+	info := s.Get(first)
+	if info.State != Completed.String() {
+		t.Fatalf("expected a completed job but %s was found", info.State)
+	}
+	if content, err := io.ReadAll(output); err != nil || string(content) != "first\n" {
+		t.Fatalf("expected first but '%s' was found: %v", content, err)
+	}
+	if len(info.History) == 0 || info.History[0].Type != Held || info.History[0].Message != "cpu pressure 80.00% above 50.00%" {
+		t.Fatalf("unexpected history %v", info.History)
+	}
+}
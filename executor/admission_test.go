@@ -0,0 +1,28 @@
+package executor
+
+import "testing"
+
+func TestAdmissionThresholds(t *testing.T) {
+	pressure := ResourcePressure{
+		CPU:    Pressure{Some: PressureValues{Avg10: 40}},
+		Memory: Pressure{Some: PressureValues{Avg10: 5}, Full: PressureValues{Avg10: 90}},
+	}
+	tests := []struct {
+		name       string
+		thresholds AdmissionThresholds
+		expected   string
+	}{
+		{"disabled", AdmissionThresholds{}, ""},
+		{"below", AdmissionThresholds{CPU: 50, Memory: 10, IO: 10}, ""},
+		{"equal", AdmissionThresholds{CPU: 40}, ""},
+		{"cpu", AdmissionThresholds{CPU: 20, Memory: 1}, "cpu pressure 40.00% above 20.00%"},
+		{"memory ignores full", AdmissionThresholds{Memory: 1}, "memory pressure 5.00% above 1.00%"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if reason := test.thresholds.exceeded(pressure); reason != test.expected {
+				t.Fatalf("expected \"%s\" but \"%s\" was returned", test.expected, reason)
+			}
+		})
+	}
+}
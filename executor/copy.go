@@ -0,0 +1,186 @@
+package executor
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	log "log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"minidocker/internal/archive"
+	"minidocker/internal/mount"
+)
+
+// sandboxPaths are the mounts private to the sandbox: the rest of the filesystem is shared
+// with the host and can't be accessed by CopyIn, CopyOut or saved as artifact.
+var sandboxPaths = []string{"/tmp"}
+
+// sandboxRetention is how long the sandbox of a terminated process is kept for CopyOut
+const sandboxRetention = 5 * time.Minute
+
+// checkSandboxPath returns the cleaned path or an error if path is not within sandboxPaths
+func checkSandboxPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s is not an absolute path", path)
+	}
+	clean := filepath.Clean(path)
+	for _, p := range sandboxPaths {
+		if clean == p || strings.HasPrefix(clean, p+"/") {
+			return clean, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside of the sandbox private paths %s", path, strings.Join(sandboxPaths, ", "))
+}
+
+// writeSandboxPath adds path, checked by checkSandboxPath, to the tar archive. It must run inside the sandbox
+// mount namespace. No component of path is followed when it is a symbolic link as the job can change them
+// while the archive is written.
+func writeSandboxPath(tw *tar.Writer, path string) error {
+	parent, err := archive.OpenDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+	return archive.WriteAt(tw, parent, filepath.Base(path))
+}
+
+// inSandbox runs f inside the process mount namespace, without the capabilities bypassing the file permissions
+// so that the files of the sandbox are accessed with the permissions of its root
+func (p *process) inSandbox(f func() error) error {
+	p.sandboxMutex.Lock()
+	defer p.sandboxMutex.Unlock()
+	if p.mntNS == nil {
+		return fmt.Errorf("the sandbox of job %d is not available", p.ID)
+	}
+	return inMountNamespace(p.mntNS, func() error {
+		// The filesystems mounted in a user namespace, like the private /tmp, do not map the host root
+		if err := p.actAsSandboxRoot(); err != nil {
+			return err
+		}
+		if err := mount.DropFilePermissionCapabilities(); err != nil {
+			return err
+		}
+		return f()
+	})
+}
+
+// releaseSandbox drops the reference to the mount namespace, the kernel destroys it with its mounts,
+// and removes the writable layer of an image job
+func (p *process) releaseSandbox() {
+	p.sandboxMutex.Lock()
+	defer p.sandboxMutex.Unlock()
+	if p.mntNS != nil {
+		p.mntNS.Close()
+		p.mntNS = nil
+	}
+	if p.overlayDir != "" {
+		if err := os.RemoveAll(p.overlayDir); err != nil {
+			log.Warn("error removing job root filesystem", "job", p.ID, "error", err)
+		}
+		p.overlayDir = ""
+	}
+}
+
+// copyOut writes to w a tar archive of path inside the sandbox
+func (p *process) copyOut(path string, w io.Writer) error {
+	clean, err := checkSandboxPath(path)
+	if err != nil {
+		return err
+	}
+	return p.inSandbox(func() error {
+		tw := tar.NewWriter(w)
+		if err := writeSandboxPath(tw, clean); err != nil {
+			return err
+		}
+		return tw.Close()
+	})
+}
+
+// copyIn extracts the tar archive read from r into the directory path inside the sandbox
+func (p *process) copyIn(path string, r io.Reader) error {
+	clean, err := checkSandboxPath(path)
+	if err != nil {
+		return err
+	}
+	return p.inSandbox(func() error {
+		// The directory is opened once, the entries are created relative to it
+		dir, err := archive.OpenDir(clean)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		return archive.ExtractAt(r, dir)
+	})
+}
+
+// saveArtifacts archives the artifact paths into a file and returns its name,
+// artifacts missing at termination are skipped.
+func (p *process) saveArtifacts() (string, error) {
+	f, err := os.CreateTemp("", "artifacts-*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = p.inSandbox(func() error {
+		for _, a := range p.config.Artifacts {
+			clean, err := checkSandboxPath(a)
+			if err != nil {
+				return err
+			}
+			if err := writeSandboxPath(tw, clean); errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error saving artifacts: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// artifacts returns the archive of the artifacts saved at termination
+func (p *process) artifacts() (io.ReadCloser, error) {
+	select {
+	case <-p.Done():
+	default:
+		return nil, fmt.Errorf("job %d has not terminated yet", p.ID)
+	}
+	p.sandboxMutex.Lock()
+	defer p.sandboxMutex.Unlock()
+	if p.artifactsErr != nil {
+		return nil, p.artifactsErr
+	}
+	if p.artifactsFile == "" {
+		return nil, fmt.Errorf("job %d has no artifacts", p.ID)
+	}
+	return os.Open(p.artifactsFile)
+}
+
+// removeArtifacts removes the archive of the artifacts once the job is forgotten,
+// the readers opened before can still read it
+func (p *process) removeArtifacts() {
+	p.sandboxMutex.Lock()
+	defer p.sandboxMutex.Unlock()
+	if p.artifactsFile == "" {
+		return
+	}
+	if err := os.Remove(p.artifactsFile); err != nil {
+		log.Warn("error removing job artifacts", "job", p.ID, "error", err)
+	}
+	p.artifactsFile = ""
+	p.artifactsErr = fmt.Errorf("the artifacts of job %d were removed", p.ID)
+}
@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultCPUPeriod is the cpu.max period in microseconds used when Limits.CPUPeriodUsec is not set
+const defaultCPUPeriod = uint(100000)
+
+// The kernel accepts periods between 1ms and 1s and quotas of at least 1ms
+const minCPUPeriod, maxCPUPeriod, minCPUQuota = uint(1000), uint(1000000), uint(1000)
+
+// ParseCPUQuantity parses a Kubernetes style CPU quantity and returns it in millicores,
+// "500m" is half a CPU while "2" and "1.5" are respectively two CPUs and one and a half.
+func ParseCPUQuantity(s string) (uint, error) {
+	if millis, found := strings.CutSuffix(s, "m"); found {
+		v, err := strconv.ParseUint(millis, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid CPU quantity %q: %w", s, err)
+		}
+		return uint(v), nil
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > 3 {
+		return 0, fmt.Errorf("invalid CPU quantity %q: the precision is limited to 1m", s)
+	}
+	// the fraction is parsed as a decimal number of millicores, a float can not represent "1.005" exactly
+	millis, err := strconv.ParseUint(whole+(fraction + "000")[:3], 10, 32)
+	if err != nil || whole == "" {
+		return 0, fmt.Errorf("invalid CPU quantity %q", s)
+	}
+	return uint(millis), nil
+}
+
+// cpuMax returns the quota and period written to cpu.max, a quota of 0 means no limit.
+// CPUMillis takes precedence over CPUPercent.
+func cpuMax(l Limits) (quota, period uint) {
+	period = l.CPUPeriodUsec
+	if period == 0 {
+		period = defaultCPUPeriod
+	}
+	switch {
+	case l.CPUMillis > 0:
+		quota = uint(uint64(l.CPUMillis) * uint64(period) / 1000)
+	case l.CPUPercent > 0:
+		quota = period / 100 * l.CPUPercent
+	}
+	return quota, period
+}
+
+// CPUMillicores returns the CPU limit in millicores, CPUPercent is a percentage of a single CPU.
+// 0 means the CPU is not limited.
+func (l Limits) CPUMillicores() uint {
+	if l.CPUMillis > 0 {
+		return l.CPUMillis
+	}
+	return l.CPUPercent * 10
+}
+
+// validateCPU verifies the CPU limits can be written to cpu.max and do not exceed the cpus of the host
+func validateCPU(l Limits, cpus int, v *ValidationError) {
+	if l.CPUPercent > 100 {
+		v.add("CPUPercent", "%d exceeds the maximum of 100", l.CPUPercent)
+	}
+	if available := uint(cpus) * 1000; l.CPUMillis > available {
+		v.add("CPUMillis", "%dm exceeds the %dm available on the host", l.CPUMillis, available)
+	}
+	if l.CPUWeight > 10000 {
+		v.add("CPUWeight", "%d is not in the range 1-10000", l.CPUWeight)
+	}
+	if l.CPUPeriodUsec != 0 && (l.CPUPeriodUsec < minCPUPeriod || l.CPUPeriodUsec > maxCPUPeriod) {
+		v.add("CPUPeriodUsec", "%dus is not in the range %dus-%dus", l.CPUPeriodUsec, minCPUPeriod, maxCPUPeriod)
+	}
+	quota, period := cpuMax(l)
+	if quota == 0 {
+		if l.CPUBurstUsec > 0 {
+			v.add("CPUBurstUsec", "a CPU limit is required")
+		}
+		return
+	}
+	if quota < minCPUQuota {
+		v.add("CPUMillis", "the quota of %dus every %dus is lower than %dus", quota, period, minCPUQuota)
+	}
+	if l.CPUBurstUsec > quota {
+		v.add("CPUBurstUsec", "%dus exceeds the quota of %dus", l.CPUBurstUsec, quota)
+	}
+}
@@ -0,0 +1,97 @@
+package executor
+
+import "testing"
+
+func TestParseCPUQuantity(t *testing.T) {
+	tests := []struct {
+		quantity string
+		millis   uint
+		err      bool
+	}{
+		{"500m", 500, false},
+		{"1", 1000, false},
+		{"2.5", 2500, false},
+		{"0.1", 100, false},
+		{"1.005", 1005, false},
+		{"0.001", 1, false},
+		{"2.000", 2000, false},
+		{".5", 0, true},
+		{"1.-5", 0, true},
+		{"0.0005", 0, true},
+		{"-1", 0, true},
+		{"1.5m", 0, true},
+		{"cpu", 0, true},
+	}
+	for _, test := range tests {
+		millis, err := ParseCPUQuantity(test.quantity)
+		if test.err != (err != nil) {
+			t.Fatalf("unexpected error parsing %s: %v", test.quantity, err)
+		}
+		if millis != test.millis {
+			t.Fatalf("expected %dm for %s but %dm was found", test.millis, test.quantity, millis)
+		}
+	}
+}
+
+func TestCPUMax(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		quota  uint
+		period uint
+	}{
+		{"NoLimit", Limits{}, 0, 100000},
+		{"Percent", Limits{CPUPercent: 10}, 10000, 100000},
+		{"Millis", Limits{CPUMillis: 2500}, 250000, 100000},
+		{"MillisOverridePercent", Limits{CPUPercent: 10, CPUMillis: 500}, 50000, 100000},
+		{"Period", Limits{CPUMillis: 250, CPUPeriodUsec: 20000}, 5000, 20000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quota, period := cpuMax(test.limits)
+			if quota != test.quota || period != test.period {
+				t.Fatalf("expected \"%d %d\" but \"%d %d\" was found", test.quota, test.period, quota, period)
+			}
+		})
+	}
+}
+
+func TestValidateCPU(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		err    bool
+	}{
+		{"NoLimit", Limits{}, false},
+		{"AllCPUs", Limits{CPUMillis: 4000}, false},
+		{"MoreThanAvailable", Limits{CPUMillis: 4001}, true},
+		{"WeightAbove10000", Limits{CPUWeight: 10001}, true},
+		{"PercentAbove100", Limits{CPUPercent: 101}, true},
+		{"PeriodTooShort", Limits{CPUMillis: 1000, CPUPeriodUsec: 999}, true},
+		{"PeriodTooLong", Limits{CPUMillis: 1000, CPUPeriodUsec: 1000001}, true},
+		{"QuotaTooSmall", Limits{CPUMillis: 5}, true},
+		{"Burst", Limits{CPUMillis: 500, CPUBurstUsec: 50000}, false},
+		{"BurstAboveQuota", Limits{CPUMillis: 500, CPUBurstUsec: 50001}, true},
+		{"BurstWithoutLimit", Limits{CPUBurstUsec: 1000}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := &ValidationError{}
+			if validateCPU(test.limits, 4, v); test.err != (len(v.Violations) > 0) {
+				t.Fatalf("unexpected violations: %v", v.Violations)
+			}
+		})
+	}
+}
+
+func TestCPUMillicores(t *testing.T) {
+	if m := (Limits{CPUPercent: 50}).CPUMillicores(); m != 500 {
+		t.Fatalf("expected 500m but %dm was returned", m)
+	}
+	if m := (Limits{CPUPercent: 50, CPUMillis: 2500}).CPUMillicores(); m != 2500 {
+		t.Fatalf("expected 2500m but %dm was returned", m)
+	}
+	if m := (Limits{}).CPUMillicores(); m != 0 {
+		t.Fatalf("expected no limit but %dm was returned", m)
+	}
+}
@@ -33,3 +33,14 @@ func environmentToMap() map[string]string {
 	}
 	return env
 }
+
+// jobEnv removes the variables of the helper from env, they hold host paths the job must not see
+func jobEnv(env []string) []string {
+	var filtered []string
+	for _, e := range env {
+		if !strings.HasPrefix(e, jesEnvPrefix) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
@@ -1,9 +1,14 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"minidocker/internal/image"
 	"minidocker/internal/mount"
+	"minidocker/internal/volume"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,6 +33,23 @@ type ProcInfo struct {
 	State string
 	// TerminatedAt is the time he process was terminated
 	TerminatedAt time.Time
+	// Cause tells why the process terminated (Exited, Signaled, OOMKilled), empty while it runs
+	Cause string
+	// ExitCode is the exit status of the process, -1 if it was killed by a signal
+	ExitCode int
+	// PeakMemory is the maximum memory used by the process in bytes
+	PeakMemory uint64
+	// MemoryMax is the memory limit in bytes the process had at termination, 0 means unlimited
+	MemoryMax uint64
+	// Limits are the resource limits currently applied to the process
+	Limits Limits
+	// History lists the job events like limits updates in chronological order
+	History []Event
+	// Cmd and Args are the command executed by the process
+	Cmd  string
+	Args []string
+	// Accounting is the resource usage of the process read at termination, nil while it runs
+	Accounting *Accounting
 }
 
 // Executor is a simple Process executor for Linux that guarantees isolation between
@@ -35,30 +57,94 @@ type ProcInfo struct {
 // NOTE: This component is unbounded as it's not a requirement in the feature request doc, normally
 // process should be inserted into a bounded queue and only 'MaxProcs' would run concurrently.
 type Executor struct {
+	// admission holds jobs Queued while the host is under pressure, it is disabled by default
+	admission         AdmissionThresholds
+	admissionInterval time.Duration
+	// cgroupRoot is the cgroup holding the cgroups of the jobs
+	cgroupRoot string
+	// dataRoot holds the state of the Executor like the imported images
+	dataRoot  string
 	deviceMaj uint
 	deviceMin uint
 	done      chan struct{}
-	id        uuid.UUID
-	jobs      map[uint64]*process
-	mutex     sync.RWMutex
-	nextID    int64
-	wg        *sync.WaitGroup
+	host      hostResources
+	// hostPressure reads the pressure of the cgroup holding the jobs
+	hostPressure func() (ResourcePressure, error)
+	id           uuid.UUID
+	images       *image.Store
+	// imagesMutex prevents an image from being removed while a job using it is started
+	imagesMutex sync.RWMutex
+	jobs        map[uint64]*process
+	mutex       sync.RWMutex
+	nextID      int64
+	volumes     *volume.Store
+	// volumesMutex prevents a volume from being removed while a job using it is started
+	volumesMutex sync.RWMutex
+	// queue holds the jobs waiting for admission in submission order
+	queue      []*process
+	queueMutex sync.Mutex
+	stopOnce   sync.Once
+	// userns maps the ids of the sandboxes to host ids, the jobs run in the user namespace of the Executor without it
+	userns UserNamespace
+	wg     *sync.WaitGroup
 }
 
-func New() (*Executor, error) {
+// defaultCgroupRoot is the root of the cgroup2 hierarchy
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// WithCgroupRoot sets the cgroup holding the cgroups of the jobs, it defaults to /sys/fs/cgroup.
+// An Executor not started as root needs a cgroup delegated to its user.
+func WithCgroupRoot(dir string) Option {
+	return func(s *Executor) {
+		s.cgroupRoot = dir
+	}
+}
+
+func New(options ...Option) (*Executor, error) {
 	maj, min, err := mount.GetRootDeviceMajorMinor()
 	if err != nil {
 		return nil, fmt.Errorf("error reading device info: %w", err)
 	}
 	s := &Executor{
-		deviceMaj: maj,
-		deviceMin: min,
-		id:        uuid.New(),
-		jobs:      make(map[uint64]*process),
-		mutex:     sync.RWMutex{},
-		nextID:    -1,
-		wg:        &sync.WaitGroup{},
-		done:      make(chan struct{}),
+		cgroupRoot: defaultCgroupRoot,
+		dataRoot:   defaultDataRoot,
+		deviceMaj:  maj,
+		deviceMin:  min,
+		id:         uuid.New(),
+		jobs:       make(map[uint64]*process),
+		mutex:      sync.RWMutex{},
+		nextID:     -1,
+		wg:         &sync.WaitGroup{},
+		done:       make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	privileged := os.Geteuid() == 0
+	if !privileged && !s.userns.enabled() {
+		s.userns = ownIDs()
+	}
+	if s.userns.enabled() {
+		if err := checkUserNamespace(s.userns, privileged); err != nil {
+			return nil, err
+		}
+	}
+	if s.userns.enabled() && privileged {
+		// The root of the sandboxes reaches the root filesystems and the volumes through the data root
+		if err := makeSearchable(s.dataRoot, filepath.Join(s.dataRoot, "jobs"), filepath.Join(s.dataRoot, "volumes")); err != nil {
+			return nil, fmt.Errorf("error preparing data root: %w", err)
+		}
+	}
+	if s.host, err = readHostResources(s.cgroupRoot, maj > 1); err != nil {
+		return nil, fmt.Errorf("error reading host resources: %w", err)
+	}
+	s.hostPressure = func() (ResourcePressure, error) {
+		return readHostPressure(s.cgroupRoot)
+	}
+	s.images = image.NewStore(filepath.Join(s.dataRoot, "images"))
+	s.volumes = volume.NewStore(filepath.Join(s.dataRoot, "volumes"))
+	if s.admission.enabled() {
+		go s.admitQueued()
 	}
 	return s, nil
 }
@@ -75,10 +161,20 @@ func (s *Executor) Get(ID uint64) *ProcInfo {
 	return &ProcInfo{
 		ID:           p.ID,
 		CreatedAt:    status.CreatedAt,
-		OsPid:        p.execCmd.Process.Pid,
+		OsPid:        status.Pid,
+		StartedAt:    status.StartedAt,
 		State:        status.State.String(),
-		Error:        p.execCmd.Err,
+		Error:        status.err,
 		TerminatedAt: status.TerminatedAt,
+		Cause:        status.Cause.String(),
+		ExitCode:     status.ExitCode,
+		PeakMemory:   status.PeakMemory,
+		MemoryMax:    status.MemoryMax,
+		Limits:       p.Limits(),
+		History:      p.History(),
+		Cmd:          p.config.Cmd,
+		Args:         p.config.Args,
+		Accounting:   status.Accounting,
 	}
 }
 
@@ -93,19 +189,52 @@ func (s *Executor) List() []uint64 {
 	return output
 }
 
-// Start starts a process and executes it immediately,
+// Start starts a process and executes it immediately unless the admission control holds it Queued,
 // returns a process ID or error is returned if the process can not be started
-// NOTE: I would normally make this call blocking if the Process intake Queue has reached capacity.
 func (s *Executor) Start(c *ProcessConfig) (uint64, error) {
+	limits, err := validateLimits(c.Limits, s.host)
+	if err != nil {
+		return 0, err
+	}
+	if c.Image != "" {
+		s.imagesMutex.RLock()
+		defer s.imagesMutex.RUnlock()
+		if err := s.resolveImage(c); err != nil {
+			return 0, err
+		}
+	}
+	if len(c.Volumes) > 0 {
+		s.volumesMutex.RLock()
+		defer s.volumesMutex.RUnlock()
+		if err := s.resolveVolumes(c); err != nil {
+			return 0, err
+		}
+	}
 	id := atomic.AddInt64(&s.nextID, int64(1))
+	c.Limits = limits
 	c.deviceMajor = s.deviceMaj
 	c.deviceMinor = s.deviceMin
 	c.cgroupPrefix = s.id.String()
+	c.cgroupRoot = s.cgroupRoot
+	c.userns = s.userns
 	p := newProcess(uint64(id), *c)
 
+	if s.admission.enabled() {
+		if held, err := s.hold(p); err != nil {
+			return 0, err
+		} else if held {
+			return p.ID, nil
+		}
+	}
 	if err := p.Start(); err != nil {
 		return 0, err
 	}
+	s.register(p)
+	return p.ID, nil
+}
+
+// register adds p to the jobs of the Executor, Wait returns once it terminates
+func (s *Executor) register(p *process) {
 	s.mutex.Lock()
 	s.jobs[p.ID] = p
 	s.mutex.Unlock()
@@ -115,7 +244,6 @@ func (s *Executor) Start(c *ProcessConfig) (uint64, error) {
 		<-p.Done()
 		s.wg.Done()
 	}()
-	return p.ID, nil
 }
 
 // Stdout returns a io.Reader to the process standard output
@@ -136,13 +264,130 @@ func (s *Executor) Stdout(p uint64) (io.ReadCloser, error) {
 	return &pollingReader{j, r}, nil
 }
 
+// Attach returns a reader of the process output and a writer to the process terminal.
+// Unless replay is true the reader starts at the current end of the output, like "docker attach".
+// A queued process has no terminal yet, Attach waits for it to start until ctx is done.
+// An error is returned if the process was not started with a TTY.
+func (s *Executor) Attach(ctx context.Context, p uint64, replay bool) (io.ReadCloser, io.Writer, error) {
+	j, err := s.find(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	select {
+	case <-j.running:
+	case <-j.Done():
+		// A queued job that is stopped or fails to start never runs
+		select {
+		case <-j.running:
+		default:
+			return nil, nil, fmt.Errorf("job %d did not start: %v", p, j.Error())
+		}
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	w, err := j.Stdin()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := j.Stdout()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !replay {
+		if _, err := r.(io.Seeker).Seek(0, io.SeekEnd); err != nil {
+			r.Close()
+			return nil, nil, err
+		}
+	}
+	return &pollingReader{j, r}, w, nil
+}
+
+// Resize changes the terminal window size of the process
+func (s *Executor) Resize(p uint64, rows, cols uint16) error {
+	j, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	return j.Resize(rows, cols)
+}
+
+// CopyOut writes to w a tar archive of path inside the process sandbox. The sandbox
+// is available while the process runs and for a few minutes after it terminates.
+func (s *Executor) CopyOut(p uint64, path string, w io.Writer) error {
+	j, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	return j.copyOut(path, w)
+}
+
+// CopyIn extracts the tar archive read from r into the directory path inside the process sandbox
+func (s *Executor) CopyIn(p uint64, path string, r io.Reader) error {
+	j, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	return j.copyIn(path, r)
+}
+
+// Artifacts returns the tar archive of the artifact paths saved when the process terminated
+func (s *Executor) Artifacts(p uint64) (io.ReadCloser, error) {
+	j, err := s.find(p)
+	if err != nil {
+		return nil, err
+	}
+	return j.artifacts()
+}
+
+// UpdateLimits replaces the resource limits of a running process, limits not set in limits are removed.
+// Each cgroup controller is updated atomically, if one fails the controllers already updated are restored.
+func (s *Executor) UpdateLimits(p uint64, limits Limits) error {
+	limits, err := validateLimits(limits, s.host)
+	if err != nil {
+		return err
+	}
+	j, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	return j.UpdateLimits(limits)
+}
+
+// Stats returns the resources used by the running process p
+func (s *Executor) Stats(p uint64) (*Stats, error) {
+	j, err := s.find(p)
+	if err != nil {
+		return nil, err
+	}
+	return j.stats()
+}
+
+// find returns the process with ID p or an error if it does not exist
+func (s *Executor) find(p uint64) (*process, error) {
+	s.mutex.RLock()
+	j, ok := s.jobs[p]
+	s.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("job %d not found", p)
+	}
+	return j, nil
+}
+
 // Wait will block until there no active processes
 func (s *Executor) Wait() {
 	s.wg.Wait()
 }
 
-// Stop terminates the process and cleans up it's CGroup and namespaces
+// Stop terminates the process and cleans up it's CGroup and namespaces, queued jobs are never started
 func (s *Executor) Stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+	s.queueMutex.Lock()
+	for _, p := range s.queue {
+		p.abort(fmt.Errorf("executor stopped"))
+	}
+	s.queue = nil
+	s.queueMutex.Unlock()
+
 	s.mutex.RLock()
 	for _, job := range s.jobs {
 		switch job.Status().State {
@@ -152,6 +397,14 @@ func (s *Executor) Stop() {
 	}
 	s.mutex.RUnlock()
 	s.wg.Wait()
+
+	// The writable layers and the artifacts of the jobs are not kept after the Executor
+	s.mutex.RLock()
+	for _, job := range s.jobs {
+		job.releaseSandbox()
+		job.removeArtifacts()
+	}
+	s.mutex.RUnlock()
 }
 
 // StopProcess terminates the process indicated by pid
@@ -159,7 +412,12 @@ func (s *Executor) StopProcess(pid uint64) {
 	s.mutex.RLock()
 	p, ok := s.jobs[pid]
 	s.mutex.RUnlock()
-	if ok {
-		p.Stop()
+	if !ok {
+		return
+	}
+	if s.dequeue(p) {
+		p.abort(fmt.Errorf("stopped while queued"))
+		return
 	}
+	p.Stop()
 }
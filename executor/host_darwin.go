@@ -0,0 +1,22 @@
+//go:build darwin
+
+package executor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// readHostResources only reports the CPUs for non-linux builds, jobs have no cgroup on darwin
+func readHostResources(_ string, rootBlockDevice bool) (hostResources, error) {
+	cpus := map[int]bool{}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		cpus[i] = true
+	}
+	return hostResources{cpus: cpus, memoryNodes: map[int]bool{0: true}, rootBlockDevice: rootBlockDevice}, nil
+}
+
+// readHostPressure is not supported for non-linux builds
+func readHostPressure(_ string) (ResourcePressure, error) {
+	return ResourcePressure{}, fmt.Errorf("not supported on darwin")
+}
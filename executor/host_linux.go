@@ -0,0 +1,83 @@
+//go:build linux
+
+package executor
+
+import (
+	"errors"
+	"io/fs"
+	log "log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readHostResources reads the resources available to the job cgroups. The controllers
+// available in cgroupRoot, the cgroup holding the jobs, and not yet enabled for its children are enabled.
+func readHostResources(cgroupRoot string, rootBlockDevice bool) (hostResources, error) {
+	host := hostResources{rootBlockDevice: rootBlockDevice}
+
+	available, err := os.ReadFile(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return host, err
+	}
+	subtreeControl := filepath.Join(cgroupRoot, "cgroup.subtree_control")
+	enabled, err := os.ReadFile(subtreeControl)
+	if err != nil {
+		return host, err
+	}
+	host.controllers = map[string]bool{}
+	for _, c := range strings.Fields(string(enabled)) {
+		host.controllers[c] = true
+	}
+	for _, c := range strings.Fields(string(available)) {
+		if host.controllers[c] {
+			continue
+		}
+		if err := os.WriteFile(subtreeControl, []byte("+"+c), 0644); err != nil {
+			log.Warn("error enabling cgroup controller, limits using it will be rejected", "controller", c, "error", err)
+			continue
+		}
+		host.controllers[c] = true
+	}
+
+	if host.cpus, err = readOnlineList("/sys/devices/system/cpu/online"); err != nil {
+		return host, err
+	}
+	// Kernels without NUMA support have a single memory node
+	if host.memoryNodes, err = readOnlineList("/sys/devices/system/node/online"); errors.Is(err, fs.ErrNotExist) {
+		host.memoryNodes = map[int]bool{0: true}
+	} else if err != nil {
+		return host, err
+	}
+
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return host, err
+	}
+	host.memoryBytes = uint64(info.Totalram) * uint64(info.Unit)
+	return host, nil
+}
+
+// readOnlineList reads a list of CPUs or memory nodes like /sys/devices/system/cpu/online
+func readOnlineList(file string) (map[int]bool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseCPUList(string(b))
+	if err != nil {
+		return nil, err
+	}
+	online := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		online[id] = true
+	}
+	return online, nil
+}
+
+// readHostPressure reads the pressure of cgroupRoot, the cgroup holding the jobs
+func readHostPressure(cgroupRoot string) (ResourcePressure, error) {
+	return readPressure(cgroupRoot)
+}
@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"minidocker/internal/image"
+)
+
+// defaultDataRoot is the directory holding the state of the Executor like the imported images
+const defaultDataRoot = "/var/lib/minidocker"
+
+// WithDataRoot sets the directory holding the state of the Executor, it defaults to /var/lib/minidocker
+func WithDataRoot(dir string) Option {
+	return func(s *Executor) {
+		s.dataRoot = dir
+	}
+}
+
+// ImportImage imports the images of the OCI image layout or docker save archive read from r,
+// name replaces the name of the image when the archive holds a single image
+func (s *Executor) ImportImage(r io.Reader, name string) ([]image.Image, error) {
+	return s.images.Import(r, name)
+}
+
+// ListImages returns the imported images sorted by name
+func (s *Executor) ListImages() ([]image.Image, error) {
+	return s.images.List()
+}
+
+// RemoveImage removes the image named ref, an image used by a Queued or Running job can not be removed.
+// The sandboxes of the terminated jobs of the image are released as their root filesystem uses its layers.
+func (s *Executor) RemoveImage(ref string) error {
+	s.imagesMutex.Lock()
+	defer s.imagesMutex.Unlock()
+	img, err := s.images.Get(ref)
+	if err != nil {
+		return err
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var terminated []*process
+	for _, p := range s.jobs {
+		if p.config.imageID != img.ID {
+			continue
+		}
+		if state := p.Status().State; state == Queued || state == Running {
+			return fmt.Errorf("image %s is used by job %d", ref, p.ID)
+		}
+		terminated = append(terminated, p)
+	}
+	for _, p := range terminated {
+		p.releaseSandbox()
+	}
+	return s.images.Remove(ref)
+}
+
+// Diff writes to w an uncompressed OCI layer archive of the changes terminated job p made to the root filesystem
+// of its image, deleted files are recorded as whiteouts. The changes are available until the sandbox is released.
+func (s *Executor) Diff(p uint64, w io.Writer) error {
+	j, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	return j.withUpperDir(func(upper string) error {
+		return image.WriteLayer(w, upper, j.layerOwners())
+	})
+}
+
+// Commit imports as the image name the image of terminated job p extended by a layer holding the changes
+// the job made to its root filesystem, the configuration of the image is kept
+func (s *Executor) Commit(p uint64, name string) (image.Image, error) {
+	j, err := s.find(p)
+	if err != nil {
+		return image.Image{}, err
+	}
+	// The image can not be removed while its layers are referenced
+	s.imagesMutex.RLock()
+	defer s.imagesMutex.RUnlock()
+	var img image.Image
+	err = j.withUpperDir(func(upper string) error {
+		parent, err := s.images.Get(j.config.imageID)
+		if err != nil {
+			return err
+		}
+		img, err = s.images.Commit(parent, upper, name, j.layerOwners())
+		return err
+	})
+	return img, err
+}
+
+// withUpperDir calls f with the writable layer of the root filesystem of the terminated image job p,
+// the sandbox is not released while f runs
+func (p *process) withUpperDir(f func(upper string) error) error {
+	if p.config.Image == "" {
+		return fmt.Errorf("job %d does not run in an image", p.ID)
+	}
+	if state := p.Status().State; state == Queued || state == Running {
+		return fmt.Errorf("job %d has not terminated", p.ID)
+	}
+	p.sandboxMutex.Lock()
+	defer p.sandboxMutex.Unlock()
+	if p.overlayDir == "" {
+		return fmt.Errorf("the sandbox of job %d is not available", p.ID)
+	}
+	return f(filepath.Join(p.overlayDir, "upper"))
+}
+
+// layerOwners translates the owners of the writable layer of p, owned by the host ids of the sandbox
+// when its layers are idmapped, to the ids of the sandbox
+func (p *process) layerOwners() image.Owners {
+	if !p.mapsOverlay() {
+		return nil
+	}
+	return p.config.userns.sandboxIDs
+}
+
+// resolveImage runs c in the root filesystem of its image, the job writes to its own layer stacked over
+// the layers of the image. Without a command the entrypoint and the command
+// of the image are executed, a command replaces both. The image environment is extended by the one of c.
+func (s *Executor) resolveImage(c *ProcessConfig) error {
+	img, err := s.images.Get(c.Image)
+	if err != nil {
+		return err
+	}
+	c.layers = s.images.LayerDirs(img)
+	slices.Reverse(c.layers)
+	c.jobsDir = filepath.Join(s.dataRoot, "jobs")
+	c.imageID = img.ID
+	if c.Cmd == "" {
+		argv := append(slices.Clone(img.Config.Entrypoint), img.Config.Cmd...)
+		if len(argv) == 0 {
+			return fmt.Errorf("image %s has no command, a command must be given", c.Image)
+		}
+		c.Cmd, c.Args = argv[0], argv[1:]
+	}
+	c.Env = append(slices.Clone(img.Config.Env), c.Env...)
+	if c.WorkingDir == "" {
+		c.WorkingDir = img.Config.WorkingDir
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+//go:build linux
+
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"minidocker/internal/archive"
+	"minidocker/internal/image"
+
+	"github.com/google/uuid"
+	"golang.org/x/sys/unix"
+)
+
+func TestImageJob(t *testing.T) {
+	dataRoot := t.TempDir()
+	s := &Executor{
+		dataRoot: dataRoot,
+		done:     make(chan struct{}),
+		id:       uuid.New(),
+		images:   image.NewStore(filepath.Join(dataRoot, "images")),
+		jobs:     map[uint64]*process{},
+		nextID:   -1,
+		wg:       &sync.WaitGroup{},
+	}
+	defer s.Stop()
+	importShellImage(t, s.images, `{"config": {"Entrypoint": ["/bin/sh", "-c"], "Cmd": ["echo $GREETING from $(pwd)"], "Env": ["GREETING=hello"], "WorkingDir": "/srv"}}`)
+
+	pid, err := s.Start(&ProcessConfig{Image: "shell"})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if output := readOutput(t, s, pid); output != "hello from /srv\n" {
+		t.Fatalf("expected the entrypoint and the command of the image to run but '%s' was found", output)
+	}
+
+	// A command replaces the entrypoint and the environment extends the one of the image
+	reader, writer := io.Pipe()
+	pid, err = s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "read x; echo $GREETING $x"}, Env: []string{"GREETING=bye"}, Stdin: reader})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if err := s.RemoveImage("shell"); err == nil {
+		t.Fatal("error was expected removing the image of a running job")
+	}
+	writer.Write([]byte("now\n"))
+	writer.Close()
+	if output := readOutput(t, s, pid); output != "bye now\n" {
+		t.Fatalf("expected the command to run with the overridden environment but '%s' was found", output)
+	}
+
+	// The changes of a job are written to its own layer, the image is not modified
+	pid, err = s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "echo created > /created"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	readOutput(t, s, pid)
+	changed := pid
+	pid, err = s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "test -e /created || echo clean"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if output := readOutput(t, s, pid); output != "clean\n" {
+		t.Fatalf("expected the changes of a job not to be seen by the next one but '%s' was found", output)
+	}
+	if jobs, _ := os.ReadDir(filepath.Join(dataRoot, "jobs")); len(jobs) == 0 {
+		t.Fatal("expected the writable layers to be kept with the sandboxes")
+	}
+
+	// The changes of a job are committed as a new image
+	if _, err := s.Commit(changed, "shell:changed"); err != nil {
+		t.Fatalf("commit returned error: %v", err)
+	}
+	pid, err = s.Start(&ProcessConfig{Image: "shell:changed", Cmd: "sh", Args: []string{"-c", "read x < /created; echo $x"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if output := readOutput(t, s, pid); output != "created\n" {
+		t.Fatalf("expected the committed image to hold the changes of the job but '%s' was found", output)
+	}
+	if err := s.RemoveImage("shell:changed"); err != nil {
+		t.Fatalf("remove returned error: %v", err)
+	}
+
+	if err := s.RemoveImage("shell"); err != nil {
+		t.Fatalf("remove returned error: %v", err)
+	}
+	if jobs, _ := os.ReadDir(filepath.Join(dataRoot, "jobs")); len(jobs) != 0 {
+		t.Fatalf("expected the writable layers to be removed with the image but %d were found", len(jobs))
+	}
+	if _, err := s.Start(&ProcessConfig{Image: "shell"}); err == nil {
+		t.Fatal("error was expected starting a job with a removed image")
+	}
+}
+
+// readOutput waits for job pid to terminate and returns its output
+func readOutput(t *testing.T, s *Executor, pid uint64) string {
+	reader, err := s.Stdout(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+// importShellImage imports an image named shell holding /bin/sh with the configuration config
+func importShellImage(t *testing.T, store *image.Store, config string) {
+	root := t.TempDir()
+	copyBinary(t, root, "/bin/sh")
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "layer.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		if err := archive.Write(tw, filepath.Join(root, e.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	f.Close()
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0644)
+	os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`[{"Config": "config.json", "RepoTags": ["shell"], "Layers": ["layer.tar"]}]`), 0644)
+	if _, err := store.ImportDir(dir, ""); err != nil {
+		t.Fatalf("import returned error: %v", err)
+	}
+}
+
+func TestImageUserNamespace(t *testing.T) {
+	dataRoot := t.TempDir()
+	// The root of the sandboxes searches the data root to reach the root filesystems
+	if err := makeSearchable(filepath.Dir(dataRoot), dataRoot, filepath.Join(dataRoot, "jobs")); err != nil {
+		t.Fatal(err)
+	}
+	s := &Executor{
+		dataRoot: dataRoot,
+		done:     make(chan struct{}),
+		id:       uuid.New(),
+		images:   image.NewStore(filepath.Join(dataRoot, "images")),
+		jobs:     map[uint64]*process{},
+		nextID:   -1,
+		userns:   UserNamespace{UIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}, GIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}},
+		wg:       &sync.WaitGroup{},
+	}
+	defer s.Stop()
+	importShellImage(t, s.images, `{}`)
+
+	// The files of the image owned by root on disk are owned by the root of the sandbox
+	pid, err := s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "read a b c < /proc/self/uid_map; echo $a $b $c; echo created > /bin/created && echo written"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if output := readOutput(t, s, pid); output != "0 100000 65536\nwritten\n" {
+		t.Fatalf("expected the job to write to the image as root of its user namespace but '%s' was found", output)
+	}
+
+	// The writable layer holds the files created by the root of the sandbox owned by its host ids,
+	// in a directory the other host users can not search
+	dir := s.jobs[pid].overlayDir
+	var stat unix.Stat_t
+	if err := unix.Stat(filepath.Join(dir, "upper", "bin", "created"), &stat); err != nil || stat.Uid != 100000 || stat.Gid != 100000 {
+		t.Fatalf("expected bin/created to be owned by 100000:100000 on disk but %d:%d was found: %v", stat.Uid, stat.Gid, err)
+	}
+	if err := unix.Stat(dir, &stat); err != nil || stat.Mode&0077 != 0 {
+		t.Fatalf("expected the job directory to be private but the mode %o was found: %v", stat.Mode, err)
+	}
+
+	// The files created by the root of the sandbox are owned by root in the changes
+	var b bytes.Buffer
+	if err := s.Diff(pid, &b); err != nil {
+		t.Fatalf("diff returned error: %v", err)
+	}
+	tr := tar.NewReader(&b)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			t.Fatalf("expected bin/created in the changes: %v", err)
+		}
+		if header.Name != "bin/created" {
+			continue
+		}
+		if header.Uid != 0 || header.Gid != 0 {
+			t.Fatalf("expected bin/created to be owned by root but %d:%d was found", header.Uid, header.Gid)
+		}
+		break
+	}
+	if _, err := s.Commit(pid, "shell:mapped"); err != nil {
+		t.Fatalf("commit returned error: %v", err)
+	}
+	pid, err = s.Start(&ProcessConfig{Image: "shell:mapped", Cmd: "sh", Args: []string{"-c", "read x < /bin/created; echo $x; echo again >> /bin/created && echo appended"}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if output := readOutput(t, s, pid); output != "created\nappended\n" {
+		t.Fatalf("expected the committed changes to be owned by the root of the sandbox but '%s' was found", output)
+	}
+}
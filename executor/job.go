@@ -2,15 +2,25 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	log "log/slog"
 	"minidocker/internal/mount"
+	"minidocker/internal/pty"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // ProcessConfig represents any process that can be started, stopped and monitored
@@ -21,26 +31,142 @@ type ProcessConfig struct {
 	Args []string
 	// cgroupPrefix is used to avoid cgroup naming collisions with other processes
 	cgroupPrefix string
-	// CPUPercent represents the quota of cpu to use for all cores. We would't assume the user knows
-	// the number of cores available so the minimum value is 1 and max is 100.
-	CPUPercent  uint
+	// cgroupRoot is the cgroup holding the cgroup of the process, /sys/fs/cgroup when empty
+	cgroupRoot  string
 	deviceMajor uint
 	deviceMinor uint
-	// MemoryMB represents the quota of memory to in Megabytes, it will be applied as Memory High in the CGroup
+	// Limits are the resources the process can use
+	Limits
+	// TTY allocates a pseudo-terminal for the process, the helper creates it and hands
+	// the master side over to the Executor which keeps it for Attach
+	TTY bool
+	// Stdin is fed to the process through a pipe, the copy blocks while the pipe is full
+	// so the reader is consumed at the pace of the process. If Stdin implements io.Closer
+	// it is closed once the copy ends, either at EOF or because the process stopped reading.
+	Stdin io.Reader
+	// Artifacts are paths inside the sandbox archived when the process terminates,
+	// the archive is available with Executor.Artifacts after the sandbox is released.
+	Artifacts []string
+	// Image is the name of an imported image the process runs in, it sets RootFS. Without Cmd the entrypoint
+	// and the command of the image are executed, the environment and the working directory of the image
+	// are used unless Env and WorkingDir override them.
+	Image string
+	// imageID is the ID of Image, it prevents the image from being removed while the process runs
+	imageID string
+	// layers are the unpacked layers of Image, the top layer first, overlayfs stacks them under
+	// a writable layer created in jobsDir so that the image is shared by the jobs without being modified
+	layers []string
+	// jobsDir is the directory holding the writable layers of the jobs
+	jobsDir string
+	// userns maps the ids of the sandbox to host ids, the process runs as the root of its user namespace
+	userns UserNamespace
+	// Env lists environment variables of the process in the KEY=value format, PATH can be overridden
+	Env []string
+	// WorkingDir is the directory the process starts in, it is created when missing
+	WorkingDir string
+	// Mounts are host paths bind mounted in the sandbox once its mount namespace is private
+	Mounts []Mount
+	// Volumes are named volumes mounted in the sandbox, they are added to Mounts when the process is started
+	Volumes []VolumeMount
+	// Tmpfs are memory backed filesystems mounted in the sandbox, a /tmp of DefaultTmpSizeMB is added
+	// when none is declared there
+	Tmpfs []Tmpfs
+	// Hardened mounts the sandbox read only for untrusted commands: only /proc, the terminals, /dev/shm,
+	// Tmpfs and the Mounts that are not read only are writable and they can not hold executables,
+	// set-user-ID files or devices. The command runs with the default capabilities of runc but CAP_MKNOD and with no_new_privs.
+	Hardened bool
+	// RootFS is a directory holding the root filesystem of the process, like an unpacked distribution tree.
+	// The helper pivots into it with private /proc, /sys, /dev and tmpfs, Cmd is looked up
+	// inside it. Empty runs the process on the host root filesystem.
+	RootFS string
+}
+
+// Limits represents the resources a process can use, zero values mean no limit is applied.
+// Each field is written to the cgroup file named in its comment.
+type Limits struct {
+	// CPUPercent represents the quota of cpu to use for all cores. We would't assume the user knows
+	// the number of cores available so the minimum value is 1 and max is 100 (cpu.max).
+	CPUPercent uint
+	// CPUMillis is the CPU time in millicores across all cores, 1000 is a whole CPU, it overrides CPUPercent (cpu.max)
+	CPUMillis uint
+	// CPUPeriodUsec is the period in microseconds the CPU quota is enforced over, defaults to 100000 (cpu.max)
+	CPUPeriodUsec uint
+	// CPUBurstUsec is the unused quota in microseconds the process can accumulate and use in later periods (cpu.max.burst)
+	CPUBurstUsec uint
+	// CPUWeight is the share of CPU time relative to other jobs in the range 1-10000, the kernel default is 100 (cpu.weight)
+	CPUWeight uint
+	// CpusetCpus pins the process to a list of CPUs like "0-2,4" (cpuset.cpus)
+	CpusetCpus string
+	// CpusetMems pins the process to a list of memory nodes like "0" (cpuset.mems)
+	CpusetMems string
+	// MemoryMB represents the quota of memory in Megabytes, the process is OOM killed above it (memory.max)
 	MemoryMB uint
-	// ReadBPS represents the maximum bytes for second the process can read
+	// MemoryHighMB throttles and reclaims the process memory above it, defaults to MemoryMB (memory.high)
+	MemoryHighMB uint
+	// MemoryLowMB is memory protected from reclaim unless there is no unprotected memory left (memory.low)
+	MemoryLowMB uint
+	// MemoryMinMB is memory never reclaimed from the process (memory.min)
+	MemoryMinMB uint
+	// MemorySwapMB represents the quota of swap in Megabytes (memory.swap.max)
+	MemorySwapMB uint
+	// NoSwap prevents the process from using swap, it overrides MemorySwapMB (memory.swap.max)
+	NoSwap bool
+	// IOWeight is the share of IO relative to other jobs in the range 1-10000, the kernel default is 100 (io.weight)
+	IOWeight uint
+	// ReadBPS represents the maximum bytes for second the process can read from the root device (io.max)
 	ReadBPS uint
-	// WriteBPS represents the maximum bytes for second the process can read
+	// WriteBPS represents the maximum bytes for second the process can write to the root device (io.max)
 	WriteBPS uint
+	// IODevices bounds the IO on other devices, a rule for the root device overrides ReadBPS and WriteBPS (io.max)
+	IODevices []IODeviceLimit
+	// PidsMax is the maximum number of processes and threads, it protects the host from fork bombs (pids.max)
+	PidsMax uint
+}
+
+// IODeviceLimit bounds the IO of the process on a block device, zero values mean no limit is applied
+type IODeviceLimit struct {
+	// Device is either a block device like /dev/sdb or a path on a mounted filesystem like /data,
+	// partitions are resolved to their disk as io.max only accepts whole disks
+	Device string
+	// ReadBPS is the maximum bytes per second read, the minimum accepted value is 2
+	ReadBPS uint
+	// WriteBPS is the maximum bytes per second written, the minimum accepted value is 2
+	WriteBPS uint
+	// ReadIOPS is the maximum read operations per second
+	ReadIOPS uint
+	// WriteIOPS is the maximum write operations per second
+	WriteIOPS uint
+	// major and minor are resolved from Device when the process is started
+	major uint
+	minor uint
+}
+
+// resolveIODevices returns a copy of limits with the device numbers resolved
+func resolveIODevices(limits []IODeviceLimit) ([]IODeviceLimit, error) {
+	resolved := make([]IODeviceLimit, 0, len(limits))
+	for _, l := range limits {
+		if l.ReadBPS == 1 || l.WriteBPS == 1 {
+			return nil, fmt.Errorf("invalid limit for %s: the minimum bytes per second is 2", l.Device)
+		}
+		var err error
+		if l.major, l.minor, err = mount.ResolveBlockDevice(l.Device); err != nil {
+			return nil, fmt.Errorf("invalid device %s: %w", l.Device, err)
+		}
+		resolved = append(resolved, l)
+	}
+	return resolved, nil
 }
 
 type process struct {
 	// config the configuration struct
 	config ProcessConfig
-	// cgroupPath keeps track of the cgroup location for later deletion
+	// cgroupPath keeps track of the cgroup location for later deletion, cleanUp removes the cgroup holding
+	// the status lock so that the readers and writers of the cgroup files hold it while the job runs
 	cgroupPath string
 	// done is used to signal Process termination
 	done chan struct{}
+	// running is closed once the process leaves the Queued state to run
+	running chan struct{}
 	// ID is the process identification.
 	ID uint64
 	// execCmd returns the os.Process of the child
@@ -49,15 +175,35 @@ type process struct {
 	outputFile *os.File
 	// started is used to not start the same process twice with atomic CompareSwap/IncrementAndGet pattern
 	started int32
+	// stopped records that Stop terminated the process, its signals are not attributed to the OOM killer
+	stopped atomic.Bool
 	// status represents the Process status and exit code
 	status *Status
+	// terminal is the master side of the process pseudo-terminal, nil if TTY was not requested
+	terminal *os.File
+	// terminalDone is closed once the terminal output has been fully copied to outputFile
+	terminalDone chan struct{}
+	// mntNS references the sandbox mount namespace, it is released sandboxRetention after termination
+	mntNS *os.File
+	// sandboxMutex guards mntNS so that the namespace is not released during a copy
+	sandboxMutex sync.Mutex
+	// overlayDir holds the writable layer and the root filesystem mount point of an image job,
+	// it is removed with the sandbox
+	overlayDir string
+	// artifactsFile is the archive of the artifacts saved at termination, it is removed when the Executor stops
+	artifactsFile string
+	// artifactsErr reports why the artifacts could not be saved
+	artifactsErr error
+	// history records the job events, it is guarded by the status mutex
+	history []Event
 }
 
 func newProcess(pid uint64, c ProcessConfig) *process {
 	return &process{
-		ID:     pid,
-		config: c,
-		done:   make(chan struct{}),
+		ID:      pid,
+		config:  c,
+		done:    make(chan struct{}),
+		running: make(chan struct{}),
 		status: &Status{
 			CreatedAt:    time.Now(),
 			Mutex:        &sync.Mutex{},
@@ -83,37 +229,173 @@ func (p *process) Start() error {
 
 	var err error
 	if p.execCmd, err = p.execute(ctx); err != nil {
+		p.releaseSandbox()
+		if p.cgroupPath != "" {
+			_ = rmCgroup(p.cgroupPath)
+			p.cgroupPath = ""
+		}
 		p.status.State = Failed
 		return err
 	}
 
 	p.status.Pid = p.execCmd.Process.Pid
 	p.status.State = Running
+	close(p.running)
+	p.recordEvent(Started, fmt.Sprintf("%s with pid %d", p.config.Cmd, p.status.Pid))
 
+	go p.watchMemoryEvents()
 	go p.cleanUp()
 	return nil
 }
 
+// hold records that the job was queued by the admission control, its output is created
+// so that it can be followed while the job waits
+func (p *process) hold(reason string) error {
+	output, err := os.CreateTemp("", "*")
+	if err != nil {
+		return err
+	}
+	p.status.Mutex.Lock()
+	defer p.status.Mutex.Unlock()
+	p.outputFile = output
+	p.recordEvent(Held, reason)
+	return nil
+}
+
+// abort terminates a job that was never started, like a queued job that is stopped
+func (p *process) abort(err error) {
+	p.status.Mutex.Lock()
+	defer p.status.Mutex.Unlock()
+	p.status.State = Failed
+	p.status.err = err
+	p.status.TerminatedAt = time.Now()
+	p.recordEvent(Terminated, fmt.Sprintf("not started: %s", err))
+	// Unblock the writer of the standard input
+	if c, ok := p.config.Stdin.(io.Closer); ok {
+		c.Close()
+	}
+	close(p.done)
+}
+
 // cleanUp waits for the child to exit to cleanup Cgroups and signal listeners
 func (p *process) cleanUp() {
 	state, _ := p.execCmd.Process.Wait()
+	if p.terminal != nil {
+		// The copy ends with EIO once every process holding the slave side is gone
+		<-p.terminalDone
+		p.terminal.Close()
+	}
 	p.outputFile.Sync()
 
+	if len(p.config.Artifacts) > 0 {
+		p.artifactsFile, p.artifactsErr = p.saveArtifacts()
+	}
+	time.AfterFunc(sandboxRetention, p.releaseSandbox)
+
 	p.status.Mutex.Lock()
 	defer p.status.Mutex.Unlock()
 
+	// The memory accounting is lost once the cgroup is removed
+	var final *Stats
+	if p.cgroupPath != "" {
+		var err error
+		if final, err = readStats(p.cgroupPath); err != nil {
+			log.Warn("error reading final statistics", "job", p.ID, "error", err)
+		}
+	}
+
 	p.status.TerminatedAt = time.Now()
-	if state.ExitCode() > 0 {
+	p.status.ExitCode = state.ExitCode()
+	p.status.Cause = terminationCause(state, final, p.stopped.Load())
+	if final != nil {
+		p.status.PeakMemory = final.MemoryPeak
+		p.status.MemoryMax = final.MemoryMax
+		p.status.Accounting = newAccounting(final)
+	}
+	if !state.Success() {
 		p.status.State = Failed
 		p.status.err = fmt.Errorf(state.String())
 	} else {
 		p.status.State = Completed
 	}
+	p.recordEvent(Terminated, fmt.Sprintf("%s with exit code %d", p.status.Cause, p.status.ExitCode))
+	if p.status.Cause == OOMKilled {
+		log.Warn("job killed by the OOM killer", "job", p.ID, "peakMemory", p.status.PeakMemory, "memoryMax", p.status.MemoryMax)
+	}
 
 	_ = rmCgroup(p.cgroupPath)
 	close(p.done)
 }
 
+// UpdateLimits replaces the limits of the running process rewriting its cgroup in place
+func (p *process) UpdateLimits(l Limits) error {
+	p.status.Mutex.Lock()
+	defer p.status.Mutex.Unlock()
+	if p.status.State != Running {
+		return fmt.Errorf("job %d is not running", p.ID)
+	}
+	if p.cgroupPath == "" {
+		return fmt.Errorf("job %d has no cgroup", p.ID)
+	}
+	updated := p.config
+	updated.Limits = l
+	if err := updateCgroup(p.cgroupPath, p.config, updated); err != nil {
+		return err
+	}
+	p.recordEvent(LimitsUpdated, describeLimitChanges(p.config.Limits, l))
+	p.config.Limits = l
+	return nil
+}
+
+// describeLimitChanges lists the limits that differ between previous and updated
+func describeLimitChanges(previous, updated Limits) string {
+	var changes []string
+	before, after := reflect.ValueOf(previous), reflect.ValueOf(updated)
+	for i := 0; i < before.NumField(); i++ {
+		if reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s %v -> %v", before.Type().Field(i).Name, before.Field(i).Interface(), after.Field(i).Interface()))
+	}
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// recordEvent appends an event to the job history, the caller must hold the status mutex
+func (p *process) recordEvent(t EventType, message string) {
+	p.history = append(p.history, Event{Time: time.Now(), Type: t, Message: message})
+}
+
+// Limits returns the resource limits currently applied to the process
+func (p *process) Limits() Limits {
+	p.status.Mutex.Lock()
+	defer p.status.Mutex.Unlock()
+	return p.config.Limits
+}
+
+// History returns the events of the job in chronological order
+func (p *process) History() []Event {
+	p.status.Mutex.Lock()
+	defer p.status.Mutex.Unlock()
+	return append([]Event(nil), p.history...)
+}
+
+// terminationCause tells why the process terminated. The kernel does not tell who sent a SIGKILL nor why a child
+// exited, so the process is OOMKilled when the cgroup reports an OOM kill and Stop did not terminate it:
+// memory.oom.group makes the OOM killer terminate the whole job, pid 1 included, rather than a single process.
+func terminationCause(state *os.ProcessState, final *Stats, stopped bool) Cause {
+	if !stopped && final != nil && (final.MemoryEvents.OOMKill > 0 || final.MemoryEvents.OOMGroupKill > 0) {
+		return OOMKilled
+	}
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return Exited
+	}
+	return Signaled
+}
+
 // Error returns and error if child process terminated unsuccessfully, nil otherwise
 func (p *process) Error() error {
 	return p.Status().err
@@ -126,6 +408,7 @@ func (p *process) Stop() {
 	if p.Status().State == Completed || p.Status().State == Failed {
 		return
 	}
+	p.stopped.Store(true)
 	p.execCmd.Cancel()
 
 	// NewTicker duration must be a positive number
@@ -141,11 +424,37 @@ func (p *process) Stop() {
 	}
 }
 
+// Stdout returns a reader of the output of the process, the output of a queued process is empty until it starts
 func (p *process) Stdout() (io.ReadCloser, error) {
-	if p.started == 0 {
-		return nil, fmt.Errorf("job not started yet")
+	// The output is created by Start holding the status lock
+	p.status.Mutex.Lock()
+	output := p.outputFile
+	p.status.Mutex.Unlock()
+	if output == nil && atomic.LoadInt32(&p.started) == 0 {
+		return nil, fmt.Errorf("job %d has not started yet", p.ID)
+	} else if output == nil {
+		return nil, fmt.Errorf("job %d has no output: %v", p.ID, p.Error())
+	}
+	return os.OpenFile(output.Name(), os.O_RDONLY, 0660)
+}
+
+// Stdin returns the writer delivering input to the process terminal
+func (p *process) Stdin() (io.Writer, error) {
+	if p.config.TTY && p.Status().State == Queued {
+		return nil, fmt.Errorf("job %d has not started yet", p.ID)
+	}
+	if p.terminal == nil {
+		return nil, fmt.Errorf("job %d has no terminal", p.ID)
 	}
-	return os.OpenFile(p.outputFile.Name(), os.O_RDONLY, 0660)
+	return p.terminal, nil
+}
+
+// Resize changes the window size of the process terminal
+func (p *process) Resize(rows, cols uint16) error {
+	if p.terminal == nil {
+		return fmt.Errorf("job %d has no terminal", p.ID)
+	}
+	return pty.SetSize(p.terminal, rows, cols)
 }
 
 func (p *process) Status() Status {
@@ -159,16 +468,67 @@ func (p *process) Done() <-chan struct{} {
 	return p.done
 }
 
-func (p *process) execute(ctx context.Context) (*exec.Cmd, error) {
-	path, pathErr := exec.LookPath(p.config.Cmd)
-	if pathErr != nil {
-		return nil, pathErr
+// execute starts the helper of the process, on error the helper is killed and the pipes are closed
+// while Start removes the cgroup.
+func (p *process) execute(ctx context.Context) (_ *exec.Cmd, err error) {
+	if p.config.TTY && p.config.Stdin != nil {
+		return nil, fmt.Errorf("stdin can not be used together with a terminal")
+	}
+	for _, a := range p.config.Artifacts {
+		if _, err := checkSandboxPath(a); err != nil {
+			return nil, fmt.Errorf("invalid artifact path: %w", err)
+		}
+	}
+
+	for _, m := range p.config.Mounts {
+		if err := checkMount(m); err != nil {
+			return nil, err
+		}
+	}
+	tmpfs, err := sandboxTmpfs(p.config.Tmpfs)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.config.layers) > 0 {
+		if err := p.createOverlayDir(); err != nil {
+			return nil, fmt.Errorf("error creating root filesystem: %w", err)
+		}
+	}
+
+	// The helper looks the command up once it has pivoted into the root filesystem
+	path := p.config.Cmd
+	if p.config.RootFS == "" {
+		var pathErr error
+		if path, pathErr = exec.LookPath(p.config.Cmd); pathErr != nil {
+			return nil, pathErr
+		}
+	} else if err := checkRootFS(p.config.RootFS); err != nil {
+		return nil, err
 	}
 
 	cmd := exec.CommandContext(ctx, "/proc/self/exe")
-	stdout, openErr := os.CreateTemp("", "*")
-	if openErr != nil {
-		return nil, openErr
+	var stdinReader, stdinWriter, childSock *os.File
+	defer func() {
+		if err == nil {
+			return
+		}
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+			cmd.Process.Wait()
+		}
+		for _, f := range []*os.File{stdinReader, stdinWriter, childSock} {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	// A queued process has its output already
+	stdout := p.outputFile
+	if stdout == nil {
+		var openErr error
+		if stdout, openErr = os.CreateTemp("", "*"); openErr != nil {
+			return nil, openErr
+		}
 	}
 
 	// We replace Cancel to use SIGTERM instead of the default behavior
@@ -177,12 +537,22 @@ func (p *process) execute(ctx context.Context) (*exec.Cmd, error) {
 		return cmd.Process.Signal(syscall.SIGTERM)
 	}
 
-	cgroupFD, cgroupPath, _ := p.setupCgroup()
+	cgroupFD, cgroupPath, err := p.setupCgroup()
+	if err != nil {
+		if cgroupPath != "" {
+			_ = rmCgroup(cgroupPath)
+		}
+		return nil, fmt.Errorf("error creating cgroup: %w", err)
+	}
+	if cgroupFD > 0 {
+		// The child joins the cgroup at clone, the descriptor is not needed afterwards
+		defer unix.Close(cgroupFD)
+	}
 	p.cgroupPath = cgroupPath
 	p.outputFile = stdout
 	cmd.Stdout = stdout
 	cmd.Stderr = stdout
-	cmd.SysProcAttr = mount.NewSysProcAttr(cgroupFD)
+	cmd.SysProcAttr = mount.NewSysProcAttr(cgroupFD, mountIDMaps(p.config.userns.UIDs), mountIDMaps(p.config.userns.GIDs))
 	cmd.Env = generateEnv(path, p.config.Args)
 
 	// We set an arbitrary deadline if the child ignores SIGTERM
@@ -190,10 +560,276 @@ func (p *process) execute(ctx context.Context) (*exec.Cmd, error) {
 
 	// Append PATH so that we don't need full paths for common executables
 	cmd.Env = append(cmd.Env, "PATH="+environment["PATH"])
+	for _, e := range p.config.Env {
+		// The variables of the helper can not be overridden, the later ones win
+		if !strings.HasPrefix(e, jesEnvPrefix) {
+			cmd.Env = append(cmd.Env, e)
+		}
+	}
+
+	if p.config.Stdin != nil {
+		var err error
+		if stdinReader, stdinWriter, err = os.Pipe(); err != nil {
+			return nil, err
+		}
+		cmd.Stdin = stdinReader
+	}
+
+	// The socket synchronizes the helper with the Executor and carries the terminal
+	parentSock, childSock, err := socketPair()
+	if err != nil {
+		return nil, err
+	}
+	defer parentSock.Close()
+	// The helper finds the socket at fd 3
+	cmd.ExtraFiles = []*os.File{childSock}
+	if p.config.TTY {
+		cmd.Env = append(cmd.Env, jesTTYEnvVar+"=true")
+	}
+	if p.config.RootFS != "" {
+		cmd.Env = append(cmd.Env, jesRootFSEnvVar+"="+p.config.RootFS)
+	}
+	if p.overlayDir != "" && !p.mapsOverlay() {
+		cmd.Env = append(cmd.Env,
+			jesOverlayLowerEnvVar+"="+strings.Join(p.config.layers, ":"),
+			jesOverlayUpperEnvVar+"="+filepath.Join(p.overlayDir, "upper"),
+			jesOverlayWorkEnvVar+"="+filepath.Join(p.overlayDir, "work"),
+		)
+		if p.config.userns.enabled() {
+			cmd.Env = append(cmd.Env, jesOverlayUserXattrEnvVar+"=true")
+		}
+	}
+	if p.config.WorkingDir != "" {
+		cmd.Env = append(cmd.Env, jesWorkDirEnvVar+"="+p.config.WorkingDir)
+	}
+	if len(p.config.Mounts) > 0 {
+		binds := make([]mount.Bind, 0, len(p.config.Mounts))
+		for _, m := range p.config.Mounts {
+			binds = append(binds, mount.Bind{Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly, Propagation: m.Propagation.String()})
+		}
+		b, err := json.Marshal(binds)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, jesMountsEnvVar+"="+string(b))
+	}
+	b, err := json.Marshal(tmpfs)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = append(cmd.Env, jesTmpfsEnvVar+"="+string(b))
+	if p.config.Hardened {
+		cmd.Env = append(cmd.Env, jesHardenedEnvVar+"=true")
+	}
 
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
+	// Closing our copy of the child socket makes RecvFD fail if the helper exits early
+	childSock.Close()
+	childSock = nil
+	if stdinReader != nil {
+		stdinReader.Close()
+		stdinReader = nil
+	}
+
+	if stdinWriter != nil {
+		go p.copyStdin(stdinWriter)
+	}
+
+	// The helper waits for this reference before setting up the sandbox, so that the sandbox
+	// mounts can be reached by CopyIn, CopyOut and artifacts even after a fast exit.
+	if p.mntNS, err = openMountNamespace(cmd.Process.Pid); err != nil {
+		return nil, fmt.Errorf("error opening job mount namespace: %w", err)
+	}
+	if p.overlayDir != "" && p.mapsOverlay() {
+		if err := p.mountMappedOverlay(cmd.Process.Pid); err != nil {
+			return nil, fmt.Errorf("error creating root filesystem: %w", err)
+		}
+	}
+	if _, err := parentSock.Write([]byte{0}); err != nil {
+		return nil, fmt.Errorf("error synchronizing with helper: %w", err)
+	}
+
+	if p.config.TTY {
+		terminal, err := pty.RecvFD(parentSock, "pty-master")
+		if err != nil {
+			return nil, fmt.Errorf("error receiving terminal from helper: %w", err)
+		}
+		p.terminal = terminal
+		p.terminalDone = make(chan struct{})
+		go func() {
+			io.Copy(stdout, terminal)
+			close(p.terminalDone)
+		}()
+	}
 
 	return cmd, nil
 }
+
+// createOverlayDir creates the directory holding the writable layer of the job in jobsDir,
+// the helper mounts the overlay on its rootfs directory which becomes RootFS
+func (p *process) createOverlayDir() error {
+	if err := os.MkdirAll(p.config.jobsDir, 0700); err != nil {
+		return err
+	}
+	dir := filepath.Join(p.config.jobsDir, fmt.Sprintf("%s-%d", p.config.cgroupPrefix, p.ID))
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return err
+	}
+	p.overlayDir = dir
+	dirs := []string{"upper", "work", "rootfs"}
+	if p.mapsOverlay() {
+		dirs = append(dirs, "lower")
+		for i := range p.config.layers {
+			dirs = append(dirs, filepath.Join("lower", strconv.Itoa(i)))
+		}
+	}
+	for _, d := range dirs {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+	}
+	if p.mapsOverlay() {
+		// The writable layer is owned by the root of the sandbox on disk: the files it holds, set-user-ID
+		// ones included, are owned by the host ids of the sandbox. The directory remains private to the
+		// root of the sandbox which searches it to reach rootfs, see makeSearchable.
+		uid, gid, err := p.config.userns.root()
+		if err != nil {
+			return err
+		}
+		for _, d := range []string{"", "upper", "work"} {
+			if err := os.Chown(filepath.Join(dir, d), uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	p.config.RootFS = filepath.Join(dir, "rootfs")
+	return nil
+}
+
+// mapsOverlay tells if the layers of the overlay are idmapped: the files of an image are owned by root on
+// disk, which is not mapped in the user namespace of a job of an Executor started as root. The layers
+// unpacked by an Executor not started as root are owned by its uid which is already root in the sandbox.
+func (p *process) mapsOverlay() bool {
+	return p.config.userns.enabled() && os.Geteuid() == 0
+}
+
+// mountMappedOverlay mounts the overlay of the job on its rootfs directory in the mount namespace of the
+// helper pid before the helper builds the sandbox. The read only layers are idmapped through the user namespace
+// of the helper so that the root of the sandbox owns the files owned by root on disk. The writable layer is not
+// idmapped, it is owned by the root of the sandbox like the files it creates. The Executor mounts the overlay
+// as its attributes like the opaque directories of the layers are only readable in the initial user namespace.
+func (p *process) mountMappedOverlay(pid int) error {
+	mapped := make([]*os.File, 0, len(p.config.layers))
+	defer func() {
+		for _, m := range mapped {
+			m.Close()
+		}
+	}()
+	for _, layer := range p.config.layers {
+		m, err := mount.OpenIDMapped(layer, pid)
+		if err != nil {
+			return err
+		}
+		mapped = append(mapped, m)
+	}
+	return inMountNamespace(p.mntNS, func() error {
+		lower := make([]string, 0, len(p.config.layers))
+		for i, m := range mapped {
+			lower = append(lower, filepath.Join(p.overlayDir, "lower", strconv.Itoa(i)))
+			if err := mount.AttachMount(m, lower[i]); err != nil {
+				return err
+			}
+		}
+		// overlayfs works on the layers with the credentials of its mounter, the owner of the writable layer
+		if err := p.actAsSandboxRoot(); err != nil {
+			return err
+		}
+		upper, work := filepath.Join(p.overlayDir, "upper"), filepath.Join(p.overlayDir, "work")
+		return mount.MountOverlay(p.config.RootFS, lower, upper, work, false)
+	})
+}
+
+// checkMount verifies the source and the target of m are absolute paths, the root directory can not be a target
+func checkMount(m Mount) error {
+	if !filepath.IsAbs(m.Source) {
+		return fmt.Errorf("mount source %s is not an absolute path", m.Source)
+	}
+	if !filepath.IsAbs(m.Target) || filepath.Clean(m.Target) == "/" {
+		return fmt.Errorf("invalid mount target %s", m.Target)
+	}
+	if _, found := propagationMap[m.Propagation]; !found {
+		return fmt.Errorf("invalid propagation for %s", m.Target)
+	}
+	return nil
+}
+
+// sandboxTmpfs checks the tmpfs of a process and converts them for the helper, a /tmp of DefaultTmpSizeMB
+// is added when none is declared so that the private /tmp of the sandbox can not use up the memory of the host
+func sandboxTmpfs(tmpfs []Tmpfs) ([]mount.Tmpfs, error) {
+	converted := make([]mount.Tmpfs, 0, len(tmpfs)+1)
+	targets := map[string]struct{}{}
+	for _, t := range tmpfs {
+		if !filepath.IsAbs(t.Target) || filepath.Clean(t.Target) == "/" {
+			return nil, fmt.Errorf("invalid tmpfs target %s", t.Target)
+		}
+		target := filepath.Clean(t.Target)
+		if _, found := targets[target]; found {
+			return nil, fmt.Errorf("tmpfs target %s is declared twice", target)
+		}
+		targets[target] = struct{}{}
+		if t.Mode > 07777 {
+			return nil, fmt.Errorf("invalid mode %o for tmpfs %s", t.Mode, target)
+		}
+		if t.SizeMB > maxTmpSizeMB {
+			return nil, fmt.Errorf("the size of tmpfs %s exceeds the maximum of %dMB", target, maxTmpSizeMB)
+		}
+		size := t.SizeMB
+		if size == 0 {
+			size = DefaultTmpSizeMB
+		}
+		converted = append(converted, mount.Tmpfs{Target: target, Size: size << 20, Mode: t.Mode, NoExec: t.NoExec, NoSuid: t.NoSuid})
+	}
+	if _, found := targets["/tmp"]; !found {
+		converted = append(converted, mount.Tmpfs{Target: "/tmp", Size: DefaultTmpSizeMB << 20, NoSuid: true})
+	}
+	// A parent sorts before the paths under it so that its mount does not hide them
+	sort.Slice(converted, func(i, j int) bool { return converted[i].Target < converted[j].Target })
+	return converted, nil
+}
+
+// checkRootFS verifies root is an absolute path to a directory
+func checkRootFS(root string) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("root filesystem %s is not an absolute path", root)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("invalid root filesystem: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("root filesystem %s is not a directory", root)
+	}
+	return nil
+}
+
+// copyStdin writes Stdin to the process pipe until EOF or until the process closes its end
+func (p *process) copyStdin(w *os.File) {
+	io.Copy(w, p.config.Stdin)
+	w.Close()
+	if c, ok := p.config.Stdin.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// socketPair returns both ends of a unix socket
+func socketPair() (*os.File, *os.File, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating socket pair: %w", err)
+	}
+	unix.CloseOnExec(fds[0])
+	unix.CloseOnExec(fds[1])
+	return os.NewFile(uintptr(fds[0]), "parent-sock"), os.NewFile(uintptr(fds[1]), "child-sock"), nil
+}
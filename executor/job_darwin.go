@@ -2,10 +2,18 @@
 
 package executor
 
+import "fmt"
+
 func (p *process) setupCgroup() (int, string, error) {
 	return 0, "", nil
 }
 
+func updateCgroup(_ string, _, _ ProcessConfig) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
 func rmCgroup(_ string) error {
 	return nil
 }
+
+func (p *process) watchMemoryEvents() {}
@@ -3,22 +3,24 @@
 package executor
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
+	log "log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
-const cgroupPath = "/sys/fs/cgroup"
-
-var maxCPUTime = uint(100000)
-
 // setupCgroup can create create only children to the current cgroup
 func (p *process) setupCgroup() (int, string, error) {
-	return writeCgroup(p.ID, p.config, cgroupPath)
+	root := p.config.cgroupRoot
+	if root == "" {
+		root = defaultCgroupRoot
+	}
+	return writeCgroup(p.ID, p.config, root)
 }
 
 // writeCgroup builds and configures are new Cgroup for the Process (pid)
@@ -37,25 +39,207 @@ func writeCgroup(pid uint64, c ProcessConfig, basePath string) (fd int, cgroupPa
 
 	// We need unix.Open to get a FD in int format.
 	// Also seems syscall is being deprecated too
-	fd, err = unix.Open(cgroupPath, unix.O_PATH, 0)
+	if fd, err = unix.Open(cgroupPath, unix.O_PATH|unix.O_CLOEXEC, 0); err != nil {
+		return
+	}
 
-	if c.CPUPercent > 0 {
-		cpuMaxFile := []byte(fmt.Sprintf("%d %d", maxCPUTime/100*c.CPUPercent, maxCPUTime))
-		if err = os.WriteFile(cgroupPath+"/cpu.max", cpuMaxFile, 0664); err != nil {
+	for _, ctrl := range controllers {
+		if err = writeFiles(cgroupPath, ctrl.files(c, nil)); err != nil {
+			unix.Close(fd)
 			return
 		}
 	}
-
-	if c.MemoryMB > 0 {
-		memFile := []byte(fmt.Sprintf("%d\n", c.MemoryMB*1024*1024))
-		if err = os.WriteFile(cgroupPath+"/memory.max", memFile, 0664); err != nil {
+	// The OOM killer terminates the whole job rather than one of its processes, see terminationCause.
+	// The file is missing when the memory controller is not enabled.
+	if _, statErr := os.Stat(filepath.Join(cgroupPath, "memory.oom.group")); statErr == nil {
+		if err = writeFiles(cgroupPath, []cgroupFile{{"memory.oom.group", []string{"1"}}}); err != nil {
+			unix.Close(fd)
 			return
 		}
-		if err = os.WriteFile(cgroupPath+"/memory.high", memFile, 0664); err != nil {
-			return
+	}
+	return
+}
+
+// cgroupFile is the content of a cgroup interface file, the kernel parses a single line per write
+type cgroupFile struct {
+	name  string
+	lines []string
+}
+
+// controllers lists the files of each cgroup controller, when previous is nil only the limits set
+// in c are returned. On update the limits set in previous are returned too so that unset limits
+// are written with the kernel default removing the previous value.
+var controllers = []struct {
+	name  string
+	files func(c ProcessConfig, previous *ProcessConfig) []cgroupFile
+}{
+	{"cpu", cpuFiles},
+	{"cpuset", cpusetFiles},
+	{"memory", memoryFiles},
+	{"io", ioFiles},
+	{"pids", pidsFiles},
+}
+
+// updateCgroup rewrites the limits of the cgroup at cgroupPath from previous to c one controller at a time,
+// if a controller can not be updated the controllers already written are restored to previous.
+func updateCgroup(cgroupPath string, previous, c ProcessConfig) error {
+	for i, ctrl := range controllers {
+		if err := writeFiles(cgroupPath, ctrl.files(c, &previous)); err != nil {
+			// The failed controller may have been partially written
+			for _, restore := range controllers[:i+1] {
+				if restoreErr := writeFiles(cgroupPath, restore.files(previous, &c)); restoreErr != nil {
+					log.Warn("error restoring cgroup limits", "cgroup", cgroupPath, "controller", restore.name, "error", restoreErr)
+				}
+			}
+			return fmt.Errorf("error updating the %s controller: %w", ctrl.name, err)
+		}
+	}
+	return nil
+}
+
+func writeFiles(cgroupPath string, files []cgroupFile) error {
+	for _, file := range files {
+		f, err := os.OpenFile(filepath.Join(cgroupPath, file.name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+		if err != nil {
+			return err
+		}
+		for _, line := range file.lines {
+			if _, err := f.WriteString(line + "\n"); err != nil {
+				f.Close()
+				return fmt.Errorf("error writing \"%s\" to %s: %w", line, file.name, err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitValue formats v as the content of a cgroup file, 0 is written as the default value def
+func limitValue(v uint64, def string) string {
+	if v == 0 {
+		return def
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func cpuFiles(c ProcessConfig, previous *ProcessConfig) []cgroupFile {
+	var files []cgroupFile
+	prev := previousLimits(previous)
+	quota, period := cpuMax(c.Limits)
+	if previousQuota, _ := cpuMax(prev); quota > 0 || previousQuota > 0 {
+		files = append(files, cgroupFile{"cpu.max", []string{fmt.Sprintf("%s %d", limitValue(uint64(quota), "max"), period)}})
+	}
+	if c.CPUBurstUsec > 0 || prev.CPUBurstUsec > 0 {
+		files = append(files, cgroupFile{"cpu.max.burst", []string{limitValue(uint64(c.CPUBurstUsec), "0")}})
+	}
+	if c.CPUWeight > 0 || prev.CPUWeight > 0 {
+		files = append(files, cgroupFile{"cpu.weight", []string{limitValue(uint64(c.CPUWeight), "100")}})
+	}
+	return files
+}
+
+func cpusetFiles(c ProcessConfig, previous *ProcessConfig) []cgroupFile {
+	var files []cgroupFile
+	prev := previousLimits(previous)
+	// An empty cpuset uses the CPUs and memory nodes of the parent
+	if c.CpusetCpus != "" || prev.CpusetCpus != "" {
+		files = append(files, cgroupFile{"cpuset.cpus", []string{c.CpusetCpus}})
+	}
+	if c.CpusetMems != "" || prev.CpusetMems != "" {
+		files = append(files, cgroupFile{"cpuset.mems", []string{c.CpusetMems}})
+	}
+	return files
+}
+
+// memoryHighMB returns memory.high in MB which defaults to memory.max
+func memoryHighMB(l Limits) uint {
+	if l.MemoryHighMB == 0 {
+		return l.MemoryMB
+	}
+	return l.MemoryHighMB
+}
+
+// memorySwap returns memory.swap.max in bytes and true if swap is limited
+func memorySwap(l Limits) (uint64, bool) {
+	if l.NoSwap {
+		return 0, true
+	}
+	return uint64(l.MemorySwapMB) * 1024 * 1024, l.MemorySwapMB > 0
+}
+
+func memoryFiles(c ProcessConfig, previous *ProcessConfig) []cgroupFile {
+	var files []cgroupFile
+	prev := previousLimits(previous)
+	limits := []struct {
+		name string
+		mb   func(Limits) uint
+		def  string
+	}{
+		{"memory.min", func(l Limits) uint { return l.MemoryMinMB }, "0"},
+		{"memory.low", func(l Limits) uint { return l.MemoryLowMB }, "0"},
+		{"memory.high", memoryHighMB, "max"},
+		{"memory.max", func(l Limits) uint { return l.MemoryMB }, "max"},
+	}
+	for _, limit := range limits {
+		mb := limit.mb(c.Limits)
+		if mb > 0 || limit.mb(prev) > 0 {
+			files = append(files, cgroupFile{limit.name, []string{limitValue(uint64(mb)*1024*1024, limit.def)}})
 		}
 	}
 
+	swap, limited := memorySwap(c.Limits)
+	if _, previouslyLimited := memorySwap(prev); limited {
+		files = append(files, cgroupFile{"memory.swap.max", []string{strconv.FormatUint(swap, 10)}})
+	} else if previouslyLimited {
+		files = append(files, cgroupFile{"memory.swap.max", []string{"max"}})
+	}
+	return files
+}
+
+// previousLimits returns the limits of previous or no limits if previous is nil
+func previousLimits(previous *ProcessConfig) Limits {
+	if previous == nil {
+		return Limits{}
+	}
+	return previous.Limits
+}
+
+func ioFiles(c ProcessConfig, previous *ProcessConfig) []cgroupFile {
+	var files []cgroupFile
+	if c.IOWeight > 0 || previousLimits(previous).IOWeight > 0 {
+		files = append(files, cgroupFile{"io.weight", []string{"default " + limitValue(uint64(c.IOWeight), "100")}})
+	}
+
+	var lines []string
+	devices := ioDeviceLimits(c)
+	for _, d := range devices {
+		if line := ioMaxLine(d, previous != nil); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if previous != nil {
+		// Devices not limited anymore are reset
+	removed:
+		for _, d := range ioDeviceLimits(*previous) {
+			for _, current := range devices {
+				if current.major == d.major && current.minor == d.minor {
+					continue removed
+				}
+			}
+			lines = append(lines, ioMaxLine(IODeviceLimit{major: d.major, minor: d.minor}, true))
+		}
+	}
+	if len(lines) > 0 {
+		files = append(files, cgroupFile{"io.max", lines})
+	}
+	return files
+}
+
+// ioDeviceLimits returns the io.max limits of c, a rule for the root device overrides ReadBPS and WriteBPS
+func ioDeviceLimits(c ProcessConfig) []IODeviceLimit {
+	var devices []IODeviceLimit
 	// Minimum acceptable value is 2
 	// write the file only if there at least one bounded value
 	// Tested:
@@ -64,27 +248,106 @@ func writeCgroup(pid uint64, c ProcessConfig, basePath string) (fd int, cgroupPa
 	// [root@ip-172-31-20-250 0]# echo "202:0 rbps=2" >io.max
 	// [root@ip-172-31-20-250 0]#
 	if c.deviceMajor > 1 && (c.ReadBPS >= 2 || c.WriteBPS >= 2) {
-		// CGroup does not accept partitions so we only use the major for block devices.
-		// There would be the need of supporting other types of devices depending on where
-		// the workload is scheduled
-		stringBuffer := bytes.NewBufferString(fmt.Sprintf("%d:%d", c.deviceMajor, 0))
+		// CGroup does not accept partitions, the Executor resolves the root device to its disk
+		root := IODeviceLimit{major: c.deviceMajor, minor: c.deviceMinor}
 		if c.ReadBPS > 1 {
-			stringBuffer.WriteString(" ")
-			stringBuffer.WriteString("rbps=")
-			stringBuffer.WriteString(strconv.Itoa(int(c.ReadBPS)))
+			root.ReadBPS = c.ReadBPS
 		}
 		if c.WriteBPS > 1 {
-			stringBuffer.WriteString(" ")
-			stringBuffer.WriteString("wbps=")
-			stringBuffer.WriteString(strconv.Itoa(int(c.WriteBPS)))
+			root.WriteBPS = c.WriteBPS
 		}
-		if err = os.WriteFile(cgroupPath+"/io.max", stringBuffer.Bytes(), 0600); err != nil {
-			return
+		devices = append(devices, root)
+	}
+	for _, d := range c.IODevices {
+		if len(devices) > 0 && devices[0].major == d.major && devices[0].minor == d.minor {
+			devices[0] = d
+			continue
 		}
+		devices = append(devices, d)
 	}
-	return
+	return devices
+}
+
+// ioMaxLine formats the io.max line of a device limit, an empty string is returned if no limit is set.
+// If reset is true the limits not set are written as max.
+func ioMaxLine(d IODeviceLimit, reset bool) string {
+	keys := []struct {
+		name  string
+		value uint
+	}{{"rbps", d.ReadBPS}, {"wbps", d.WriteBPS}, {"riops", d.ReadIOPS}, {"wiops", d.WriteIOPS}}
+	line := fmt.Sprintf("%d:%d", d.major, d.minor)
+	limited := false
+	for _, k := range keys {
+		if k.value > 0 || reset {
+			line += fmt.Sprintf(" %s=%s", k.name, limitValue(uint64(k.value), "max"))
+			limited = true
+		}
+	}
+	if !limited {
+		return ""
+	}
+	return line
+}
+
+func pidsFiles(c ProcessConfig, previous *ProcessConfig) []cgroupFile {
+	if c.PidsMax > 0 || previousLimits(previous).PidsMax > 0 {
+		return []cgroupFile{{"pids.max", []string{limitValue(uint64(c.PidsMax), "max")}}}
+	}
+	return nil
 }
 
 func rmCgroup(path string) error {
 	return unix.Rmdir(path)
 }
+
+// watchMemoryEvents logs the memory events of the process cgroup as they happen until the process terminates,
+// the kernel generates a modify event on memory.events every time a counter changes.
+func (p *process) watchMemoryEvents() {
+	if p.cgroupPath == "" {
+		return
+	}
+	eventsFile := filepath.Join(p.cgroupPath, "memory.events")
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		log.Warn("error watching memory events", "job", p.ID, "error", err)
+		return
+	}
+	if _, err := unix.InotifyAddWatch(fd, eventsFile, unix.IN_MODIFY); err != nil {
+		unix.Close(fd)
+		// memory.events does not exist if the memory controller is not enabled
+		if !errors.Is(err, unix.ENOENT) {
+			log.Warn("error watching memory events", "job", p.ID, "error", err)
+		}
+		return
+	}
+	// A non blocking file is handled by the runtime poller so Close unblocks Read
+	watcher := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-p.done
+		watcher.Close()
+	}()
+
+	var last MemoryEvents
+	buf := make([]byte, 4096)
+	for {
+		if _, err := watcher.Read(buf); err != nil {
+			return
+		}
+		b, err := os.ReadFile(eventsFile)
+		if err != nil {
+			// The cgroup has been removed
+			return
+		}
+		events, err := parseMemoryEvents(b)
+		if err != nil {
+			log.Warn("error reading memory events", "job", p.ID, "error", err)
+			return
+		}
+		if events.OOMKill > last.OOMKill {
+			log.Warn("process killed by the OOM killer", "job", p.ID, "oomKills", events.OOMKill)
+		} else if events.OOM > last.OOM {
+			log.Warn("job reached its memory limit", "job", p.ID, "oom", events.OOM)
+		}
+		last = events
+	}
+}
@@ -3,19 +3,36 @@
 package executor
 
 import (
+	"archive/tar"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestCGroupCreation(t *testing.T) {
 	config := ProcessConfig{
-		CPUPercent:  10,
 		deviceMajor: 200,
-		MemoryMB:    10,
-		ReadBPS:     10,
-		WriteBPS:    10,
+		Limits: Limits{
+			CPUPercent:   10,
+			CPUWeight:    50,
+			CpusetCpus:   "0-1",
+			CpusetMems:   "0",
+			MemoryMB:     10,
+			MemoryLowMB:  2,
+			MemoryMinMB:  1,
+			MemorySwapMB: 4,
+			IOWeight:     200,
+			ReadBPS:      10,
+			WriteBPS:     10,
+			PidsMax:      64,
+		},
 	}
 
 	files := []struct {
@@ -29,6 +46,16 @@ func TestCGroupCreation(t *testing.T) {
 		config: config,
 		file:   "cpu.max",
 		output: "10000 100000",
+	}, {
+		name:   "WriteCpuMaxMillicores",
+		config: ProcessConfig{Limits: Limits{CPUMillis: 1500, CPUPeriodUsec: 50000}},
+		file:   "cpu.max",
+		output: "75000 50000",
+	}, {
+		name:   "WriteCpuMaxBurst",
+		config: ProcessConfig{Limits: Limits{CPUMillis: 500, CPUBurstUsec: 20000}},
+		file:   "cpu.max.burst",
+		output: "20000",
 	}, {
 		name:   "WriteMemoryHih",
 		config: config,
@@ -39,6 +66,56 @@ func TestCGroupCreation(t *testing.T) {
 		config: config,
 		file:   "memory.max",
 		output: "10485760",
+	}, {
+		name:   "WriteMemoryHighSeparately",
+		config: ProcessConfig{Limits: Limits{MemoryMB: 10, MemoryHighMB: 8}},
+		file:   "memory.high",
+		output: "8388608",
+	}, {
+		name:   "WriteMemoryLow",
+		config: config,
+		file:   "memory.low",
+		output: "2097152",
+	}, {
+		name:   "WriteMemoryMin",
+		config: config,
+		file:   "memory.min",
+		output: "1048576",
+	}, {
+		name:   "WriteMemorySwapMax",
+		config: config,
+		file:   "memory.swap.max",
+		output: "4194304",
+	}, {
+		name:   "DisableSwap",
+		config: ProcessConfig{Limits: Limits{MemorySwapMB: 4, NoSwap: true}},
+		file:   "memory.swap.max",
+		output: "0",
+	}, {
+		name:   "WriteCpuWeight",
+		config: config,
+		file:   "cpu.weight",
+		output: "50",
+	}, {
+		name:   "WriteCpusetCpus",
+		config: config,
+		file:   "cpuset.cpus",
+		output: "0-1",
+	}, {
+		name:   "WriteCpusetMems",
+		config: config,
+		file:   "cpuset.mems",
+		output: "0",
+	}, {
+		name:   "WriteIOWeight",
+		config: config,
+		file:   "io.weight",
+		output: "default 200",
+	}, {
+		name:   "WritePidsMax",
+		config: config,
+		file:   "pids.max",
+		output: "64",
 	}, {
 		name:   "WriteIOMax",
 		config: config,
@@ -46,12 +123,21 @@ func TestCGroupCreation(t *testing.T) {
 		output: "200:0 rbps=10 wbps=10",
 	}, {
 		name:   "EnforceIOLowerBound",
-		config: ProcessConfig{deviceMajor: 200, ReadBPS: 1, WriteBPS: 2},
+		config: ProcessConfig{deviceMajor: 200, Limits: Limits{ReadBPS: 1, WriteBPS: 2}},
 		file:   "io.max",
 		output: "200:0 wbps=2",
+	}, {
+		name: "WriteIOMaxPerDevice",
+		config: ProcessConfig{Limits: Limits{IODevices: []IODeviceLimit{
+			{major: 8, minor: 16, ReadBPS: 4096, WriteIOPS: 100},
+			{major: 8, minor: 32, ReadIOPS: 10, WriteBPS: 2},
+			{major: 8, minor: 48},
+		}}},
+		file:   "io.max",
+		output: "8:16 rbps=4096 wiops=100\n8:32 wbps=2 riops=10",
 	}, {
 		name:   "LimitIOLowerBound",
-		config: ProcessConfig{MemoryMB: 5},
+		config: ProcessConfig{Limits: Limits{MemoryMB: 5}},
 		file:   "memory.high",
 		// This is a shortcut, for tests that do not intend to modify the file
 		// i'd read the original file content and verify it hasn't mutated.
@@ -84,3 +170,504 @@ func TestCGroupCreation(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateCgroup(t *testing.T) {
+	previous := ProcessConfig{deviceMajor: 200, Limits: Limits{
+		CPUPercent: 10,
+		CpusetCpus: "0",
+		MemoryMB:   10,
+		ReadBPS:    10,
+		IODevices:  []IODeviceLimit{{major: 8, minor: 16, WriteIOPS: 100}},
+		PidsMax:    64,
+	}}
+	updated := ProcessConfig{deviceMajor: 200, Limits: Limits{
+		CPUMillis: 1500,
+		MemoryMB:  20,
+		NoSwap:    true,
+		IODevices: []IODeviceLimit{{major: 8, minor: 32, ReadBPS: 4096}},
+	}}
+	_, cgroupDir, err := writeCgroup(0, previous, t.TempDir())
+	if err != nil {
+		t.Fatal("writeCgroup return error: ", err.Error())
+	}
+	if err := updateCgroup(cgroupDir, previous, updated); err != nil {
+		t.Fatal("updateCgroup return error: ", err.Error())
+	}
+
+	files := map[string]string{
+		"cpu.max":         "150000 100000",
+		"cpuset.cpus":     "",
+		"memory.high":     "20971520",
+		"memory.max":      "20971520",
+		"memory.swap.max": "0",
+		"io.max":          "8:32 rbps=4096 wbps=max riops=max wiops=max\n200:0 rbps=max wbps=max riops=max wiops=max\n8:16 rbps=max wbps=max riops=max wiops=max",
+		"pids.max":        "max",
+	}
+	for file, expected := range files {
+		output, err := os.ReadFile(cgroupDir + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trimmed := strings.Trim(string(output), " \n"); trimmed != expected {
+			t.Fatalf("expected \"%s\" in %s but received \"%s\"", expected, file, trimmed)
+		}
+	}
+}
+
+func TestUpdateLimits(t *testing.T) {
+	job := newProcess(1, ProcessConfig{Cmd: "sleep", Args: []string{"0.5"}})
+	if err := job.Start(); err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if err := job.UpdateLimits(Limits{}); err != nil {
+		t.Fatalf("update returned error: %v", err)
+	}
+	<-job.Done()
+	if err := job.UpdateLimits(Limits{}); err == nil {
+		t.Fatalf("update of a terminated job should fail")
+	}
+	if job.Status().Accounting == nil {
+		t.Fatalf("the accounting was not read before removing the cgroup")
+	}
+
+	history := job.History()
+	expected := []EventType{Started, LimitsUpdated, Terminated}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %d events but %d were found: %v", len(expected), len(history), history)
+	}
+	for i, e := range history {
+		if e.Type != expected[i] {
+			t.Fatalf("expected event %s but %s was found", expected[i], e.Type)
+		}
+	}
+}
+
+func TestUpdateCgroupRollback(t *testing.T) {
+	previous := ProcessConfig{Limits: Limits{CPUPercent: 10, MemoryMB: 10}}
+	updated := ProcessConfig{Limits: Limits{CPUPercent: 20, MemoryMB: 20, PidsMax: 10}}
+	_, cgroupDir, err := writeCgroup(0, previous, t.TempDir())
+	if err != nil {
+		t.Fatal("writeCgroup return error: ", err.Error())
+	}
+	// pids.max can't be written making the update fail after the cpu and memory controllers
+	if err := os.Mkdir(cgroupDir+"/pids.max", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateCgroup(cgroupDir, previous, updated); err == nil {
+		t.Fatal("updateCgroup should fail")
+	}
+	for file, expected := range map[string]string{"cpu.max": "10000 100000", "memory.max": "10485760"} {
+		output, err := os.ReadFile(cgroupDir + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trimmed := strings.Trim(string(output), " \n"); trimmed != expected {
+			t.Fatalf("expected \"%s\" in %s to be restored but received \"%s\"", expected, file, trimmed)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	script := "while [ ! -f /tmp/in/data ]; do sleep 0.1; done; cp /tmp/in/data /tmp/out"
+	job := newProcess(1, ProcessConfig{Cmd: "bash", Args: []string{"-c", "mkdir /tmp/in; ln -s /etc /tmp/etc; " + script}, Artifacts: []string{"/tmp/out", "/tmp/missing"}})
+	if err := job.Start(); err != nil {
+		t.Fatalf("can't start job: %v", err)
+	}
+	defer os.Remove(job.outputFile.Name())
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "data", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+	tw.Write([]byte("hello"))
+	tw.Close()
+	// The job may not have created /tmp/in yet
+	for i := 0; ; i++ {
+		err := job.copyIn("/tmp/in", bytes.NewReader(buf.Bytes()))
+		if err == nil {
+			break
+		} else if i == 20 {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	<-job.Done()
+
+	// The sandbox is retained after termination
+	out := &bytes.Buffer{}
+	if err := job.copyOut("/tmp/out", out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name, content := readSingleEntry(t, out); name != "out" || content != "hello" {
+		t.Fatalf("expected out with hello but %s with '%s' was found", name, content)
+	}
+
+	artifacts, err := job.artifacts()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer artifacts.Close()
+	if name, content := readSingleEntry(t, artifacts); name != "out" || content != "hello" {
+		t.Fatalf("expected out with hello but %s with '%s' was found", name, content)
+	}
+
+	if err := job.copyOut("/etc/passwd", io.Discard); err == nil {
+		t.Fatal("error was expected copying a path outside the sandbox")
+	}
+	if err := job.copyOut("/tmp/etc/passwd", io.Discard); err == nil {
+		t.Fatal("error was expected copying a path through a symbolic link")
+	}
+	if err := job.copyIn("/tmp/etc", bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("error was expected copying into a symbolic link")
+	}
+	job.releaseSandbox()
+	if err := job.copyOut("/tmp/out", io.Discard); err == nil {
+		t.Fatal("error was expected after releasing the sandbox")
+	}
+	saved := job.artifactsFile
+	job.removeArtifacts()
+	if _, err := os.Stat(saved); !os.IsNotExist(err) {
+		t.Fatalf("expected the artifacts to be removed: %v", err)
+	}
+	if _, err := job.artifacts(); err == nil {
+		t.Fatal("error was expected after removing the artifacts")
+	}
+}
+
+func readSingleEntry(t *testing.T, r io.Reader) (string, string) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Fatalf("a single entry was expected")
+	}
+	return header.Name, string(content)
+}
+
+func TestRootFS(t *testing.T) {
+	root := t.TempDir()
+	copyBinary(t, root, "/bin/sh")
+	if err := os.WriteFile(root+"/marker", []byte("rootfs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The helper runs the shell of the new root: only the marker, the shell and its libraries are reachable
+	script := "read m < /marker && [ $m = rootfs ] && [ ! -e /root/module ] && [ -r /proc/self/stat ] && [ -e /dev/null ] && echo ok > /tmp/out && echo $m"
+	job := newProcess(1, ProcessConfig{Cmd: "sh", Args: []string{"-c", script}, RootFS: root, Artifacts: []string{"/tmp/out"}})
+	if err := job.Start(); err != nil {
+		t.Fatalf("can't start job: %v", err)
+	}
+	defer os.Remove(job.outputFile.Name())
+	<-job.Done()
+
+	output, err := os.ReadFile(job.outputFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status().State != Completed || string(output) != "rootfs\n" {
+		t.Fatalf("expected the job to complete in the root filesystem but %s with '%s' was found", job.Status().State, output)
+	}
+	// The sandbox paths are reached inside the root filesystem
+	out := &bytes.Buffer{}
+	if err := job.copyOut("/tmp/out", out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if name, content := readSingleEntry(t, out); name != "out" || content != "ok\n" {
+		t.Fatalf("expected out with ok but %s with '%s' was found", name, content)
+	}
+	if old, _ := filepath.Glob(root + "/.oldroot*"); len(old) > 0 {
+		t.Fatalf("expected the previous root mount point to be removed but %s was found", old)
+	}
+
+	job = newProcess(2, ProcessConfig{Cmd: "sh", RootFS: root + "/marker"})
+	if err := job.Start(); err == nil {
+		t.Fatal("error was expected with a root filesystem that is not a directory")
+	}
+}
+
+func TestBindMounts(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(source+"/data", []byte("host\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := hostDir(t, "mount-")
+	root := t.TempDir()
+	copyBinary(t, root, "/bin/sh")
+
+	for i, c := range []struct {
+		config   ProcessConfig
+		expected string
+		created  bool
+	}{
+		// A read only mount can be read but not written
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "read d < " + target + "/data; echo $d; (echo x > " + target + "/new) 2>/dev/null || echo denied"},
+			Mounts: []Mount{{Source: source, Target: target, ReadOnly: true}}}, "host\ndenied\n", false},
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "echo x > " + target + "/new && echo written"},
+			Mounts: []Mount{{Source: source, Target: target, Propagation: PropagationRSlave}}}, "written\n", true},
+		// The target is created in the root filesystem
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "read d < /mnt/source/data; echo $d"}, RootFS: root,
+			Mounts: []Mount{{Source: source, Target: "/mnt/source", ReadOnly: true}}}, "host\n", true},
+	} {
+		os.Remove(source + "/new")
+		job := newProcess(uint64(i), c.config)
+		if output := runJob(t, job); output != c.expected {
+			t.Fatalf("expected '%s' from job %d but '%s' was found", c.expected, i, output)
+		}
+		if _, err := os.Stat(source + "/new"); (err == nil) != c.created && c.config.RootFS == "" {
+			t.Fatalf("expected the file written by job %d to be on the host: %t", i, c.created)
+		}
+	}
+	// The mount is only visible in the sandbox
+	if _, err := os.Stat(target + "/data"); err == nil {
+		t.Fatal("expected the mount not to be visible on the host")
+	}
+
+	job := newProcess(3, ProcessConfig{Cmd: "sh", Mounts: []Mount{{Source: source, Target: "relative"}}})
+	if err := job.Start(); err == nil {
+		t.Fatal("error was expected with a relative target")
+	}
+}
+
+func TestSandboxFilesystems(t *testing.T) {
+	root := t.TempDir()
+	copyBinary(t, root, "/bin/sh")
+	script := `for f in /dev/*; do echo $f; done
+for f in /proc/kcore /proc/keys /proc/timer_list; do [ -e $f ] && [ ! -c $f ] && echo $f visible; done
+for f in /sys/firmware/*; do echo $f; done
+[ -w /proc/sysrq-trigger ] || echo sysrq read-only
+[ -w /sys/kernel ] || echo sys read-only
+(echo x > /dev/full) 2>/dev/null || echo full`
+	expected := `/dev/fd
+/dev/full
+/dev/null
+/dev/ptmx
+/dev/pts
+/dev/random
+/dev/shm
+/dev/stderr
+/dev/stdin
+/dev/stdout
+/dev/tty
+/dev/urandom
+/dev/zero
+/sys/firmware/*
+sysrq read-only
+sys read-only
+full
+`
+	// The sandbox is the same on the host root filesystem and in a root filesystem of its own
+	for i, rootFS := range []string{"", root} {
+		job := newProcess(uint64(i), ProcessConfig{Cmd: "sh", Args: []string{"-c", script}, RootFS: rootFS})
+		if output := runJob(t, job); output != expected {
+			t.Fatalf("expected '%s' from job %d but '%s' was found", expected, i, output)
+		}
+	}
+}
+
+func TestTmpfs(t *testing.T) {
+	target := hostDir(t, "tmpfs-")
+
+	for i, c := range []struct {
+		config   ProcessConfig
+		expected string
+	}{
+		// /tmp has a default size
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "grep -o ' /tmp .*size=[0-9]*k' /proc/self/mountinfo | grep -o 'size=.*'"}},
+			fmt.Sprintf("size=%dk\n", DefaultTmpSizeMB<<10)},
+		// Writes beyond the size fail with ENOSPC
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "head -c 2097152 /dev/zero > /tmp/file 2>&1 || echo full; wc -c < /tmp/file"},
+			Tmpfs: []Tmpfs{{Target: "/tmp", SizeMB: 1}}}, "full\n1048576\n"},
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "cp /bin/true " + target + "; " + target + "/true 2>/dev/null || echo denied; stat -c %a " + target},
+			Tmpfs: []Tmpfs{{Target: target, Mode: 0700, NoExec: true}}}, "denied\n700\n"},
+	} {
+		job := newProcess(uint64(i), c.config)
+		if output := runJob(t, job); output != c.expected {
+			t.Fatalf("expected '%s' from job %d but '%s' was found", c.expected, i, output)
+		}
+	}
+
+	for _, tmpfs := range [][]Tmpfs{{{Target: "relative"}}, {{Target: "/"}}, {{Target: "/run"}, {Target: "/run/"}}, {{Target: "/run", Mode: 010000}}, {{Target: "/run", SizeMB: 1 << 44}}} {
+		job := newProcess(3, ProcessConfig{Cmd: "sh", Tmpfs: tmpfs})
+		if err := job.Start(); err == nil {
+			t.Fatalf("error was expected with tmpfs %+v", tmpfs)
+		}
+	}
+}
+
+func TestHardened(t *testing.T) {
+	source := t.TempDir()
+	dir := hostDir(t, "hardened-")
+	target := dir + "/mount"
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	copyBinary(t, root, "/bin/sh")
+
+	for i, c := range []struct {
+		config   ProcessConfig
+		expected string
+	}{
+		// The host root filesystem is read only, the declared paths are writable but not executable
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", `(echo x > ` + dir + `/file) 2>/dev/null || echo root read-only
+cp /bin/true /tmp/true && /tmp/true 2>/dev/null || echo tmp noexec
+cp /bin/true ` + target + `/true && ` + target + `/true 2>/dev/null || echo mount noexec
+echo x > /dev/shm/file && echo shm writable
+mount -o remount,rw / 2>/dev/null || echo remount denied
+grep NoNewPrivs /proc/self/status`},
+			Mounts: []Mount{{Source: source, Target: target}}, Hardened: true},
+			"root read-only\ntmp noexec\nmount noexec\nshm writable\nremount denied\nNoNewPrivs:\t1\n"},
+		// The missing working directory is created before the root filesystem is read only
+		{ProcessConfig{Cmd: "sh", Args: []string{"-c", "(echo x > /file) 2>/dev/null || echo root read-only; echo x > /run/file && echo run writable; pwd"},
+			RootFS: root, WorkingDir: "/srv", Tmpfs: []Tmpfs{{Target: "/run"}}, Hardened: true}, "root read-only\nrun writable\n/srv\n"},
+	} {
+		job := newProcess(uint64(i), c.config)
+		if output := runJob(t, job); output != c.expected {
+			t.Fatalf("expected '%s' from job %d but '%s' was found", c.expected, i, output)
+		}
+	}
+	if _, err := os.Stat(source + "/true"); err != nil {
+		t.Fatalf("expected the file written to the mount to be on the host: %v", err)
+	}
+}
+
+// openByHandle prints whether open_by_handle_at, which bypasses the mounts and the permissions of the directories,
+// can open the directory given as argument
+const openByHandle = `import ctypes, errno, os, sys
+libc = ctypes.CDLL(None, use_errno=True)
+class Handle(ctypes.Structure):
+    _fields_ = [("size", ctypes.c_uint), ("type", ctypes.c_int), ("data", ctypes.c_ubyte * 128)]
+handle, mount_id = Handle(size=128), ctypes.c_int()
+if libc.name_to_handle_at(-100, sys.argv[1].encode(), ctypes.byref(handle), ctypes.byref(mount_id), 0) != 0:
+    sys.exit("name_to_handle_at: " + os.strerror(ctypes.get_errno()))
+fd = libc.open_by_handle_at(os.open(sys.argv[1], os.O_RDONLY), ctypes.byref(handle), os.O_RDONLY)
+print("open_by_handle_at", "denied" if fd < 0 and ctypes.get_errno() == errno.EPERM else "allowed")
+`
+
+func TestHardenedOpenByHandle(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is required to call open_by_handle_at")
+	}
+	source := t.TempDir()
+	dir := hostDir(t, "handle-")
+
+	for _, c := range []struct {
+		hardened bool
+		expected string
+	}{
+		{false, "open_by_handle_at allowed\n"},
+		{true, "open_by_handle_at denied\n"},
+	} {
+		job := newProcess(1, ProcessConfig{Cmd: "python3", Args: []string{"-c", openByHandle, dir},
+			Mounts: []Mount{{Source: source, Target: dir}}, Hardened: c.hardened})
+		if output := runJob(t, job); output != c.expected {
+			t.Fatalf("expected '%s' with hardened %t but '%s' was found", c.expected, c.hardened, output)
+		}
+	}
+}
+
+// hostDir creates a directory of the host reachable from the sandbox: its private /tmp hides t.TempDir()
+func hostDir(t *testing.T, prefix string) string {
+	dir, err := os.MkdirTemp(".", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if dir, err = filepath.Abs(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// runJob starts job, waits for it to terminate and returns its output
+func runJob(t *testing.T, job *process) string {
+	if err := job.Start(); err != nil {
+		t.Fatalf("can't start job: %v", err)
+	}
+	<-job.Done()
+	defer os.Remove(job.outputFile.Name())
+	output, err := os.ReadFile(job.outputFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+// copyBinary copies the executable at path and the shared libraries it loads into root
+func copyBinary(t *testing.T, root, path string) {
+	libraries, err := exec.Command("ldd", path).Output()
+	if err != nil {
+		t.Skipf("can't list the libraries of %s: %v", path, err)
+	}
+	files := []string{path}
+	for _, field := range strings.Fields(string(libraries)) {
+		if strings.HasPrefix(field, "/") {
+			files = append(files, field)
+		}
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, file), b, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUserNamespace(t *testing.T) {
+	userns := UserNamespace{UIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}, GIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}}
+	reader, writer := io.Pipe()
+	job := newProcess(0, ProcessConfig{Cmd: "sh", Args: []string{"-c", `read a b c < /proc/self/uid_map; echo $a $b $c
+echo $(id -u):$(id -g)
+(echo x > /file) 2>/dev/null || echo host read-only
+read x
+stat -c %u:%g /tmp/data`}, Stdin: reader, userns: userns})
+	if err := job.Start(); err != nil {
+		t.Fatalf("can't start job: %v", err)
+	}
+	defer os.Remove(job.outputFile.Name())
+	// The root of the sandbox is the first subordinate id on the host
+	info, err := os.Stat(fmt.Sprintf("/proc/%d", job.Status().Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := info.Sys().(*syscall.Stat_t).Uid; uid != 100000 {
+		t.Fatalf("expected the job to run as 100000 on the host but %d was found", uid)
+	}
+	// The files copied in the sandbox are owned by its root, the private /tmp is mounted once the job writes
+	for i := 0; ; i++ {
+		if output, _ := os.ReadFile(job.outputFile.Name()); strings.Contains(string(output), "read-only") {
+			break
+		} else if i == 20 {
+			t.Fatalf("the job did not start: %s", output)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "data", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+	tw.Write([]byte("hello"))
+	tw.Close()
+	err = job.copyIn("/tmp", buf)
+	writer.Close()
+	if err != nil {
+		t.Fatalf("copy returned error: %v", err)
+	}
+	<-job.Done()
+	output, err := os.ReadFile(job.outputFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "0 100000 65536\n0:0\nhost read-only\n0:0\n"; string(output) != expected {
+		t.Fatalf("expected '%s' but '%s' was found", expected, output)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"testing"
 )
 
@@ -65,6 +66,55 @@ func TestJobExecution(t *testing.T) {
 	}
 }
 
+func TestTerminationCause(t *testing.T) {
+	oom := &Stats{MemoryEvents: MemoryEvents{OOM: 1, OOMKill: 1}}
+	causeTests := []struct {
+		name    string
+		script  string
+		final   *Stats
+		stopped bool
+		cause   Cause
+	}{
+		{"Exited", "exit 3", &Stats{}, false, Exited},
+		{"Signaled", "kill -TERM $$", &Stats{}, false, Signaled},
+		{"Killed", "kill -KILL $$", &Stats{}, false, Signaled},
+		{"OOMKilled", "kill -KILL $$", oom, false, OOMKilled},
+		{"GroupOOMKilled", "kill -KILL $$", &Stats{MemoryEvents: MemoryEvents{OOMGroupKill: 1}}, false, OOMKilled},
+		// pid 1 exits once a child is OOM killed if the whole job is not
+		{"ChildOOMKilled", "exit 1", oom, false, OOMKilled},
+		{"StoppedAfterOOMKill", "kill -KILL $$", oom, true, Signaled},
+		{"NoStats", "kill -KILL $$", nil, false, Signaled},
+	}
+	for _, test := range causeTests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", test.script)
+			_ = cmd.Run()
+			if cause := terminationCause(cmd.ProcessState, test.final, test.stopped); cause != test.cause {
+				t.Fatalf("cause should be %s but %s found", test.cause, cause)
+			}
+		})
+	}
+}
+
+func TestResolveIODevices(t *testing.T) {
+	if _, err := resolveIODevices([]IODeviceLimit{{Device: "/", ReadBPS: 1}}); err == nil {
+		t.Fatalf("error was expected for a bps limit lower than 2")
+	}
+	if _, err := resolveIODevices([]IODeviceLimit{{Device: "/does/not/exist", ReadBPS: 1024}}); err == nil {
+		t.Fatalf("error was expected for a missing device")
+	}
+}
+
+func TestDescribeLimitChanges(t *testing.T) {
+	description := describeLimitChanges(Limits{CPUPercent: 10, MemoryMB: 512}, Limits{CPUPercent: 10, MemoryMB: 1024, PidsMax: 64})
+	if description != "MemoryMB 512 -> 1024, PidsMax 0 -> 64" {
+		t.Fatalf("unexpected description \"%s\"", description)
+	}
+	if description := describeLimitChanges(Limits{}, Limits{}); description != "no changes" {
+		t.Fatalf("unexpected description \"%s\"", description)
+	}
+}
+
 func TestJobStop(t *testing.T) {
 	// bash's sleep ignores SIGTERM so it's necessary to use "sleep & wait"
 	script := `"trap 'echo trapped the TERM signal;sleep 1; exit 1;
@@ -119,3 +169,59 @@ func TestStdout(t *testing.T) {
 	}
 
 }
+
+func TestTerminal(t *testing.T) {
+	job := newProcess(1, ProcessConfig{Cmd: "bash", Args: []string{"-c", "read line; tty; echo got $line"}, TTY: true})
+	if err := job.Start(); err != nil {
+		t.Fatalf("can't start job: %v", err)
+	}
+	defer os.Remove(job.outputFile.Name())
+
+	stdin, err := job.Stdin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Resize(24, 80); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	<-job.Done()
+
+	output, err := os.ReadFile(job.outputFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(output, []byte("/dev/pts/")) || !bytes.Contains(output, []byte("got hello")) {
+		t.Fatalf("expected a terminal and the input echoed but found '%s'", output)
+	}
+
+	noTTY := newProcess(2, ProcessConfig{Cmd: "true"})
+	if _, err := noTTY.Stdin(); err == nil {
+		t.Fatal("error was expected for a job without terminal")
+	}
+}
+
+func TestStdin(t *testing.T) {
+	input := bytes.Repeat([]byte("x"), 1024*1024)
+	job := newProcess(1, ProcessConfig{Cmd: "wc", Args: []string{"-c"}, Stdin: bytes.NewReader(input)})
+	if err := job.Start(); err != nil {
+		t.Fatalf("can't start job: %v", err)
+	}
+	defer os.Remove(job.outputFile.Name())
+	<-job.Done()
+
+	output, err := os.ReadFile(job.outputFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes.TrimSpace(output)) != fmt.Sprint(len(input)) {
+		t.Fatalf("expected %d bytes read but found '%s'", len(input), output)
+	}
+
+	conflict := newProcess(2, ProcessConfig{Cmd: "cat", Stdin: bytes.NewReader(input), TTY: true})
+	if err := conflict.Start(); err == nil {
+		t.Fatal("error was expected when using stdin with a terminal")
+	}
+}
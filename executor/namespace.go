@@ -1,18 +1,38 @@
 package executor
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 
 	"minidocker/internal/mount"
+	"minidocker/internal/pty"
 )
 
+// jesEnvPrefix is the prefix of the variables configuring the helper
+const jesEnvPrefix = "JES_"
 const jesArgPrefix = "JES_ARG_"
 const jesArgCountEnvVar = "JES_ARGC"
 const jesChildEnvVar = "JES_CHILD"
 const jesCmdEnvVar = "JES_CMD"
+const jesTTYEnvVar = "JES_TTY"
+const jesRootFSEnvVar = "JES_ROOTFS"
+const jesWorkDirEnvVar = "JES_WORKDIR"
+const jesOverlayLowerEnvVar = "JES_OVERLAY_LOWER"
+const jesOverlayUpperEnvVar = "JES_OVERLAY_UPPER"
+const jesOverlayWorkEnvVar = "JES_OVERLAY_WORK"
+const jesOverlayUserXattrEnvVar = "JES_OVERLAY_USERXATTR"
+const jesMountsEnvVar = "JES_MOUNTS"
+const jesTmpfsEnvVar = "JES_TMPFS"
+const jesHardenedEnvVar = "JES_HARDENED"
+
+// jesSocketFD is the file descriptor of the socket shared with the Executor, see exec.Cmd.ExtraFiles
+const jesSocketFD = 3
 
 // createSandbox runs in the helper child and creates mount points before executing the Process
 func createSandbox() error {
@@ -23,18 +43,102 @@ func createSandbox() error {
 		return fmt.Errorf("jes sandbox: error parsing environment: %w", envErr)
 	}
 
-	// Mount proc to reduce visibility of other PIDs
-	if err := mount.HideMounts(); err != nil {
-		return fmt.Errorf("jes sandbox: failed to mount proc fs: %w", err)
+	// Wait for the Executor to hold a reference to our mount namespace
+	sock := os.NewFile(jesSocketFD, "child-sock")
+	if _, err := sock.Read(make([]byte, 1)); err != nil {
+		return fmt.Errorf("jes sandbox: error synchronizing with executor: %w", err)
+	}
+
+	var binds []mount.Bind
+	if m := environment[jesMountsEnvVar]; m != "" {
+		if err := json.Unmarshal([]byte(m), &binds); err != nil {
+			return fmt.Errorf("jes sandbox: error parsing mounts: %w", err)
+		}
+	}
+	var tmpfs []mount.Tmpfs
+	if t := environment[jesTmpfsEnvVar]; t != "" {
+		if err := json.Unmarshal([]byte(t), &tmpfs); err != nil {
+			return fmt.Errorf("jes sandbox: error parsing tmpfs: %w", err)
+		}
+	}
+
+	if root := environment[jesRootFSEnvVar]; root != "" {
+		if lower := environment[jesOverlayLowerEnvVar]; lower != "" {
+			// The layers of the image are stacked under the writable layer of the job
+			err := mount.MountOverlay(root, strings.Split(lower, ":"), environment[jesOverlayUpperEnvVar], environment[jesOverlayWorkEnvVar],
+				environment[jesOverlayUserXattrEnvVar] == "true")
+			if err != nil {
+				return fmt.Errorf("jes sandbox: %w", err)
+			}
+		}
+		if err := mount.PivotRoot(root, binds, tmpfs); err != nil {
+			return fmt.Errorf("jes sandbox: error changing root filesystem: %w", err)
+		}
+		// The command is resolved in the new root filesystem
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			return fmt.Errorf("jes sandbox: %w", err)
+		}
+		args[0] = path
+	} else if err := mount.HideMounts(binds, tmpfs); err != nil {
+		// Mount proc to reduce visibility of other PIDs
+		return fmt.Errorf("jes sandbox: failed to mount sandbox filesystems: %w", err)
+	}
+
+	// The terminal is allocated once /dev is mounted so that it belongs to the devpts instance of the sandbox
+	if environment[jesTTYEnvVar] == "true" {
+		if err := setupTerminal(sock); err != nil {
+			return fmt.Errorf("jes sandbox: error setting up terminal: %w", err)
+		}
+	}
+	// The socket must not leak into the job
+	sock.Close()
+
+	if dir := environment[jesWorkDirEnvVar]; dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("jes sandbox: error creating working directory: %w", err)
+		}
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("jes sandbox: error changing working directory: %w", err)
+		}
+	}
+
+	// The working directory is created first as it may be missing from the root filesystem
+	if environment[jesHardenedEnvVar] == "true" {
+		if err := mount.ReadOnlyRoot(binds, tmpfs); err != nil {
+			return fmt.Errorf("jes sandbox: %w", err)
+		}
+		// The capabilities are those of the thread, it must be the one executing the command
+		runtime.LockOSThread()
+		if err := mount.DropCapabilities(); err != nil {
+			return fmt.Errorf("jes sandbox: %w", err)
+		}
 	}
 
 	// Exec allows us to retain PID 1 so that the output of `ps` looks cooler
-	if err := syscall.Exec(args[0], args, os.Environ()); err != nil {
+	if err := syscall.Exec(args[0], args, jobEnv(os.Environ())); err != nil {
 		return fmt.Errorf("jes sandbox: error executing command %s, with %s", args[0], args[1:])
 	}
 	return nil
 }
 
+// setupTerminal allocates a pseudo-terminal, sends the master side to the Executor through sock
+// and makes the slave side the controlling terminal and standard streams of the helper.
+func setupTerminal(sock *os.File) error {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	defer slave.Close()
+
+	sendErr := pty.SendFD(sock, master)
+	master.Close()
+	if sendErr != nil {
+		return fmt.Errorf("error sending terminal: %w", sendErr)
+	}
+	return pty.SetStdio(slave)
+}
+
 // buildExecArgs retrieves the executable parameters from ENV
 // and executes a slice of Args compliant with syscall.Exec()
 func buildExecArgs(e map[string]string) (args []string, err error) {
@@ -1,6 +1,9 @@
 package executor
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func TestIsHelper(t *testing.T) {
 	tests := []struct {
@@ -57,3 +60,10 @@ func TestBuildExecArgsShould(t *testing.T) {
 		})
 	}
 }
+
+func TestJobEnv(t *testing.T) {
+	env := []string{"PATH=/bin", jesRootFSEnvVar + "=/var/lib/minidocker/layers", jesOverlayUpperEnvVar + "=/upper", "HOME=/root", jesArgPrefix + "0=arg"}
+	if filtered := jobEnv(env); !slices.Equal(filtered, []string{"PATH=/bin", "HOME=/root"}) {
+		t.Fatalf("expected the helper variables to be removed but %v was found", filtered)
+	}
+}
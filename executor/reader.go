@@ -14,8 +14,8 @@ type pollingReader struct {
 // Read will read n bytes into b buffer and return EOF only when Process p has terminated
 func (r *pollingReader) Read(b []byte) (n int, err error) {
 	n, err = r.reader.Read(b)
-	// Ignore EOF in this case the process is still running
-	if n == 0 && err == io.EOF && r.p.Status().State == Running {
+	// Ignore EOF in this case the process is still running or waits to be started
+	if state := r.p.Status().State; n == 0 && err == io.EOF && (state == Running || state == Queued) {
 		err = nil
 		if n == 0 {
 			<-time.After(250 * time.Millisecond)
@@ -0,0 +1,17 @@
+//go:build darwin
+
+package executor
+
+import (
+	"fmt"
+	"os"
+)
+
+// openMountNamespace returns no namespace for non-linux builds, copies are not supported
+func openMountNamespace(_ int) (*os.File, error) {
+	return nil, nil
+}
+
+func inMountNamespace(_ *os.File, _ func() error) error {
+	return fmt.Errorf("not supported on darwin")
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// openMountNamespace returns a reference to the mount namespace of pid, holding it keeps the
+// namespace and its mounts alive after the last process of the sandbox has exited
+func openMountNamespace(pid int) (*os.File, error) {
+	return os.Open(fmt.Sprintf("/proc/%d/ns/mnt", pid))
+}
+
+// inMountNamespace runs f in a thread joined to the mount namespace ns, f must not
+// start goroutines accessing the filesystem as they would run in the Executor namespace.
+func inMountNamespace(ns *os.File, f func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked so that the runtime terminates it when the goroutine returns,
+		// its filesystem attributes no longer match the ones of the other threads.
+		runtime.LockOSThread()
+		// setns(CLONE_NEWNS) is refused to threads sharing their filesystem attributes
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			errc <- fmt.Errorf("error unsharing filesystem attributes: %w", err)
+			return
+		}
+		if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNS); err != nil {
+			errc <- fmt.Errorf("error joining mount namespace: %w", err)
+			return
+		}
+		errc <- f()
+	}()
+	return <-errc
+}
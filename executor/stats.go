@@ -0,0 +1,359 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats represents the resources used by a process as accounted by its cgroup,
+// values are zero when the controller is not enabled or the kernel does not expose them.
+type Stats struct {
+	// Time is when the statistics were read
+	Time time.Time
+	// CPUUsageUsec is the total CPU time consumed in microseconds (cpu.stat)
+	CPUUsageUsec uint64
+	// CPUUserUsec is the CPU time consumed in user mode in microseconds (cpu.stat)
+	CPUUserUsec uint64
+	// CPUSystemUsec is the CPU time consumed in kernel mode in microseconds (cpu.stat)
+	CPUSystemUsec uint64
+	// NrPeriods is the number of enforcement periods elapsed (cpu.stat)
+	NrPeriods uint64
+	// NrThrottled is the number of periods the process was throttled (cpu.stat)
+	NrThrottled uint64
+	// ThrottledUsec is the time the process was throttled in microseconds (cpu.stat)
+	ThrottledUsec uint64
+	// MemoryCurrent is the memory currently used in bytes (memory.current)
+	MemoryCurrent uint64
+	// MemoryPeak is the maximum memory used in bytes (memory.peak)
+	MemoryPeak uint64
+	// MemoryMax is the memory limit in bytes, 0 means unlimited (memory.max)
+	MemoryMax uint64
+	// MemoryEvents counts the memory limit events (memory.events)
+	MemoryEvents MemoryEvents
+	// IO reports the IO per block device (io.stat)
+	IO []IOStat
+	// PidsCurrent is the number of processes and threads (pids.current)
+	PidsCurrent uint64
+	// PidsPeak is the maximum number of processes and threads (pids.peak)
+	PidsPeak uint64
+	// Pressure reports the time the process stalled waiting for resources (cpu.pressure, memory.pressure, io.pressure)
+	Pressure ResourcePressure
+}
+
+// Accounting is the resource usage of a terminated process, it is read from
+// the cgroup right before it is removed
+type Accounting struct {
+	// CPUUserUsec is the CPU time consumed in user mode in microseconds
+	CPUUserUsec uint64
+	// CPUSystemUsec is the CPU time consumed in kernel mode in microseconds
+	CPUSystemUsec uint64
+	// MemoryPeak is the maximum memory used in bytes
+	MemoryPeak uint64
+	// IO reports the bytes and operations per block device
+	IO []IOStat
+	// PidsPeak is the maximum number of processes and threads
+	PidsPeak uint64
+}
+
+func newAccounting(s *Stats) *Accounting {
+	return &Accounting{
+		CPUUserUsec:   s.CPUUserUsec,
+		CPUSystemUsec: s.CPUSystemUsec,
+		MemoryPeak:    s.MemoryPeak,
+		IO:            s.IO,
+		PidsPeak:      s.PidsPeak,
+	}
+}
+
+// ResourcePressure groups the pressure stall information of the resources of a cgroup
+type ResourcePressure struct {
+	CPU    Pressure
+	Memory Pressure
+	IO     Pressure
+}
+
+// Pressure reports the share of time tasks stalled on a resource
+type Pressure struct {
+	// Some accounts the time at least one task stalled
+	Some PressureValues
+	// Full accounts the time all non-idle tasks stalled at once
+	Full PressureValues
+}
+
+// PressureValues are the percentages of stalled time averaged over 10, 60 and 300 seconds
+// and the total stalled time
+type PressureValues struct {
+	Avg10     float64
+	Avg60     float64
+	Avg300    float64
+	TotalUsec uint64
+}
+
+// MemoryEvents counts how many times the memory boundaries were hit
+type MemoryEvents struct {
+	Low     uint64
+	High    uint64
+	Max     uint64
+	OOM     uint64
+	OOMKill uint64
+	// OOMGroupKill counts the OOM kills of the whole cgroup, see memory.oom.group
+	OOMGroupKill uint64
+}
+
+// IOStat represents the IO on a block device
+type IOStat struct {
+	Major      uint
+	Minor      uint
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+}
+
+// readStats reads the statistics files of the cgroup at path
+func readStats(path string) (*Stats, error) {
+	stats := &Stats{Time: time.Now()}
+
+	cpu, err := readFlatKeyed(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.CPUUsageUsec = cpu["usage_usec"]
+	stats.CPUUserUsec = cpu["user_usec"]
+	stats.CPUSystemUsec = cpu["system_usec"]
+	stats.NrPeriods = cpu["nr_periods"]
+	stats.NrThrottled = cpu["nr_throttled"]
+	stats.ThrottledUsec = cpu["throttled_usec"]
+
+	if stats.MemoryCurrent, err = readSingleValue(filepath.Join(path, "memory.current")); err != nil {
+		return nil, err
+	}
+	if stats.MemoryPeak, err = readSingleValue(filepath.Join(path, "memory.peak")); err != nil {
+		return nil, err
+	}
+	if stats.MemoryMax, err = readSingleValue(filepath.Join(path, "memory.max")); err != nil {
+		return nil, err
+	}
+
+	events, err := readOptional(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return nil, err
+	}
+	if stats.MemoryEvents, err = parseMemoryEvents(events); err != nil {
+		return nil, err
+	}
+
+	ioStat, err := readOptional(filepath.Join(path, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+	if stats.IO, err = parseIOStat(ioStat); err != nil {
+		return nil, err
+	}
+
+	if stats.PidsCurrent, err = readSingleValue(filepath.Join(path, "pids.current")); err != nil {
+		return nil, err
+	}
+	if stats.PidsPeak, err = readSingleValue(filepath.Join(path, "pids.peak")); err != nil {
+		return nil, err
+	}
+	if stats.Pressure, err = readPressure(path); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// readPressure reads the pressure files of the cgroup at path, missing files are reported as no pressure
+func readPressure(path string) (ResourcePressure, error) {
+	var pressure ResourcePressure
+	for _, r := range []struct {
+		file     string
+		pressure *Pressure
+	}{
+		{"cpu.pressure", &pressure.CPU},
+		{"memory.pressure", &pressure.Memory},
+		{"io.pressure", &pressure.IO},
+	} {
+		b, err := readOptional(filepath.Join(path, r.file))
+		if err != nil {
+			return pressure, err
+		}
+		if *r.pressure, err = parsePressure(b); err != nil {
+			return pressure, fmt.Errorf("error parsing %s: %w", r.file, err)
+		}
+	}
+	return pressure, nil
+}
+
+// readOptional returns the content of file or nil if it does not exist
+func readOptional(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func readFlatKeyed(file string) (map[string]uint64, error) {
+	b, err := readOptional(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseFlatKeyed(b)
+}
+
+func readSingleValue(file string) (uint64, error) {
+	b, err := readOptional(file)
+	if err != nil {
+		return 0, err
+	}
+	return parseSingleValue(b)
+}
+
+// parseFlatKeyed parses the "key value" lines of cgroup files like cpu.stat
+func parseFlatKeyed(b []byte) (map[string]uint64, error) {
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid flat keyed line \"%s\"", scanner.Text())
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", fields[0], err)
+		}
+		values[fields[0]] = v
+	}
+	return values, nil
+}
+
+// parseMemoryEvents parses memory.events
+func parseMemoryEvents(b []byte) (MemoryEvents, error) {
+	events, err := parseFlatKeyed(b)
+	if err != nil {
+		return MemoryEvents{}, err
+	}
+	return MemoryEvents{
+		Low:          events["low"],
+		High:         events["high"],
+		Max:          events["max"],
+		OOM:          events["oom"],
+		OOMKill:      events["oom_kill"],
+		OOMGroupKill: events["oom_group_kill"],
+	}, nil
+}
+
+// parsePressure parses the "some avg10=0.00 avg60=0.00 avg300=0.00 total=0" lines of pressure files
+func parsePressure(b []byte) (Pressure, error) {
+	var pressure Pressure
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var values *PressureValues
+		switch fields[0] {
+		case "some":
+			values = &pressure.Some
+		case "full":
+			values = &pressure.Full
+		default:
+			return Pressure{}, fmt.Errorf("invalid pressure line \"%s\"", scanner.Text())
+		}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				return Pressure{}, fmt.Errorf("invalid pressure field \"%s\"", field)
+			}
+			var err error
+			switch key {
+			case "avg10":
+				values.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				values.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				values.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				values.TotalUsec, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return Pressure{}, fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+		}
+	}
+	return pressure, nil
+}
+
+// parseSingleValue parses cgroup files holding a single number, "max" and empty files are reported as 0
+func parseSingleValue(b []byte) (uint64, error) {
+	s := strings.TrimSpace(string(b))
+	if s == "" || s == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// parseIOStat parses the "maj:min key=value..." lines of io.stat
+func parseIOStat(b []byte) ([]IOStat, error) {
+	var devices []IOStat
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var device IOStat
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &device.Major, &device.Minor); err != nil {
+			return nil, fmt.Errorf("invalid device \"%s\" in io.stat: %w", fields[0], err)
+		}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				return nil, fmt.Errorf("invalid field \"%s\" in io.stat", field)
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s in io.stat: %w", key, err)
+			}
+			switch key {
+			case "rbytes":
+				device.ReadBytes = v
+			case "wbytes":
+				device.WriteBytes = v
+			case "rios":
+				device.ReadOps = v
+			case "wios":
+				device.WriteOps = v
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// stats returns the resources used by the process, statistics are only available
+// while the process runs as the cgroup is removed at termination.
+func (p *process) stats() (*Stats, error) {
+	p.status.Mutex.Lock()
+	defer p.status.Mutex.Unlock()
+	if p.status.State != Running {
+		return nil, fmt.Errorf("job %d is not running", p.ID)
+	}
+	if p.cgroupPath == "" {
+		return nil, fmt.Errorf("job %d has no cgroup", p.ID)
+	}
+	return readStats(p.cgroupPath)
+}
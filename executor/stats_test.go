@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadStats(t *testing.T) {
+	files := map[string]string{
+		"cpu.stat": "usage_usec 2000\nuser_usec 1500\nsystem_usec 500\n" +
+			"nr_periods 10\nnr_throttled 2\nthrottled_usec 300\n",
+		"memory.current": "4096\n",
+		"memory.max":     "max\n",
+		"memory.events":  "low 0\nhigh 3\nmax 1\noom 1\noom_kill 1\noom_group_kill 1\n",
+		"io.stat":        "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0\n253:0 rbytes=10 wbytes=20 rios=3 wios=4\n",
+		"pids.current":   "3\n",
+		"pids.peak":      "5\n",
+		"cpu.pressure":   "some avg10=12.50 avg60=3.00 avg300=1.00 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// memory.peak is missing as on kernels older than 5.19
+	stats, err := readStats(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if stats.CPUUsageUsec != 2000 || stats.CPUUserUsec != 1500 || stats.CPUSystemUsec != 500 {
+		t.Fatalf("unexpected cpu usage %+v", stats)
+	}
+	if stats.NrPeriods != 10 || stats.NrThrottled != 2 || stats.ThrottledUsec != 300 {
+		t.Fatalf("unexpected cpu throttling %+v", stats)
+	}
+	if stats.MemoryCurrent != 4096 || stats.MemoryPeak != 0 || stats.MemoryMax != 0 {
+		t.Fatalf("unexpected memory usage %+v", stats)
+	}
+	if stats.MemoryEvents != (MemoryEvents{High: 3, Max: 1, OOM: 1, OOMKill: 1, OOMGroupKill: 1}) {
+		t.Fatalf("unexpected memory events %+v", stats.MemoryEvents)
+	}
+	if len(stats.IO) != 2 {
+		t.Fatalf("expected 2 devices but %d were found", len(stats.IO))
+	}
+	if stats.IO[0] != (IOStat{Major: 8, Minor: 0, ReadBytes: 1024, WriteBytes: 2048, ReadOps: 1, WriteOps: 2}) {
+		t.Fatalf("unexpected io stats %+v", stats.IO[0])
+	}
+	if stats.PidsCurrent != 3 {
+		t.Fatalf("expected 3 pids but %d were found", stats.PidsCurrent)
+	}
+	if stats.PidsPeak != 5 {
+		t.Fatalf("expected a peak of 5 pids but %d was found", stats.PidsPeak)
+	}
+	if stats.Pressure.CPU.Some != (PressureValues{Avg10: 12.5, Avg60: 3, Avg300: 1, TotalUsec: 123456}) {
+		t.Fatalf("unexpected cpu pressure %+v", stats.Pressure.CPU)
+	}
+	// memory.pressure and io.pressure are missing as when PSI is disabled
+	if stats.Pressure.Memory != (Pressure{}) || stats.Pressure.IO != (Pressure{}) {
+		t.Fatalf("unexpected pressure %+v", stats.Pressure)
+	}
+}
+
+func TestParseStatsFailure(t *testing.T) {
+	if _, err := parseFlatKeyed([]byte("usage_usec abc\n")); err == nil {
+		t.Fatal("error was expected for invalid value")
+	}
+	if _, err := parseFlatKeyed([]byte("usage_usec\n")); err == nil {
+		t.Fatal("error was expected for missing value")
+	}
+	if _, err := parseIOStat([]byte("8-0 rbytes=1\n")); err == nil {
+		t.Fatal("error was expected for invalid device")
+	}
+	if _, err := parseIOStat([]byte("8:0 rbytes\n")); err == nil {
+		t.Fatal("error was expected for invalid field")
+	}
+	if _, err := parsePressure([]byte("most avg10=0.00\n")); err == nil {
+		t.Fatal("error was expected for invalid pressure line")
+	}
+	if _, err := parsePressure([]byte("some avg10=abc\n")); err == nil {
+		t.Fatal("error was expected for invalid pressure value")
+	}
+}
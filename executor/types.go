@@ -26,9 +26,149 @@ const (
 	Completed
 )
 
+// Cause represents why a process terminated
+type Cause int
+
+func (c Cause) String() string {
+	return causeMap[c]
+}
+
+var causeMap = map[Cause]string{
+	NotTerminated: "",
+	Exited:        "Exited",
+	Signaled:      "Signaled",
+	OOMKilled:     "OOMKilled",
+}
+
+const (
+	NotTerminated Cause = iota
+	Exited
+	Signaled
+	OOMKilled
+)
+
+// Propagation is the propagation type of a bind mount, see mount_namespaces(7)
+type Propagation int
+
+func (p Propagation) String() string {
+	return propagationMap[p]
+}
+
+var propagationMap = map[Propagation]string{
+	PropagationPrivate:  "private",
+	PropagationRPrivate: "rprivate",
+	PropagationSlave:    "slave",
+	PropagationRSlave:   "rslave",
+	PropagationShared:   "shared",
+	PropagationRShared:  "rshared",
+}
+
+const (
+	PropagationPrivate Propagation = iota
+	PropagationRPrivate
+	PropagationSlave
+	PropagationRSlave
+	PropagationShared
+	PropagationRShared
+)
+
+// ParsePropagation returns the propagation type named s, empty is private
+func ParsePropagation(s string) (Propagation, error) {
+	if s == "" {
+		return PropagationPrivate, nil
+	}
+	for p, name := range propagationMap {
+		if name == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown propagation %s", s)
+}
+
+// Mount is a host path bind mounted in the sandbox of a process
+type Mount struct {
+	// Source is the absolute host path, directories are mounted with their submounts
+	Source string
+	// Target is the absolute path of the mount in the sandbox, it is created when the process runs in
+	// a root filesystem and must exist otherwise
+	Target string
+	// ReadOnly prevents the process from writing to the source and its submounts
+	ReadOnly bool
+	// Propagation is the propagation type of the mount in the sandbox, whose mounts are private to the sandbox
+	Propagation Propagation
+}
+
+// DefaultTmpSizeMB is the size of a tmpfs declared without size and of the /tmp of the sandbox
+// when the process does not declare it
+const DefaultTmpSizeMB = 64
+
+// maxTmpSizeMB bounds the size of a tmpfs to 1TB, the size is given to the kernel in bytes
+const maxTmpSizeMB = 1 << 20
+
+// Tmpfs is a memory backed filesystem mounted in the sandbox of a process, its pages are charged to the
+// memory of the process. Writes beyond its size fail with ENOSPC.
+type Tmpfs struct {
+	// Target is the absolute path of the mount in the sandbox, see Mount
+	Target string
+	// SizeMB caps the size of the filesystem in megabytes up to 1TB, 0 means DefaultTmpSizeMB
+	SizeMB uint64
+	// Mode is the permissions of the root directory of the filesystem like 0755, 0 means 01777
+	Mode uint32
+	// NoExec prevents the process from executing the files of the filesystem
+	NoExec bool
+	// NoSuid ignores the set-user-ID and set-group-ID bits of the files of the filesystem
+	NoSuid bool
+}
+
+// VolumeMount mounts a named volume in the sandbox of a process
+type VolumeMount struct {
+	// Name is the name of the volume
+	Name string
+	// Target is the absolute path of the mount in the sandbox, see Mount
+	Target string
+	// ReadOnly prevents the process from writing to the volume
+	ReadOnly bool
+}
+
+// EventType classifies the entries of a job history
+type EventType int
+
+func (t EventType) String() string {
+	return eventTypeMap[t]
+}
+
+var eventTypeMap = map[EventType]string{
+	Held:          "Held",
+	Started:       "Started",
+	LimitsUpdated: "LimitsUpdated",
+	Terminated:    "Terminated",
+}
+
+const (
+	Started EventType = iota
+	LimitsUpdated
+	Terminated
+	Held
+)
+
+// Event is an entry of a job history
+type Event struct {
+	Time    time.Time
+	Type    EventType
+	Message string
+}
+
 type Status struct {
-	CreatedAt    time.Time
-	Mutex        *sync.Mutex
+	// Accounting is the resource usage read at termination, nil if the cgroup could not be read
+	Accounting *Accounting
+	Cause      Cause
+	CreatedAt  time.Time
+	ExitCode   int
+	Mutex      *sync.Mutex
+	// PeakMemory is the maximum memory used in bytes, as accounted by the cgroup at termination
+	PeakMemory uint64
+	// MemoryMax is the memory limit in bytes at termination, 0 means unlimited
+	MemoryMax    uint64
 	Pid          int
 	StartedAt    time.Time
 	State        State
@@ -0,0 +1,217 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"minidocker/internal/mount"
+)
+
+// IDMap maps Size consecutive ids starting at ContainerID in the sandbox to the host ids starting at HostID,
+// like a line of /proc/<pid>/uid_map
+type IDMap struct {
+	ContainerID uint32
+	HostID      uint32
+	Size        uint32
+}
+
+// UserNamespace maps the users and the groups of the sandboxes to host ids. A job runs as the root of
+// its user namespace, root in the sandbox and the unprivileged host user mapped to it outside.
+// Without UIDs the jobs run in the user namespace of the Executor.
+type UserNamespace struct {
+	UIDs []IDMap
+	GIDs []IDMap
+}
+
+// WithUserNamespace runs the jobs in user namespaces mapping their ids to the host ids of ns, the sandbox ids
+// must include 0. An Executor not started as root always runs the jobs in user namespaces: the kernel
+// only lets it map its own uid and gid, to root in the sandbox, which is the default.
+func WithUserNamespace(ns UserNamespace) Option {
+	return func(s *Executor) {
+		s.userns = ns
+	}
+}
+
+// subordinate id files of shadow-utils, see subuid(5)
+const (
+	subuidFile = "/etc/subuid"
+	subgidFile = "/etc/subgid"
+)
+
+// SubordinateIDs returns the user namespace mapping the ids of the sandboxes from 0 to the subordinate
+// uids and gids of the user name read from /etc/subuid and /etc/subgid
+func SubordinateIDs(name string) (UserNamespace, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return UserNamespace{}, err
+	}
+	uids, err := readSubordinateIDs(subuidFile, u.Username, u.Uid)
+	if err != nil {
+		return UserNamespace{}, err
+	}
+	gids, err := readSubordinateIDs(subgidFile, u.Username, u.Uid)
+	if err != nil {
+		return UserNamespace{}, err
+	}
+	return UserNamespace{UIDs: []IDMap{uids}, GIDs: []IDMap{gids}}, nil
+}
+
+func readSubordinateIDs(file, name, id string) (IDMap, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return IDMap{}, err
+	}
+	defer f.Close()
+	m, err := parseSubordinateIDs(f, name, id)
+	if err != nil {
+		return IDMap{}, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	return m, nil
+}
+
+// parseSubordinateIDs returns the first range of the user name or id in the subuid(5) format
+// mapped from 0 in the sandbox
+func parseSubordinateIDs(r io.Reader, name, id string) (IDMap, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			return IDMap{}, fmt.Errorf("invalid line %q", line)
+		}
+		if fields[0] != name && fields[0] != id {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return IDMap{}, fmt.Errorf("invalid first id in %q: %w", line, err)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil || count == 0 || start+count > 1<<32 {
+			return IDMap{}, fmt.Errorf("invalid id count in %q", line)
+		}
+		return IDMap{ContainerID: 0, HostID: uint32(start), Size: uint32(count)}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return IDMap{}, err
+	}
+	return IDMap{}, fmt.Errorf("no subordinate ids for %s", name)
+}
+
+// ownIDs maps the uid and the gid of the Executor to root in the sandbox, the only map the kernel
+// lets an unprivileged process write
+func ownIDs() UserNamespace {
+	return UserNamespace{
+		UIDs: []IDMap{{ContainerID: 0, HostID: uint32(os.Geteuid()), Size: 1}},
+		GIDs: []IDMap{{ContainerID: 0, HostID: uint32(os.Getegid()), Size: 1}},
+	}
+}
+
+// checkUserNamespace verifies the ids of ns can be mapped by the Executor
+func checkUserNamespace(ns UserNamespace, privileged bool) error {
+	if _, _, err := ns.root(); err != nil {
+		return err
+	}
+	if privileged {
+		return nil
+	}
+	own := ownIDs()
+	if len(ns.UIDs) != 1 || len(ns.GIDs) != 1 || ns.UIDs[0] != own.UIDs[0] || ns.GIDs[0] != own.GIDs[0] {
+		return fmt.Errorf("an Executor not started as root can only map its own uid and gid to root in the sandbox")
+	}
+	return nil
+}
+
+// makeSearchable creates the directories or adds the search permission of the others to them, the root of
+// the user namespaces traverses them to reach the root filesystems and the volumes of the jobs. Their
+// content can still not be listed.
+func makeSearchable(dirs ...string) error {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0711); err != nil {
+			return err
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm()&0001 == 0 {
+			if err := os.Chmod(dir, info.Mode().Perm()|0001); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// actAsSandboxRoot changes the filesystem ids of the calling thread, locked and not reused, to the host ids of
+// the root of the sandbox when the Executor is started as root, the files it creates in the sandbox are owned
+// by the root of the sandbox. The capabilities of the thread are kept.
+func (p *process) actAsSandboxRoot() error {
+	if !p.config.userns.enabled() || os.Geteuid() != 0 {
+		return nil
+	}
+	uid, gid, err := p.config.userns.root()
+	if err != nil {
+		return err
+	}
+	return mount.SetFilesystemIDs(uid, gid)
+}
+
+func (ns UserNamespace) enabled() bool {
+	return len(ns.UIDs) > 0
+}
+
+// root returns the host uid and gid of the root of the sandboxes
+func (ns UserNamespace) root() (int, int, error) {
+	uid, found := hostID(ns.UIDs, 0)
+	if !found {
+		return 0, 0, fmt.Errorf("the uid map of the user namespace does not map root")
+	}
+	gid, found := hostID(ns.GIDs, 0)
+	if !found {
+		return 0, 0, fmt.Errorf("the gid map of the user namespace does not map root")
+	}
+	return int(uid), int(gid), nil
+}
+
+// overflowID is the id the kernel reports for the ids a user namespace does not map
+const overflowID = 65534
+
+// sandboxIDs returns the ids in the sandbox of the host uid and gid, the ids that are not mapped are overflowID
+func (ns UserNamespace) sandboxIDs(uid, gid int) (int, int) {
+	return sandboxID(ns.UIDs, uid), sandboxID(ns.GIDs, gid)
+}
+
+func sandboxID(maps []IDMap, id int) int {
+	for _, m := range maps {
+		if id >= int(m.HostID) && id-int(m.HostID) < int(m.Size) {
+			return int(m.ContainerID) + id - int(m.HostID)
+		}
+	}
+	return overflowID
+}
+
+func hostID(maps []IDMap, id uint32) (uint32, bool) {
+	for _, m := range maps {
+		if id >= m.ContainerID && id-m.ContainerID < m.Size {
+			return m.HostID + id - m.ContainerID, true
+		}
+	}
+	return 0, false
+}
+
+func mountIDMaps(maps []IDMap) []mount.IDMap {
+	converted := make([]mount.IDMap, 0, len(maps))
+	for _, m := range maps {
+		converted = append(converted, mount.IDMap{ContainerID: int(m.ContainerID), HostID: int(m.HostID), Size: int(m.Size)})
+	}
+	return converted
+}
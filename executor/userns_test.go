@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSubordinateIDs(t *testing.T) {
+	const subuid = `# comment
+other:200000:65536
+jobs:100000:65536
+1000:300000:1000
+`
+	for _, c := range []struct {
+		name     string
+		id       string
+		expected IDMap
+		err      bool
+	}{
+		{"jobs", "999", IDMap{ContainerID: 0, HostID: 100000, Size: 65536}, false},
+		// A line can name the user by its uid
+		{"someone", "1000", IDMap{ContainerID: 0, HostID: 300000, Size: 1000}, false},
+		{"missing", "1001", IDMap{}, true},
+	} {
+		m, err := parseSubordinateIDs(strings.NewReader(subuid), c.name, c.id)
+		if (err != nil) != c.err {
+			t.Fatalf("unexpected error for %s: %v", c.name, err)
+		}
+		if m != c.expected {
+			t.Fatalf("expected %+v for %s but %+v was found", c.expected, c.name, m)
+		}
+	}
+	for _, invalid := range []string{"jobs:100000", "jobs:x:65536", "jobs:100000:0", "jobs:4294967295:2"} {
+		if _, err := parseSubordinateIDs(strings.NewReader(invalid), "jobs", "999"); err == nil {
+			t.Fatalf("error was expected parsing %s", invalid)
+		}
+	}
+}
+
+func TestCheckUserNamespace(t *testing.T) {
+	subordinate := UserNamespace{UIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}, GIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}}
+	if err := checkUserNamespace(subordinate, true); err != nil {
+		t.Fatalf("expected root to map subordinate ids: %v", err)
+	}
+	if err := checkUserNamespace(subordinate, false); err == nil {
+		t.Fatal("error was expected mapping subordinate ids without root")
+	}
+	if err := checkUserNamespace(ownIDs(), false); err != nil {
+		t.Fatalf("expected the own ids to be mapped without root: %v", err)
+	}
+	noRoot := UserNamespace{UIDs: []IDMap{{ContainerID: 1, HostID: 100000, Size: 65536}}, GIDs: subordinate.GIDs}
+	if err := checkUserNamespace(noRoot, true); err == nil {
+		t.Fatal("error was expected when root is not mapped")
+	}
+	if uid, gid, _ := subordinate.root(); uid != 100000 || gid != 100000 {
+		t.Fatalf("expected the root of the sandboxes to be 100000:100000 but %d:%d was found", uid, gid)
+	}
+}
+
+func TestSandboxIDs(t *testing.T) {
+	ns := UserNamespace{
+		UIDs: []IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		GIDs: []IDMap{{ContainerID: 0, HostID: 200000, Size: 1000}},
+	}
+	for _, c := range []struct {
+		uid, gid       int
+		expUID, expGID int
+	}{
+		{100000, 200000, 0, 0},
+		{101000, 200999, 1000, 999},
+		// The host ids outside of the maps are not mapped
+		{0, 201000, overflowID, overflowID},
+	} {
+		if uid, gid := ns.sandboxIDs(c.uid, c.gid); uid != c.expUID || gid != c.expGID {
+			t.Fatalf("expected %d:%d for %d:%d but %d:%d was found", c.expUID, c.expGID, c.uid, c.gid, uid, gid)
+		}
+	}
+}
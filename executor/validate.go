@@ -0,0 +1,183 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldViolation describes why the limit named Field can not be applied
+type FieldViolation struct {
+	// Field is the name of the Limits field, IODevices[i] for a device rule
+	Field       string
+	Description string
+}
+
+// ValidationError reports the limits that can not be applied, the job is neither started nor updated
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	descriptions := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		descriptions = append(descriptions, v.Field+": "+v.Description)
+	}
+	return "invalid limits: " + strings.Join(descriptions, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+}
+
+// hostResources describes the resources available to the jobs, it is read when the Executor is created
+type hostResources struct {
+	// controllers are the cgroup controllers enabled for the job cgroups, nil skips the check
+	controllers map[string]bool
+	// cpus and memoryNodes are the online CPUs and memory nodes a cpuset can use
+	cpus        map[int]bool
+	memoryNodes map[int]bool
+	// memoryBytes is the memory of the host, 0 skips the check
+	memoryBytes uint64
+	// rootBlockDevice tells if the root filesystem is on a disk ReadBPS and WriteBPS can be applied to
+	rootBlockDevice bool
+}
+
+// limitControllers maps each limit to the cgroup controller applying it
+var limitControllers = []struct {
+	field      string
+	controller string
+	set        func(Limits) bool
+}{
+	{"CPUPercent", "cpu", func(l Limits) bool { return l.CPUPercent > 0 }},
+	{"CPUMillis", "cpu", func(l Limits) bool { return l.CPUMillis > 0 }},
+	{"CPUBurstUsec", "cpu", func(l Limits) bool { return l.CPUBurstUsec > 0 }},
+	{"CPUWeight", "cpu", func(l Limits) bool { return l.CPUWeight > 0 }},
+	{"CpusetCpus", "cpuset", func(l Limits) bool { return l.CpusetCpus != "" }},
+	{"CpusetMems", "cpuset", func(l Limits) bool { return l.CpusetMems != "" }},
+	{"MemoryMB", "memory", func(l Limits) bool { return l.MemoryMB > 0 }},
+	{"MemoryHighMB", "memory", func(l Limits) bool { return l.MemoryHighMB > 0 }},
+	{"MemoryLowMB", "memory", func(l Limits) bool { return l.MemoryLowMB > 0 }},
+	{"MemoryMinMB", "memory", func(l Limits) bool { return l.MemoryMinMB > 0 }},
+	{"MemorySwapMB", "memory", func(l Limits) bool { return l.MemorySwapMB > 0 }},
+	{"NoSwap", "memory", func(l Limits) bool { return l.NoSwap }},
+	{"IOWeight", "io", func(l Limits) bool { return l.IOWeight > 0 }},
+	{"ReadBPS", "io", func(l Limits) bool { return l.ReadBPS > 0 }},
+	{"WriteBPS", "io", func(l Limits) bool { return l.WriteBPS > 0 }},
+	{"IODevices", "io", func(l Limits) bool { return len(l.IODevices) > 0 }},
+	{"PidsMax", "pids", func(l Limits) bool { return l.PidsMax > 0 }},
+}
+
+// validateLimits verifies the limits can be applied on the host and returns them with the IO devices resolved,
+// a *ValidationError lists every limit that can not be applied.
+func validateLimits(l Limits, host hostResources) (Limits, error) {
+	v := &ValidationError{}
+	if host.controllers != nil {
+		for _, c := range limitControllers {
+			if c.set(l) && !host.controllers[c.controller] {
+				v.add(c.field, "the %s cgroup controller is not available", c.controller)
+			}
+		}
+	}
+	validateCPU(l, len(host.cpus), v)
+	validateCpuset(l, host, v)
+	validateMemory(l, host.memoryBytes, v)
+	devices := validateIO(l, host.rootBlockDevice, v)
+	if len(v.Violations) > 0 {
+		return Limits{}, v
+	}
+	l.IODevices = devices
+	return l, nil
+}
+
+func validateCpuset(l Limits, host hostResources, v *ValidationError) {
+	sets := []struct {
+		field     string
+		list      string
+		available map[int]bool
+	}{{"CpusetCpus", l.CpusetCpus, host.cpus}, {"CpusetMems", l.CpusetMems, host.memoryNodes}}
+	for _, set := range sets {
+		if set.list == "" {
+			continue
+		}
+		ids, err := parseCPUList(set.list)
+		if err != nil {
+			v.add(set.field, "%s", err)
+			continue
+		}
+		for _, id := range ids {
+			if !set.available[id] {
+				v.add(set.field, "%d is not online on the host", id)
+				break
+			}
+		}
+	}
+}
+
+func validateMemory(l Limits, hostMemory uint64, v *ValidationError) {
+	limits := []struct {
+		field string
+		mb    uint
+	}{{"MemoryMB", l.MemoryMB}, {"MemoryHighMB", l.MemoryHighMB}, {"MemoryLowMB", l.MemoryLowMB}, {"MemoryMinMB", l.MemoryMinMB}}
+	for _, limit := range limits {
+		if hostMemory > 0 && uint64(limit.mb)*1024*1024 > hostMemory {
+			v.add(limit.field, "%dMB exceeds the host memory of %dMB", limit.mb, hostMemory/1024/1024)
+		}
+		if limit.field != "MemoryMB" && l.MemoryMB > 0 && limit.mb > l.MemoryMB {
+			v.add(limit.field, "%dMB exceeds MemoryMB of %dMB", limit.mb, l.MemoryMB)
+		}
+	}
+	if l.MemoryMinMB > 0 && l.MemoryLowMB > 0 && l.MemoryMinMB > l.MemoryLowMB {
+		v.add("MemoryMinMB", "%dMB exceeds MemoryLowMB of %dMB", l.MemoryMinMB, l.MemoryLowMB)
+	}
+}
+
+// validateIO returns the IO device rules with their device numbers resolved
+func validateIO(l Limits, rootBlockDevice bool, v *ValidationError) []IODeviceLimit {
+	if l.IOWeight > 10000 {
+		v.add("IOWeight", "%d is not in the range 1-10000", l.IOWeight)
+	}
+	for _, limit := range []struct {
+		field string
+		bps   uint
+	}{{"ReadBPS", l.ReadBPS}, {"WriteBPS", l.WriteBPS}} {
+		if limit.bps == 1 {
+			v.add(limit.field, "the minimum bytes per second is 2")
+		} else if limit.bps > 1 && !rootBlockDevice {
+			v.add(limit.field, "the root filesystem is not on a block device")
+		}
+	}
+	devices, err := resolveIODevices(l.IODevices)
+	if err != nil {
+		v.add("IODevices", "%s", err)
+	}
+	return devices
+}
+
+// maxCPUListID bounds the ids of CPU lists, the kernel supports at most 8192 CPUs and 1024 memory nodes
+const maxCPUListID = 8191
+
+// parseCPUList parses the list format of cpuset.cpus like "0-2,4"
+func parseCPUList(s string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(strings.TrimSpace(s), ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid list %q", s)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid list %q", s)
+			}
+		}
+		if end > maxCPUListID {
+			return nil, fmt.Errorf("invalid list %q: %d exceeds the maximum id of %d", s, end, maxCPUListID)
+		}
+		for id := start; id <= end; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateLimits(t *testing.T) {
+	host := hostResources{
+		controllers:     map[string]bool{"cpu": true, "memory": true, "pids": true},
+		cpus:            map[int]bool{0: true, 1: true, 2: true, 3: true},
+		memoryNodes:     map[int]bool{0: true},
+		memoryBytes:     4096 * 1024 * 1024,
+		rootBlockDevice: true,
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		fields []string
+	}{
+		{"NoLimits", Limits{}, nil},
+		{"Valid", Limits{CPUMillis: 2000, MemoryMB: 1024, MemoryHighMB: 768, PidsMax: 100}, nil},
+		{"MissingController", Limits{CpusetCpus: "0", IOWeight: 100}, []string{"CpusetCpus", "IOWeight"}},
+		{"MoreCPUsThanHost", Limits{CPUMillis: 4500}, []string{"CPUMillis"}},
+		{"MoreMemoryThanHost", Limits{MemoryMB: 8192}, []string{"MemoryMB"}},
+		{"HighAboveMax", Limits{MemoryMB: 512, MemoryHighMB: 1024}, []string{"MemoryHighMB"}},
+		{"MinAboveLow", Limits{MemoryLowMB: 256, MemoryMinMB: 512}, []string{"MemoryMinMB"}},
+		{"BPSLowerBound", Limits{ReadBPS: 1}, []string{"ReadBPS", "ReadBPS"}},
+		{"MissingDevice", Limits{IODevices: []IODeviceLimit{{Device: "/does/not/exist", ReadBPS: 1024}}}, []string{"IODevices", "IODevices"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := validateLimits(test.limits, host)
+			var fields []string
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				for _, v := range validationErr.Violations {
+					fields = append(fields, v.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Fatalf("expected violations of %v but %v were found: %v", test.fields, fields, err)
+			}
+		})
+	}
+}
+
+func TestValidateCpuset(t *testing.T) {
+	host := hostResources{cpus: map[int]bool{0: true, 1: true}, memoryNodes: map[int]bool{0: true}}
+	tests := []struct {
+		name   string
+		limits Limits
+		err    bool
+	}{
+		{"Online", Limits{CpusetCpus: "0-1", CpusetMems: "0"}, false},
+		{"OfflineCPU", Limits{CpusetCpus: "1-2"}, true},
+		{"OfflineNode", Limits{CpusetMems: "1"}, true},
+		{"InvalidList", Limits{CpusetCpus: "2-1"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := &ValidationError{}
+			if validateCpuset(test.limits, host, v); test.err != (len(v.Violations) > 0) {
+				t.Fatalf("unexpected violations: %v", v.Violations)
+			}
+		})
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	ids, err := parseCPUList("0-2,4,6-7\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(ids, []int{0, 1, 2, 4, 6, 7}) {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	for _, invalid := range []string{"", "a", "1-", "-1", "3-2", "0-4000000000", "8192"} {
+		if _, err := parseCPUList(invalid); err == nil {
+			t.Fatalf("error was expected for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"minidocker/internal/volume"
+)
+
+// CreateVolume creates the empty volume name owned by owner, a sizeMB other than 0 caps its size
+func (s *Executor) CreateVolume(name, owner string, sizeMB uint64) (volume.Volume, error) {
+	return s.volumes.Create(name, owner, sizeMB)
+}
+
+// ListVolumes returns the volumes sorted by name
+func (s *Executor) ListVolumes() ([]volume.Volume, error) {
+	return s.volumes.List()
+}
+
+// GetVolume returns the volume name
+func (s *Executor) GetVolume(name string) (volume.Volume, error) {
+	return s.volumes.Get(name)
+}
+
+// RemoveVolume removes the volume name and its data, a volume used by a Queued or Running job can not be removed.
+// The sandboxes of the terminated jobs using the volume are released.
+func (s *Executor) RemoveVolume(name string) error {
+	s.volumesMutex.Lock()
+	defer s.volumesMutex.Unlock()
+	if _, err := s.volumes.Get(name); err != nil {
+		return err
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var terminated []*process
+	for _, p := range s.jobs {
+		if !slices.ContainsFunc(p.config.Volumes, func(v VolumeMount) bool { return v.Name == name }) {
+			continue
+		}
+		if state := p.Status().State; state == Queued || state == Running {
+			return fmt.Errorf("volume %s is used by job %d", name, p.ID)
+		}
+		terminated = append(terminated, p)
+	}
+	for _, p := range terminated {
+		p.releaseSandbox()
+	}
+	return s.volumes.Remove(name)
+}
+
+// resolveVolumes adds the volumes of c to its mounts
+func (s *Executor) resolveVolumes(c *ProcessConfig) error {
+	mounts := slices.Clone(c.Mounts)
+	for _, v := range c.Volumes {
+		path, err := s.volumes.Path(v.Name)
+		if err != nil {
+			return err
+		}
+		// The helper refuses the sources holding symbolic links, like a data root under one
+		if path, err = filepath.EvalSymlinks(path); err != nil {
+			return err
+		}
+		if s.userns.enabled() && os.Geteuid() == 0 {
+			// The data of a volume is owned by the root of the sandboxes
+			uid, gid, _ := s.userns.root()
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return err
+			}
+		}
+		mounts = append(mounts, Mount{Source: path, Target: v.Target, ReadOnly: v.ReadOnly})
+	}
+	c.Mounts = mounts
+	return nil
+}
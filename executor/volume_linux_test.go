@@ -0,0 +1,71 @@
+//go:build linux
+
+package executor
+
+import (
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"minidocker/internal/image"
+	"minidocker/internal/volume"
+
+	"github.com/google/uuid"
+)
+
+func TestVolumeJob(t *testing.T) {
+	dataRoot := t.TempDir()
+	s := &Executor{
+		dataRoot: dataRoot,
+		done:     make(chan struct{}),
+		id:       uuid.New(),
+		images:   image.NewStore(filepath.Join(dataRoot, "images")),
+		volumes:  volume.NewStore(filepath.Join(dataRoot, "volumes")),
+		jobs:     map[uint64]*process{},
+		nextID:   -1,
+		wg:       &sync.WaitGroup{},
+	}
+	defer s.Stop()
+	importShellImage(t, s.images, `{}`)
+	if _, err := s.CreateVolume("data", "user1", 0); err != nil {
+		t.Fatalf("create returned error: %v", err)
+	}
+
+	// The files written by a job are seen by the next one
+	pid, err := s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "echo kept > /data/file"}, Volumes: []VolumeMount{{Name: "data", Target: "/data"}}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	readOutput(t, s, pid)
+	pid, err = s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "read x < /data/file; echo $x; (echo x > /data/file) 2>/dev/null || echo denied"},
+		Volumes: []VolumeMount{{Name: "data", Target: "/data", ReadOnly: true}}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if output := readOutput(t, s, pid); output != "kept\ndenied\n" {
+		t.Fatalf("expected the volume to keep the file written by the previous job but '%s' was found", output)
+	}
+
+	// A volume can't be removed while a job uses it
+	reader, writer := io.Pipe()
+	pid, err = s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "read x"}, Stdin: reader, Volumes: []VolumeMount{{Name: "data", Target: "/data"}}})
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if err := s.RemoveVolume("data"); err == nil {
+		t.Fatal("error was expected removing the volume of a running job")
+	}
+	writer.Close()
+	readOutput(t, s, pid)
+
+	if _, err := s.Start(&ProcessConfig{Image: "shell", Cmd: "sh", Args: []string{"-c", "true"}, Volumes: []VolumeMount{{Name: "missing", Target: "/data"}}}); err == nil {
+		t.Fatal("error was expected starting a job with a missing volume")
+	}
+	if err := s.RemoveVolume("data"); err != nil {
+		t.Fatalf("remove returned error: %v", err)
+	}
+	if _, err := s.GetVolume("data"); err == nil {
+		t.Fatal("expected the volume to be removed")
+	}
+}
@@ -0,0 +1,353 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Write adds path to the tar archive, directories are added recursively.
+// Entries are named after the base name of path, like "docker cp" does.
+// The parent directory of path is opened like os.Open does, path itself is not followed.
+func Write(tw *tar.Writer, path string) error {
+	path = filepath.Clean(path)
+	parent, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+	return WriteAt(tw, parent, filepath.Base(path))
+}
+
+// WriteAt adds the entry name of the directory dir to the tar archive like Write does. Every entry is
+// opened relative to its parent directory without following symbolic links, so that a file can not be
+// swapped for a link to a file outside of dir while the archive is written.
+func WriteAt(tw *tar.Writer, dir *os.File, name string) error {
+	return writeEntry(tw, int(dir.Fd()), name, name)
+}
+
+// writeEntry adds the entry name of the directory dirfd to the archive as archiveName
+func writeEntry(tw *tar.Writer, dirfd int, name, archiveName string) error {
+	var st unix.Stat_t
+	if err := unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &fs.PathError{Op: "lstat", Path: archiveName, Err: err}
+	}
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		return writeDir(tw, dirfd, name, archiveName)
+	case unix.S_IFREG:
+		return writeFile(tw, dirfd, name, archiveName)
+	case unix.S_IFLNK:
+		link, err := readlinkat(dirfd, name)
+		if err != nil {
+			return &fs.PathError{Op: "readlink", Path: archiveName, Err: err}
+		}
+		return writeHeader(tw, &st, archiveName, link)
+	default:
+		return writeHeader(tw, &st, archiveName, "")
+	}
+}
+
+func writeDir(tw *tar.Writer, dirfd int, name, archiveName string) error {
+	dir, st, err := openAt(dirfd, name, unix.O_RDONLY|unix.O_DIRECTORY, archiveName)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return fmt.Errorf("%s changed while it was archived", archiveName)
+	}
+	if err := writeHeader(tw, st, archiveName, ""); err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := writeEntry(tw, int(dir.Fd()), n, path.Join(archiveName, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, dirfd int, name, archiveName string) error {
+	// O_NONBLOCK prevents blocking on a named pipe placed at name after it was checked
+	f, st, err := openAt(dirfd, name, unix.O_RDONLY|unix.O_NONBLOCK, archiveName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if st.Mode&unix.S_IFMT != unix.S_IFREG {
+		return fmt.Errorf("%s changed while it was archived", archiveName)
+	}
+	if err := writeHeader(tw, st, archiveName, ""); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// openAt opens the entry name of the directory dirfd without following it and returns it with its attributes
+func openAt(dirfd int, name string, flags int, archiveName string) (*os.File, *unix.Stat_t, error) {
+	fd, err := unix.Openat(dirfd, name, flags|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: "open", Path: archiveName, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), archiveName)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		f.Close()
+		return nil, nil, &fs.PathError{Op: "stat", Path: archiveName, Err: err}
+	}
+	return f, &st, nil
+}
+
+func writeHeader(tw *tar.Writer, st *unix.Stat_t, name, link string) error {
+	header, err := tar.FileInfoHeader(statInfo{name: path.Base(name), st: st}, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if header.Typeflag == tar.TypeDir {
+		header.Name += "/"
+	}
+	header.Uid, header.Gid = int(st.Uid), int(st.Gid)
+	if header.Typeflag == tar.TypeChar || header.Typeflag == tar.TypeBlock {
+		header.Devmajor, header.Devminor = int64(unix.Major(uint64(st.Rdev))), int64(unix.Minor(uint64(st.Rdev)))
+	}
+	return tw.WriteHeader(header)
+}
+
+func readlinkat(dirfd int, name string) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(dirfd, name, buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// statInfo is the fs.FileInfo of the attributes read with stat
+type statInfo struct {
+	name string
+	st   *unix.Stat_t
+}
+
+func (i statInfo) Name() string       { return i.name }
+func (i statInfo) Size() int64        { return i.st.Size }
+func (i statInfo) ModTime() time.Time { return time.Unix(i.st.Mtim.Unix()) }
+func (i statInfo) IsDir() bool        { return i.Mode().IsDir() }
+func (i statInfo) Sys() any           { return nil }
+
+func (i statInfo) Mode() fs.FileMode {
+	mode := fs.FileMode(i.st.Mode & 0777)
+	switch uint32(i.st.Mode) & unix.S_IFMT {
+	case unix.S_IFDIR:
+		mode |= fs.ModeDir
+	case unix.S_IFLNK:
+		mode |= fs.ModeSymlink
+	case unix.S_IFIFO:
+		mode |= fs.ModeNamedPipe
+	case unix.S_IFSOCK:
+		mode |= fs.ModeSocket
+	case unix.S_IFCHR:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case unix.S_IFBLK:
+		mode |= fs.ModeDevice
+	}
+	if i.st.Mode&unix.S_ISUID != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if i.st.Mode&unix.S_ISGID != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if i.st.Mode&unix.S_ISVTX != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// Extract unpacks the tar archive read from r into the directory dest.
+// Entries escaping dest, either by name or through symbolic links, are rejected.
+func Extract(r io.Reader, dest string) error {
+	dir, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return ExtractAt(r, dir)
+}
+
+// ExtractAt unpacks the tar archive read from r into the directory dir like Extract does. The parent
+// directories of every entry are opened relative to dir one at a time and no entry is followed when it is
+// a symbolic link, so that a directory can not be swapped for a link outside of dir while the archive is unpacked.
+func ExtractAt(r io.Reader, dir *os.File) error {
+	info, err := dir.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir.Name())
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name, err := cleanName(header.Name)
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(header.Mode).Perm()
+		if name == "." && header.Typeflag == tar.TypeDir {
+			continue
+		} else if name == "." {
+			return fmt.Errorf("invalid entry name %s", header.Name)
+		}
+		parent, err := openParent(dir, name, header.Typeflag == tar.TypeDir, mode)
+		if err != nil {
+			return err
+		}
+		err = extractEntry(tr, header, parent, filepath.Base(name), mode)
+		parent.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cleanName returns the cleaned name of an entry or an error if it escapes the directory it is extracted to
+func cleanName(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid entry name %s", name)
+	}
+	return clean, nil
+}
+
+// openParent opens the parent directory of the entry name walking from dir without following symbolic links,
+// create creates the missing directories with mode like os.MkdirAll does
+func openParent(dir *os.File, name string, create bool, mode fs.FileMode) (*os.File, error) {
+	fd, err := unix.Openat(int(dir.Fd()), ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Dir(name)
+	if parent != "." {
+		for _, c := range strings.Split(parent, string(filepath.Separator)) {
+			next, err := openDir(fd, c, create, mode)
+			unix.Close(fd)
+			if err != nil {
+				return nil, fmt.Errorf("error opening the parent directories of %s: %w", name, err)
+			}
+			fd = next
+		}
+	}
+	return os.NewFile(uintptr(fd), filepath.Join(dir.Name(), parent)), nil
+}
+
+// openDir opens the directory name of dirfd, O_NOFOLLOW refuses a symbolic link
+func openDir(dirfd int, name string, create bool, mode fs.FileMode) (int, error) {
+	fd, err := unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) && create {
+		if err := unix.Mkdirat(dirfd, name, uint32(mode)); err != nil && !errors.Is(err, unix.EEXIST) {
+			return -1, &fs.PathError{Op: "mkdir", Path: name, Err: err}
+		}
+		fd, err = unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	}
+	if err != nil {
+		return -1, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return fd, nil
+}
+
+// extractEntry creates the entry name in the directory parent from header, the content of a file is read from r
+func extractEntry(r io.Reader, header *tar.Header, parent *os.File, name string, mode fs.FileMode) error {
+	dirfd := int(parent.Fd())
+	switch header.Typeflag {
+	case tar.TypeDir:
+		fd, err := openDir(dirfd, name, true, mode)
+		if err != nil {
+			return err
+		}
+		return unix.Close(fd)
+	case tar.TypeReg:
+		return extractFile(r, dirfd, name, mode)
+	case tar.TypeSymlink:
+		if err := unix.Symlinkat(header.Linkname, dirfd, name); err != nil {
+			return &fs.PathError{Op: "symlink", Path: header.Name, Err: err}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported entry type %q for %s", header.Typeflag, header.Name)
+	}
+}
+
+func extractFile(r io.Reader, dirfd int, name string, mode fs.FileMode) error {
+	// O_NOFOLLOW prevents writing through a symbolic link placed at name and
+	// O_NONBLOCK prevents blocking on a named pipe
+	fd, err := unix.Openat(dirfd, name, unix.O_CREAT|unix.O_TRUNC|unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, uint32(mode))
+	if err != nil {
+		return &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), name)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		f.Close()
+		return err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFREG {
+		f.Close()
+		return fmt.Errorf("%s is not a regular file", name)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// OpenDir opens the directory path walking from the root directory one component at a time without
+// following symbolic links, so that a path checked by the caller can not lead elsewhere once opened
+func OpenDir(path string) (*os.File, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%s is not an absolute path", path)
+	}
+	fd, err := unix.Open("/", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if c == "" {
+			continue
+		}
+		next, err := openDir(fd, c, false, 0)
+		unix.Close(fd)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", path, err)
+		}
+		fd = next
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteExtract(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "data", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data", "nested", "file"), []byte("hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nested/file", filepath.Join(src, "data", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := Write(tw, filepath.Join(src, "data")); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	dest := t.TempDir()
+	if err := Extract(buf, dest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dest, "data", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello" {
+		t.Fatalf("expected hello but '%s' was found", content)
+	}
+	info, err := os.Stat(filepath.Join(dest, "data", "nested", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode 0640 but %o was found", info.Mode().Perm())
+	}
+}
+
+func TestExtractRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{"parentDir", []tar.Header{{Name: "../evil", Typeflag: tar.TypeReg}}},
+		{"absolute", []tar.Header{{Name: "/etc/evil", Typeflag: tar.TypeReg}}},
+		{"throughSymlink", []tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			{Name: "link/evil", Typeflag: tar.TypeReg},
+		}},
+		{"overSymlink", []tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/evil"},
+			{Name: "link", Typeflag: tar.TypeReg},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			tw := tar.NewWriter(buf)
+			for _, h := range test.entries {
+				if err := tw.WriteHeader(&h); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tw.Close()
+			if err := Extract(buf, t.TempDir()); err == nil {
+				t.Fatal("error was expected")
+			}
+		})
+	}
+}
+
+func TestOpenDirRefusesSymlinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := OpenDir(filepath.Join(root, "dir", "sub"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir.Close()
+	if _, err := OpenDir(filepath.Join(root, "link")); err == nil {
+		t.Fatal("error was expected opening a symbolic link")
+	}
+	if _, err := OpenDir(filepath.Join(root, "link", "sub")); err == nil {
+		t.Fatal("error was expected opening a path through a symbolic link")
+	}
+}
@@ -0,0 +1,479 @@
+package image
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"minidocker/internal/archive"
+)
+
+// Image is an image imported in the Store
+type Image struct {
+	// Name is the reference of the image like alpine:3.19
+	Name string `json:"name"`
+	// ID is the digest of the image configuration, the names of the same image share it
+	ID string `json:"id"`
+	// Imported is when the image was imported
+	Imported time.Time `json:"imported"`
+	// Layers are the digests of the layer blobs starting from the base layer
+	Layers []string `json:"layers"`
+	// Size is the size of the files of the unpacked layers in bytes
+	Size int64 `json:"size"`
+	// Config is the runtime configuration of the image
+	Config Config `json:"config"`
+}
+
+// Config is the runtime configuration of an image, see the config field of the OCI image configuration
+type Config struct {
+	Entrypoint []string `json:"Entrypoint,omitempty"`
+	Cmd        []string `json:"Cmd,omitempty"`
+	Env        []string `json:"Env,omitempty"`
+	WorkingDir string   `json:"WorkingDir,omitempty"`
+}
+
+// Store is a content addressed image store. Layer blobs are kept under blobs/sha256 and unpacked
+// in layers/<digest> to be stacked by overlayfs, images.json names the images.
+type Store struct {
+	root string
+	// mu serializes the changes of the store
+	mu sync.Mutex
+}
+
+// NewStore returns the store kept in the directory root, it is created by the first import
+func NewStore(root string) *Store {
+	return &Store{root: root}
+}
+
+// Import reads an OCI image layout or a docker save archive from r and imports its images,
+// name replaces the name of the image when the archive holds a single image.
+// An archive holding a single directory is read from that directory.
+func (s *Store) Import(r io.Reader, name string) ([]Image, error) {
+	if err := os.MkdirAll(s.root, 0700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(s.root, "import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := archive.Extract(r, dir); err != nil {
+		return nil, fmt.Errorf("error extracting image archive: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+	return s.ImportDir(dir, name)
+}
+
+// ImportDir imports the images of the OCI image layout or the extracted docker save archive in dir,
+// name replaces the name of the image when dir holds a single image.
+func (s *Store) ImportDir(dir, name string) ([]Image, error) {
+	manifests, err := readManifests(dir)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		if len(manifests) != 1 {
+			return nil, fmt.Errorf("a name can only be given to a single image, %d were found", len(manifests))
+		}
+		manifests[0].name = name
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var imported []Image
+	for _, m := range manifests {
+		if m.name == "" {
+			return nil, fmt.Errorf("the image %s has no name, a name must be given", m.config)
+		}
+		img, err := s.add(m)
+		if err != nil {
+			return nil, fmt.Errorf("error importing %s: %w", m.name, err)
+		}
+		images = replace(images, img)
+		imported = append(imported, img)
+	}
+	if err := s.save(images); err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// Commit adds the image name made of the layers of parent and of a layer holding the changes
+// recorded in the overlayfs upper directory upper, the configuration of parent is kept. owners
+// translates the owners of the files of upper, see WriteLayer.
+func (s *Store) Commit(parent Image, upper, name string, owners Owners) (Image, error) {
+	if name == "" {
+		return Image{}, fmt.Errorf("a name must be given")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images, err := s.load()
+	if err != nil {
+		return Image{}, err
+	}
+
+	// The layer is stored compressed, the configuration records the digest of the uncompressed archive
+	pr, pw := io.Pipe()
+	diffID := sha256.New()
+	go func() {
+		gw := gzip.NewWriter(pw)
+		err := WriteLayer(io.MultiWriter(gw, diffID), upper, owners)
+		if closeErr := gw.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	digest, err := s.writeBlob(pr, "")
+	pr.Close()
+	if err != nil {
+		return Image{}, fmt.Errorf("error writing layer: %w", err)
+	}
+	size, err := s.unpack(digest)
+	if err != nil {
+		return Image{}, err
+	}
+
+	config, err := s.commitConfig(parent, "sha256:"+hex.EncodeToString(diffID.Sum(nil)))
+	if err != nil {
+		return Image{}, err
+	}
+	configDigest, err := s.writeBlob(bytes.NewReader(config), "")
+	if err != nil {
+		return Image{}, err
+	}
+	img := Image{
+		Name:     normalizeName(name),
+		ID:       configDigest,
+		Imported: time.Now(),
+		Layers:   append(slices.Clone(parent.Layers), digest),
+		Size:     parent.Size + size,
+		Config:   parent.Config,
+	}
+	if err := s.save(replace(images, img)); err != nil {
+		return Image{}, err
+	}
+	return img, nil
+}
+
+// commitConfig returns the image configuration of parent extended by the layer diffID
+func (s *Store) commitConfig(parent Image, diffID string) ([]byte, error) {
+	b, err := os.ReadFile(s.blobPath(parent.ID))
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid configuration of %s: %w", parent.Name, err)
+	}
+	created := time.Now().UTC().Format(time.RFC3339)
+	rootfs, _ := config["rootfs"].(map[string]any)
+	if rootfs == nil {
+		rootfs = map[string]any{"type": "layers"}
+	}
+	diffIDs, _ := rootfs["diff_ids"].([]any)
+	rootfs["diff_ids"] = append(diffIDs, diffID)
+	config["rootfs"] = rootfs
+	history, _ := config["history"].([]any)
+	config["history"] = append(history, map[string]any{"created": created, "created_by": "minidocker commit"})
+	config["created"] = created
+	return json.Marshal(config)
+}
+
+// add stores the blobs of the image described by m and unpacks its layers
+func (s *Store) add(m manifest) (Image, error) {
+	configDigest, err := s.addBlob(m.config, m.configDigest)
+	if err != nil {
+		return Image{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	b, err := os.ReadFile(s.blobPath(configDigest))
+	if err != nil {
+		return Image{}, err
+	}
+	var config struct {
+		Config Config `json:"config"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return Image{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	img := Image{
+		Name:     normalizeName(m.name),
+		ID:       configDigest,
+		Imported: time.Now(),
+		Config:   config.Config,
+	}
+	for i, layer := range m.layers {
+		digest, err := s.addBlob(layer, m.layerDigests[i])
+		if err != nil {
+			return Image{}, fmt.Errorf("invalid layer %s: %w", layer, err)
+		}
+		img.Layers = append(img.Layers, digest)
+		size, err := s.unpack(digest)
+		if err != nil {
+			return Image{}, err
+		}
+		img.Size += size
+	}
+	return img, nil
+}
+
+// addBlob copies file in the blob store and returns its digest, expected is verified when it is not empty
+func (s *Store) addBlob(file, expected string) (string, error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return s.writeBlob(src, expected)
+}
+
+// writeBlob copies the blob read from r in the blob store and returns its digest,
+// expected is verified when it is not empty
+func (s *Store) writeBlob(r io.Reader, expected string) (string, error) {
+	blobs := filepath.Join(s.root, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0700); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(blobs, ".blob-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	digest := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if expected != "" && expected != digest {
+		return "", fmt.Errorf("digest %s does not match the expected %s", digest, expected)
+	}
+	return digest, os.Rename(tmp.Name(), s.blobPath(digest))
+}
+
+func (s *Store) blobPath(digest string) string {
+	return filepath.Join(s.root, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// unpack extracts the layer blob digest in its directory and returns the size of its files,
+// a layer shared with an image imported before is kept
+func (s *Store) unpack(digest string) (int64, error) {
+	dir := s.layerPath(digest)
+	if _, err := os.Stat(dir); err == nil {
+		return dirSize(dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return 0, err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".unpack-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(s.blobPath(digest))
+	if err != nil {
+		return 0, err
+	}
+	err = applyLayer(tmp, f)
+	f.Close()
+	if err != nil {
+		return 0, fmt.Errorf("error unpacking layer %s: %w", digest, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return 0, err
+	}
+	return dirSize(dir)
+}
+
+func (s *Store) layerPath(digest string) string {
+	return filepath.Join(s.root, "layers", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// LayerDirs returns the directories holding the unpacked layers of img starting from the base layer
+func (s *Store) LayerDirs(img Image) []string {
+	dirs := make([]string, 0, len(img.Layers))
+	for _, layer := range img.Layers {
+		dirs = append(dirs, s.layerPath(layer))
+	}
+	return dirs
+}
+
+// List returns the images sorted by name
+func (s *Store) List() ([]Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get returns the image named ref, ref is either a name, where the tag defaults to latest,
+// the ID of the image or a prefix of at least 12 characters of the hexadecimal part of the ID.
+func (s *Store) Get(ref string) (Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images, err := s.load()
+	if err != nil {
+		return Image{}, err
+	}
+	return find(images, ref)
+}
+
+// Remove removes the image named ref, the blobs and the unpacked layers
+// no other image uses are removed with the last name of the image
+func (s *Store) Remove(ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images, err := s.load()
+	if err != nil {
+		return err
+	}
+	img, err := find(images, ref)
+	if err != nil {
+		return err
+	}
+	var kept []Image
+	blobs := map[string]bool{}
+	for _, i := range images {
+		if i.Name == img.Name {
+			continue
+		}
+		kept = append(kept, i)
+		blobs[i.ID] = true
+		for _, layer := range i.Layers {
+			blobs[layer] = true
+		}
+	}
+	if err := s.save(kept); err != nil {
+		return err
+	}
+	if blobs[img.ID] {
+		return nil
+	}
+	for _, digest := range append([]string{img.ID}, img.Layers...) {
+		if blobs[digest] {
+			continue
+		}
+		if err := os.RemoveAll(s.layerPath(digest)); err != nil {
+			return err
+		}
+		if err := os.Remove(s.blobPath(digest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrNotFound is returned when no image matches a reference
+var ErrNotFound = errors.New("image not found")
+
+func find(images []Image, ref string) (Image, error) {
+	name := normalizeName(ref)
+	for _, img := range images {
+		if img.Name == name || img.ID == ref {
+			return img, nil
+		}
+	}
+	if len(ref) >= 12 {
+		for _, img := range images {
+			if strings.HasPrefix(strings.TrimPrefix(img.ID, "sha256:"), ref) {
+				return img, nil
+			}
+		}
+	}
+	return Image{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+}
+
+// replace adds img to images replacing the image with the same name
+func replace(images []Image, img Image) []Image {
+	for i := range images {
+		if images[i].Name == img.Name {
+			images[i] = img
+			return images
+		}
+	}
+	return append(images, img)
+}
+
+// normalizeName adds the latest tag to names without a tag or a digest
+func normalizeName(name string) string {
+	if strings.Contains(name, "@") || strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		return name
+	}
+	return name + ":latest"
+}
+
+// load reads images.json, the caller must hold mu
+func (s *Store) load() ([]Image, error) {
+	b, err := os.ReadFile(filepath.Join(s.root, "images.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var images []Image
+	if err := json.Unmarshal(b, &images); err != nil {
+		return nil, fmt.Errorf("error parsing images.json: %w", err)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+// save replaces images.json atomically, the caller must hold mu
+func (s *Store) save(images []Image) error {
+	b, err := json.MarshalIndent(images, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.root, ".images.json")
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.root, "images.json"))
+}
+
+// dirSize returns the size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
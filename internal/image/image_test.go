@@ -0,0 +1,382 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"minidocker/internal/archive"
+
+	"golang.org/x/sys/unix"
+)
+
+type entry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+// layer returns a gzip compressed layer archive holding entries
+func layer(t *testing.T, entries ...entry) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, Size: int64(len(e.content)), Linkname: e.linkname}
+		if e.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if e.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			tw.Write([]byte(e.content))
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+// writeBlob adds b to the OCI image layout dir and returns its descriptor
+func writeBlob(t *testing.T, dir, mediaType string, b []byte) map[string]any {
+	sum := sha256.Sum256(b)
+	digest := hex.EncodeToString(sum[:])
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", digest), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]any{"mediaType": mediaType, "digest": "sha256:" + digest, "size": len(b)}
+}
+
+func marshal(t *testing.T, v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// ociLayout writes an OCI image layout named name with layers into dir
+func ociLayout(t *testing.T, dir, name string, layers ...[]byte) {
+	config := writeBlob(t, dir, "application/vnd.oci.image.config.v1+json", marshal(t, map[string]any{
+		"architecture": "amd64",
+		"os":           "linux",
+		"config":       map[string]any{"Entrypoint": []string{"/bin/app"}, "Cmd": []string{"-v"}, "Env": []string{"PATH=/bin"}, "WorkingDir": "/srv"},
+	}))
+	var descriptors []map[string]any
+	for _, l := range layers {
+		descriptors = append(descriptors, writeBlob(t, dir, "application/vnd.oci.image.layer.v1.tar+gzip", l))
+	}
+	manifest := writeBlob(t, dir, "application/vnd.oci.image.manifest.v1+json", marshal(t, map[string]any{
+		"schemaVersion": 2,
+		"config":        config,
+		"layers":        descriptors,
+	}))
+	manifest["annotations"] = map[string]string{annotationRefName: name}
+	index := marshal(t, map[string]any{"schemaVersion": 2, "manifests": []any{manifest}})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportOCILayout(t *testing.T) {
+	layout := filepath.Join(t.TempDir(), "layout")
+	ociLayout(t, layout, "app:1.0",
+		layer(t,
+			entry{name: "bin/", typeflag: tar.TypeDir},
+			entry{name: "bin/app", typeflag: tar.TypeReg, content: "app"},
+			entry{name: "bin/app-link", typeflag: tar.TypeLink, linkname: "bin/app"},
+			entry{name: "etc/", typeflag: tar.TypeDir},
+			entry{name: "etc/removed", typeflag: tar.TypeReg, content: "removed"},
+			entry{name: "etc/replaced", typeflag: tar.TypeReg, content: "v1"},
+			entry{name: "var/cache/old", typeflag: tar.TypeReg, content: "old"},
+			entry{name: "lib", typeflag: tar.TypeSymlink, linkname: "/usr/lib"},
+			entry{name: "escape", typeflag: tar.TypeSymlink, linkname: "../../../.."},
+			// Links are resolved inside the layer
+			entry{name: "lib/libc.so", typeflag: tar.TypeReg, content: "libc"},
+			entry{name: "escape/outside", typeflag: tar.TypeReg, content: "outside"},
+		),
+		layer(t,
+			entry{name: "etc/.wh.removed", typeflag: tar.TypeReg},
+			entry{name: "etc/replaced", typeflag: tar.TypeReg, content: "v2"},
+			entry{name: "var/cache/new", typeflag: tar.TypeReg, content: "new"},
+			entry{name: "var/cache/.wh..wh..opq", typeflag: tar.TypeReg},
+		),
+	)
+
+	// The archive holds the layout directory
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := archive.Write(tw, layout); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	store := NewStore(filepath.Join(t.TempDir(), "images"))
+	images, err := store.Import(buf, "")
+	if err != nil {
+		t.Fatalf("import returned error: %v", err)
+	}
+	if len(images) != 1 || images[0].Name != "app:1.0" || len(images[0].Layers) != 2 {
+		t.Fatalf("expected app:1.0 with 2 layers but %v was imported", images)
+	}
+	expectedConfig := Config{Entrypoint: []string{"/bin/app"}, Cmd: []string{"-v"}, Env: []string{"PATH=/bin"}, WorkingDir: "/srv"}
+	if !reflect.DeepEqual(images[0].Config, expectedConfig) {
+		t.Fatalf("expected configuration %v but %v was found", expectedConfig, images[0].Config)
+	}
+
+	dirs := store.LayerDirs(images[0])
+	if len(dirs) != 2 {
+		t.Fatalf("expected 2 layer directories but %v was returned", dirs)
+	}
+	for file, expected := range map[string]string{
+		filepath.Join(dirs[0], "bin/app"):          "app",
+		filepath.Join(dirs[0], "bin/app-link"):     "app",
+		filepath.Join(dirs[0], "etc/replaced"):     "v1",
+		filepath.Join(dirs[0], "usr/lib/libc.so"):  "libc",
+		filepath.Join(dirs[0], "outside"):          "outside",
+		filepath.Join(dirs[0], "../../../outside"): "",
+		filepath.Join(dirs[1], "etc/replaced"):     "v2",
+		filepath.Join(dirs[1], "var/cache/new"):    "new",
+		filepath.Join(dirs[1], "bin/app"):          "",
+	} {
+		b, err := os.ReadFile(file)
+		if expected == "" {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected %s not to exist", file)
+			}
+			continue
+		}
+		if err != nil || string(b) != expected {
+			t.Fatalf("expected '%s' in %s but '%s' was found: %v", expected, file, b, err)
+		}
+	}
+
+	// Whiteouts are converted to the overlayfs format
+	var stat unix.Stat_t
+	if err := unix.Lstat(filepath.Join(dirs[1], "etc/removed"), &stat); err != nil || stat.Mode&unix.S_IFMT != unix.S_IFCHR || stat.Rdev != 0 {
+		t.Fatalf("expected etc/removed to be a 0:0 character device: %v", err)
+	}
+	opaque := make([]byte, 1)
+	if n, err := unix.Getxattr(filepath.Join(dirs[1], "var/cache"), opaqueXattr, opaque); err != nil || string(opaque[:n]) != "y" {
+		t.Fatalf("expected var/cache to be opaque: %v", err)
+	}
+
+	img, err := store.Get(images[0].ID[len("sha256:") : len("sha256:")+12])
+	if err != nil || img.Name != "app:1.0" {
+		t.Fatalf("expected the image to be found by its short ID: %v", err)
+	}
+	if _, err := store.Get("app"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected app:latest not to be found but %v was returned", err)
+	}
+}
+
+func TestImportDockerArchive(t *testing.T) {
+	dir := t.TempDir()
+	config := marshal(t, map[string]any{"config": map[string]any{"Cmd": []string{"sh"}}})
+	os.WriteFile(filepath.Join(dir, "config.json"), config, 0644)
+	os.MkdirAll(filepath.Join(dir, "base"), 0755)
+	os.WriteFile(filepath.Join(dir, "base", "layer.tar"), layer(t, entry{name: "hello", typeflag: tar.TypeReg, content: "hello"}), 0644)
+	manifest := marshal(t, []map[string]any{{"Config": "config.json", "RepoTags": []string{"base", "base:v1"}, "Layers": []string{"base/layer.tar"}}})
+	os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0644)
+
+	store := NewStore(filepath.Join(t.TempDir(), "images"))
+	if _, err := store.ImportDir(dir, "renamed"); err == nil {
+		t.Fatal("error was expected naming several images")
+	}
+	images, err := store.ImportDir(dir, "")
+	if err != nil {
+		t.Fatalf("import returned error: %v", err)
+	}
+	if len(images) != 2 || images[0].Name != "base:latest" || images[1].Name != "base:v1" || images[0].ID != images[1].ID {
+		t.Fatalf("expected the image to be imported as base:latest and base:v1 but %v was imported", images)
+	}
+
+	// The layers are kept until the last name is removed
+	layerDir := store.LayerDirs(images[1])[0]
+	if err := store.Remove("base"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(layerDir, "hello")); err != nil {
+		t.Fatalf("expected the layer to be kept: %v", err)
+	}
+	if err := store.Remove("base:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(layerDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected the layer to be removed")
+	}
+	if blobs, _ := os.ReadDir(filepath.Join(store.root, "blobs", "sha256")); len(blobs) != 0 {
+		t.Fatalf("expected the blobs to be removed but %d were found", len(blobs))
+	}
+	if images, _ := store.List(); len(images) != 0 {
+		t.Fatalf("expected no image but %v was found", images)
+	}
+
+	// Files of the archive linking outside of it are rejected
+	os.Remove(filepath.Join(dir, "base", "layer.tar"))
+	os.Symlink("/etc/hostname", filepath.Join(dir, "base", "layer.tar"))
+	if _, err := store.ImportDir(dir, ""); err == nil {
+		t.Fatal("error was expected with a layer outside of the archive")
+	}
+}
+
+func TestImportInvalidDigest(t *testing.T) {
+	layout := t.TempDir()
+	ociLayout(t, layout, "app", layer(t, entry{name: "file", typeflag: tar.TypeReg, content: "file"}))
+	blobs, _ := filepath.Glob(filepath.Join(layout, "blobs", "sha256", "*"))
+	for _, blob := range blobs {
+		b, _ := os.ReadFile(blob)
+		if bytes.HasPrefix(b, gzipMagic) {
+			os.WriteFile(blob, layer(t, entry{name: "other", typeflag: tar.TypeReg, content: "other"}), 0644)
+		}
+	}
+	store := NewStore(filepath.Join(t.TempDir(), "images"))
+	if _, err := store.ImportDir(layout, ""); err == nil {
+		t.Fatal("error was expected with a layer not matching its digest")
+	}
+}
+
+func TestApplyLayerInvalidWhiteout(t *testing.T) {
+	for _, name := range []string{".wh.", ".wh..", ".wh...", "etc/.wh..."} {
+		layers := t.TempDir()
+		dir := filepath.Join(layers, "layer")
+		os.MkdirAll(filepath.Join(dir, "etc"), 0755)
+		os.WriteFile(filepath.Join(layers, "other"), []byte("other"), 0644)
+		err := applyLayer(dir, bytes.NewReader(layer(t, entry{name: name, typeflag: tar.TypeReg})))
+		if err == nil {
+			t.Fatalf("expected the whiteout %s to be rejected", name)
+		}
+		if _, err := os.Stat(filepath.Join(layers, "other")); err != nil {
+			t.Fatalf("expected the whiteout %s to keep the files outside of the layer: %v", name, err)
+		}
+		if info, err := os.Stat(filepath.Join(dir, "etc")); err != nil || !info.IsDir() {
+			t.Fatalf("expected the whiteout %s to keep etc: %v", name, err)
+		}
+	}
+}
+
+func TestCommit(t *testing.T) {
+	layout := t.TempDir()
+	ociLayout(t, layout, "base", layer(t,
+		entry{name: "etc/", typeflag: tar.TypeDir},
+		entry{name: "etc/removed", typeflag: tar.TypeReg, content: "removed"},
+		entry{name: "var/cache/old", typeflag: tar.TypeReg, content: "old"},
+	))
+	store := NewStore(filepath.Join(t.TempDir(), "images"))
+	images, err := store.ImportDir(layout, "")
+	if err != nil {
+		t.Fatalf("import returned error: %v", err)
+	}
+
+	// An upper directory as left by overlayfs
+	upper := t.TempDir()
+	os.MkdirAll(filepath.Join(upper, "etc"), 0755)
+	os.MkdirAll(filepath.Join(upper, "var/cache"), 0755)
+	os.WriteFile(filepath.Join(upper, "etc/added"), []byte("added"), 0644)
+	os.Link(filepath.Join(upper, "etc/added"), filepath.Join(upper, "etc/linked"))
+	os.WriteFile(filepath.Join(upper, "var/cache/new"), []byte("new"), 0644)
+	if err := unix.Mknod(filepath.Join(upper, "etc/removed"), unix.S_IFCHR, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Setxattr(filepath.Join(upper, "var/cache"), opaqueXattr, []byte("y"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteLayer(buf, upper, nil); err != nil {
+		t.Fatalf("write layer returned error: %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(buf)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+		if header.Name == "etc/linked" && (header.Typeflag != tar.TypeLink || header.Linkname != "etc/added") {
+			t.Fatalf("expected etc/linked to be a link to etc/added but %v was found", header)
+		}
+	}
+	expected := []string{"etc/", "etc/added", "etc/linked", "etc/.wh.removed", "var/", "var/cache/", "var/cache/.wh..wh..opq", "var/cache/new"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected the layer to hold %v but %v was found", expected, names)
+	}
+
+	img, err := store.Commit(images[0], upper, "derived:1", nil)
+	if err != nil {
+		t.Fatalf("commit returned error: %v", err)
+	}
+	if img.Name != "derived:1" || len(img.Layers) != 2 || img.Layers[0] != images[0].Layers[0] || img.ID == images[0].ID {
+		t.Fatalf("expected derived:1 to extend the layers of base but %v was committed", img)
+	}
+	if !reflect.DeepEqual(img.Config, images[0].Config) {
+		t.Fatalf("expected the configuration of base to be kept but %v was found", img.Config)
+	}
+	b, _ := os.ReadFile(store.blobPath(img.ID))
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil || len(config.RootFS.DiffIDs) != 1 {
+		t.Fatalf("expected the configuration to record the diff ID of the layer: %s", b)
+	}
+	dirs := store.LayerDirs(img)
+	if b, err := os.ReadFile(filepath.Join(dirs[1], "etc/linked")); err != nil || string(b) != "added" {
+		t.Fatalf("expected etc/linked to be unpacked: %v", err)
+	}
+	var stat unix.Stat_t
+	if err := unix.Lstat(filepath.Join(dirs[1], "etc/removed"), &stat); err != nil || stat.Mode&unix.S_IFMT != unix.S_IFCHR {
+		t.Fatalf("expected the whiteout of etc/removed to be unpacked: %v", err)
+	}
+
+	// The layers of base are kept for the committed image
+	if err := store.Remove("base"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dirs[0]); err != nil {
+		t.Fatalf("expected the base layer to be kept: %v", err)
+	}
+}
+
+func TestWriteLayerWhiteoutName(t *testing.T) {
+	for _, name := range []string{".wh.etc", "etc/.wh..wh..opq"} {
+		upper := t.TempDir()
+		os.MkdirAll(filepath.Join(upper, "etc"), 0755)
+		os.WriteFile(filepath.Join(upper, name), nil, 0644)
+		if err := WriteLayer(&bytes.Buffer{}, upper, nil); err == nil {
+			t.Fatalf("expected %s to be refused", name)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"alpine":                      "alpine:latest",
+		"alpine:3.19":                 "alpine:3.19",
+		"localhost:5000/app":          "localhost:5000/app:latest",
+		"localhost:5000/app:v1":       "localhost:5000/app:v1",
+		"app@sha256:0123456789abcdef": "app@sha256:0123456789abcdef",
+	} {
+		if normalized := normalizeName(name); normalized != expected {
+			t.Fatalf("expected %s to be normalized to %s but %s was returned", name, expected, normalized)
+		}
+	}
+}
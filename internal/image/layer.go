@@ -0,0 +1,327 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// whiteoutPrefix marks an entry removing the file of the same name from the lower layers
+	whiteoutPrefix = ".wh."
+	// opaqueWhiteout marks a directory whose content in the lower layers is removed
+	opaqueWhiteout = ".wh..wh..opq"
+	// opaqueXattr marks an opaque directory for overlayfs
+	opaqueXattr = "trusted.overlay.opaque"
+	// userOpaqueXattr marks an opaque directory for an overlayfs mounted with userxattr in a user namespace,
+	// the trusted attributes are reserved to root
+	userOpaqueXattr = "user.overlay.opaque"
+	// maxSymlinks bounds the symbolic links followed resolving a path like the kernel does
+	maxSymlinks = 40
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// applyLayer extracts the layer archive read from r in the empty directory dir, the archive is either
+// uncompressed or gzip compressed. Whiteouts are converted to the overlayfs format: a removed file is
+// a character device 0:0 and an opaque directory has the trusted.overlay.opaque attribute, or user.overlay.opaque
+// when the store is not run by root. Symbolic links are resolved inside dir as if it was /.
+func applyLayer(dir string, r io.Reader) error {
+	r, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	xattr := opaqueXattr
+	if os.Geteuid() != 0 {
+		xattr = userOpaqueXattr
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)
+		if name == "/" {
+			continue
+		}
+		parentName, base := path.Split(name)
+		parent, err := resolveInRoot(dir, parentName)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+
+		if base == opaqueWhiteout {
+			if err := unix.Setxattr(parent, xattr, []byte("y"), 0); err != nil {
+				return fmt.Errorf("error marking %s opaque: %w", parentName, err)
+			}
+			continue
+		}
+		if removed, found := strings.CutPrefix(base, whiteoutPrefix); found {
+			target := filepath.Join(parent, removed)
+			// .wh.. and .wh... would remove parent or the directory holding it
+			if removed == "" || removed == "." || removed == ".." || strings.Contains(removed, "/") || !inDir(dir, target) {
+				return fmt.Errorf("invalid whiteout %s", header.Name)
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			if err := unix.Mknod(target, unix.S_IFCHR, 0); err != nil {
+				return fmt.Errorf("error creating whiteout for %s: %w", path.Join(parentName, removed), err)
+			}
+			continue
+		}
+
+		if err := extractEntry(dir, filepath.Join(parent, base), header, tr); err != nil {
+			return fmt.Errorf("error extracting %s: %w", header.Name, err)
+		}
+	}
+}
+
+// Owners translates the owners of the files of an upper directory to the owners recorded in a layer,
+// like the host ids of a user namespace to the ids of the sandbox. A nil Owners keeps the owners.
+type Owners func(uid, gid int) (int, int)
+
+// WriteLayer writes to w an uncompressed layer archive of the overlayfs upper directory upper,
+// the whiteouts of overlayfs are converted to the whiteout files of the OCI layers and files named like
+// whiteouts are refused
+func WriteLayer(w io.Writer, upper string, owners Owners) error {
+	tw := tar.NewWriter(w)
+	// links maps the inodes of the files with several links to the first name archived
+	links := map[uint64]string{}
+	err := filepath.Walk(upper, func(file string, info fs.FileInfo, err error) error {
+		if err != nil || file == upper {
+			return err
+		}
+		rel, err := filepath.Rel(upper, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		// A file named like a whiteout would remove files from the lower layers once the layer is applied
+		if strings.HasPrefix(info.Name(), whiteoutPrefix) {
+			return fmt.Errorf("%s can not be archived: its name is reserved to whiteouts", name)
+		}
+		st, _ := info.Sys().(*syscall.Stat_t)
+
+		if info.Mode()&fs.ModeCharDevice != 0 && st != nil && st.Rdev == 0 {
+			dir, base := path.Split(name)
+			return tw.WriteHeader(&tar.Header{Name: dir + whiteoutPrefix + base, Typeflag: tar.TypeReg, ModTime: info.ModTime()})
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if owners != nil {
+			header.Uid, header.Gid = owners(header.Uid, header.Gid)
+		}
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if info.Mode().IsRegular() && st != nil && st.Nlink > 1 {
+			if first, found := links[st.Ino]; found {
+				header.Typeflag, header.Linkname, header.Size = tar.TypeLink, first, 0
+			} else {
+				links[st.Ino] = name
+			}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			opaque := make([]byte, 1)
+			for _, xattr := range []string{opaqueXattr, userOpaqueXattr} {
+				if n, err := unix.Lgetxattr(file, xattr, opaque); err == nil && string(opaque[:n]) == "y" {
+					return tw.WriteHeader(&tar.Header{Name: name + "/" + opaqueWhiteout, Typeflag: tar.TypeReg, ModTime: info.ModTime()})
+				}
+			}
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// decompress detects the compression of the layer archive read from r
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, fmt.Errorf("zstd compressed layers are not supported")
+	}
+	return br, nil
+}
+
+// extractEntry creates target as described by header, an entry replaces the file found
+// at target except directories whose content is merged
+func extractEntry(root, target string, header *tar.Header, r io.Reader) error {
+	if info, err := os.Lstat(target); err == nil && !(info.IsDir() && header.Typeflag == tar.TypeDir) {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+
+	info := header.FileInfo()
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(target, 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	case tar.TypeReg:
+		// O_NOFOLLOW prevents writing through a symbolic link placed at target
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY|unix.O_NOFOLLOW, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		return lchown(target, header, os.Symlink(header.Linkname, target))
+	case tar.TypeLink:
+		linkDir, linkBase := path.Split(path.Clean("/" + header.Linkname))
+		parent, err := resolveInRoot(root, linkDir)
+		if err != nil {
+			return err
+		}
+		// A hard link shares the attributes of the file it links to
+		return os.Link(filepath.Join(parent, linkBase), target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		mode := uint32(info.Mode().Perm())
+		switch header.Typeflag {
+		case tar.TypeChar:
+			mode |= unix.S_IFCHR
+		case tar.TypeBlock:
+			mode |= unix.S_IFBLK
+		default:
+			mode |= unix.S_IFIFO
+		}
+		err := unix.Mknod(target, mode, int(unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))))
+		if errors.Is(err, unix.EPERM) {
+			// Device nodes can not be created without privileges, the sandbox provides /dev
+			return nil
+		} else if err != nil {
+			return err
+		}
+	default:
+		// Global headers and other metadata entries create no file
+		return nil
+	}
+
+	if err := lchown(target, header, nil); err != nil {
+		return err
+	}
+	// The permissions are set after the owner as chown clears the setuid and setgid bits
+	if err := os.Chmod(target, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(target, time.Time{}, header.ModTime)
+}
+
+// lchown sets the owner recorded in header unless err reports that target could not be created
+func lchown(target string, header *tar.Header, err error) error {
+	if err != nil {
+		return err
+	}
+	if err := os.Lchown(target, header.Uid, header.Gid); err != nil && !errors.Is(err, unix.EPERM) {
+		return err
+	}
+	return nil
+}
+
+// inDir reports whether file is below dir
+func inDir(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveInRoot returns the path of name inside root following the symbolic links as if root was /,
+// like the kernel does after chroot a link can not lead outside of root as .. stops at /.
+func resolveInRoot(root, name string) (string, error) {
+	resolved := "/"
+	components := strings.Split(name, "/")
+	links := 0
+	for len(components) > 0 {
+		c := components[0]
+		components = components[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, c)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("too many symbolic links resolving %s", name)
+		}
+		link, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(link) {
+			resolved = "/"
+		}
+		components = append(strings.Split(link, "/"), components...)
+	}
+	return filepath.Join(root, resolved), nil
+}
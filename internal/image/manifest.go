@@ -0,0 +1,214 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	annotationImageName  = "io.containerd.image.name"
+	annotationRefName    = "org.opencontainers.image.ref.name"
+	maxNestedIndexLevels = 4
+)
+
+// manifest locates the files of an image in an image layout or a docker save archive
+type manifest struct {
+	name string
+	// config and layers are the paths of the configuration and the layer archives
+	config string
+	layers []string
+	// configDigest and layerDigests are the expected digests, empty when the format does not record them
+	configDigest string
+	layerDigests []string
+}
+
+// descriptor references a blob of an OCI image layout
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// readManifests lists the images of the OCI image layout or of the extracted docker save archive in dir
+func readManifests(dir string) ([]manifest, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return readOCIManifests(dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+		return readDockerManifests(dir)
+	}
+	return nil, fmt.Errorf("neither index.json nor manifest.json was found, the archive is not an OCI image layout or a docker save archive")
+}
+
+// readOCIManifests reads the manifests referenced by index.json, an image index
+// selects the manifest of the platform of the host
+func readOCIManifests(dir string) ([]manifest, error) {
+	var index struct {
+		Manifests []descriptor `json:"manifests"`
+	}
+	if err := readJSON(filepath.Join(dir, "index.json"), &index); err != nil {
+		return nil, err
+	}
+	var manifests []manifest
+	for _, d := range index.Manifests {
+		name := d.Annotations[annotationImageName]
+		if name == "" {
+			name = d.Annotations[annotationRefName]
+		}
+		m, err := readOCIManifest(dir, d, 0)
+		if err != nil {
+			return nil, err
+		}
+		m.name = name
+		manifests = append(manifests, m)
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("index.json lists no image")
+	}
+	return manifests, nil
+}
+
+func readOCIManifest(dir string, d descriptor, level int) (manifest, error) {
+	path, err := blobFile(dir, d.Digest)
+	if err != nil {
+		return manifest{}, err
+	}
+	if d.MediaType == mediaTypeOCIIndex || d.MediaType == mediaTypeDockerList {
+		if level == maxNestedIndexLevels {
+			return manifest{}, fmt.Errorf("too many nested image indexes")
+		}
+		var index struct {
+			Manifests []descriptor `json:"manifests"`
+		}
+		if err := readJSON(path, &index); err != nil {
+			return manifest{}, err
+		}
+		for _, m := range index.Manifests {
+			if m.Platform == nil || (m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH) {
+				return readOCIManifest(dir, m, level+1)
+			}
+		}
+		return manifest{}, fmt.Errorf("the image index %s has no manifest for %s/%s", d.Digest, runtime.GOOS, runtime.GOARCH)
+	}
+
+	var image struct {
+		Config descriptor   `json:"config"`
+		Layers []descriptor `json:"layers"`
+	}
+	if err := readJSON(path, &image); err != nil {
+		return manifest{}, err
+	}
+	m := manifest{configDigest: image.Config.Digest}
+	if m.config, err = blobFile(dir, image.Config.Digest); err != nil {
+		return manifest{}, err
+	}
+	for _, layer := range image.Layers {
+		file, err := blobFile(dir, layer.Digest)
+		if err != nil {
+			return manifest{}, err
+		}
+		m.layers = append(m.layers, file)
+		m.layerDigests = append(m.layerDigests, layer.Digest)
+	}
+	return m, nil
+}
+
+// blobFile returns the path of the blob digest in the OCI image layout dir, only sha256 is supported
+func blobFile(dir, digest string) (string, error) {
+	hex, found := strings.CutPrefix(digest, "sha256:")
+	if !found || len(hex) != 64 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	return resolveFile(dir, filepath.Join("blobs", "sha256", hex))
+}
+
+// readDockerManifests reads manifest.json of a docker save archive, an image
+// tagged several times is listed once per tag
+func readDockerManifests(dir string) ([]manifest, error) {
+	var images []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := readJSON(filepath.Join(dir, "manifest.json"), &images); err != nil {
+		return nil, err
+	}
+	var manifests []manifest
+	for _, img := range images {
+		m := manifest{}
+		var err error
+		if m.config, err = archiveFile(dir, img.Config); err != nil {
+			return nil, err
+		}
+		for _, layer := range img.Layers {
+			file, err := archiveFile(dir, layer)
+			if err != nil {
+				return nil, err
+			}
+			m.layers = append(m.layers, file)
+			m.layerDigests = append(m.layerDigests, "")
+		}
+		if len(img.RepoTags) == 0 {
+			manifests = append(manifests, m)
+		}
+		for _, tag := range img.RepoTags {
+			m.name = tag
+			manifests = append(manifests, m)
+		}
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("manifest.json lists no image")
+	}
+	return manifests, nil
+}
+
+// archiveFile returns the path of name in dir, names escaping dir are rejected
+func archiveFile(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name %q in manifest.json", name)
+	}
+	return resolveFile(dir, clean)
+}
+
+// resolveFile returns the path of the file name in dir with the symbolic links resolved,
+// like the layers shared by the images of a docker save archive, links leaving dir are rejected
+func resolveFile(dir, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return "", fmt.Errorf("%s is missing", name)
+	}
+	if !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s links outside of the image", name)
+	}
+	return resolved, nil
+}
+
+func readJSON(file string, v any) error {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s is missing", filepath.Base(file))
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", filepath.Base(file), err)
+	}
+	return nil
+}
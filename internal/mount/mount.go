@@ -2,8 +2,12 @@ package mount
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -38,3 +42,149 @@ func ReadRootFSMount(reader *bufio.Reader) (uint, uint, error) {
 	}
 	return 0, 0, fmt.Errorf("no root device found")
 }
+
+// Bind describes a host path mounted in the sandbox
+type Bind struct {
+	// Source is the host path
+	Source string
+	// Target is the path of the mount in the sandbox
+	Target string
+	// ReadOnly mounts the source and its submounts read only
+	ReadOnly bool
+	// Propagation is the propagation type of the mount: private, rprivate, slave, rslave, shared or rshared
+	Propagation string
+}
+
+// Tmpfs describes a memory backed filesystem mounted in the sandbox, it is always mounted nodev
+type Tmpfs struct {
+	// Target is the path of the mount in the sandbox
+	Target string
+	// Size caps the size of the filesystem in bytes, writes beyond it fail with ENOSPC.
+	// 0 leaves the kernel default of half of the memory of the host.
+	Size uint64
+	// Mode is the permissions of the root directory of the filesystem, 0 keeps the default 1777
+	Mode uint32
+	// NoExec prevents executing the files of the filesystem
+	NoExec bool
+	// NoSuid ignores the set-user-ID and set-group-ID bits of the files of the filesystem
+	NoSuid bool
+}
+
+// IDMap maps Size consecutive ids starting at ContainerID in a user namespace to the host ids starting at HostID
+type IDMap struct {
+	ContainerID int
+	HostID      int
+	Size        int
+}
+
+// MountPoint represents a mount as described by a line of /proc/self/mountinfo
+type MountPoint struct {
+	// Major and Minor identify the device holding the filesystem
+	Major uint
+	Minor uint
+	// Root is the directory of the filesystem mounted at Path
+	Root string
+	// Path is the mount point
+	Path string
+	// FSType is the filesystem type like ext4
+	FSType string
+	// Source is the filesystem specific source like /dev/sda1
+	Source string
+}
+
+// ReadMountPoints parses the mountinfo format described in proc(5)
+func ReadMountPoints(r io.Reader) ([]MountPoint, error) {
+	var mounts []MountPoint
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+		if len(tokens) == 0 {
+			continue
+		}
+		// Optional fields end with a single hyphen followed by fstype and source
+		separator := -1
+		for i := 6; i < len(tokens); i++ {
+			if tokens[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 0 || len(tokens) < separator+3 {
+			return nil, fmt.Errorf("the kernel may be wrong, invalid mountinfo line: %s", scanner.Text())
+		}
+		var m MountPoint
+		if _, err := fmt.Sscanf(tokens[2], "%d:%d", &m.Major, &m.Minor); err != nil {
+			return nil, fmt.Errorf("the kernel may be wrong, invalid maj:min %s: %w", tokens[2], err)
+		}
+		m.Root = unescapeMountPath(tokens[3])
+		m.Path = unescapeMountPath(tokens[4])
+		m.FSType = tokens[separator+1]
+		m.Source = tokens[separator+2]
+		mounts = append(mounts, m)
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space) used by mountinfo
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// FindMountPoint returns the mount holding path, when several filesystems are stacked
+// on the same mount point the last one mounted is visible and is returned. The symbolic links
+// of path must be resolved as the mount points are compared as strings.
+func FindMountPoint(mounts []MountPoint, path string) (*MountPoint, error) {
+	path = filepath.Clean(path)
+	var found *MountPoint
+	for i := range mounts {
+		m := &mounts[i]
+		if m.Path != "/" && path != m.Path && !strings.HasPrefix(path, m.Path+"/") {
+			continue
+		}
+		if found == nil || len(m.Path) >= len(found.Path) {
+			found = m
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no mount point found for %s", path)
+	}
+	return found, nil
+}
+
+// WholeDisk validates the block device major:minor against the sysfs directory sysBlock, normally /sys/dev/block,
+// and returns the disk holding it when the device is a partition as io.max does not accept partitions.
+func WholeDisk(sysBlock string, major, minor uint) (uint, uint, error) {
+	device, err := filepath.EvalSymlinks(filepath.Join(sysBlock, fmt.Sprintf("%d:%d", major, minor)))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%d:%d is not a block device: %w", major, minor, err)
+	}
+	if _, err := os.Stat(filepath.Join(device, "partition")); errors.Is(err, fs.ErrNotExist) {
+		return major, minor, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+	// The partition directory is nested in the disk directory
+	b, err := os.ReadFile(filepath.Join(filepath.Dir(device), "dev"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading the disk of partition %d:%d: %w", major, minor, err)
+	}
+	var diskMajor, diskMinor uint
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(b)), "%d:%d", &diskMajor, &diskMinor); err != nil {
+		return 0, 0, fmt.Errorf("invalid device number %q: %w", b, err)
+	}
+	return diskMajor, diskMinor, nil
+}
@@ -4,18 +4,59 @@ package mount
 
 import (
 	"fmt"
+	"os"
 	"syscall"
 )
 
 // NOTE: This is just to make me able to build the project on darwin
 
 // NoAction mount for non-linux builds
-func HideMounts() error {
+func HideMounts(_ []Bind, _ []Tmpfs) error {
 	return nil
 }
 
+func PivotRoot(_ string, _ []Bind, _ []Tmpfs) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func ReadOnlyRoot(_ []Bind, _ []Tmpfs) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func DropCapabilities() error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func DropFilePermissionCapabilities() error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func MountOverlay(_ string, _ []string, _, _ string, _ bool) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func SetFilesystemIDs(_, _ int) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func MountLoop(_, _, _ string) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
+func IsMountPoint(_ string) (bool, error) {
+	return false, fmt.Errorf("not supported on darwin")
+}
+
+func OpenIDMapped(_ string, _ int) (*os.File, error) {
+	return nil, fmt.Errorf("not supported on darwin")
+}
+
+func AttachMount(_ *os.File, _ string) error {
+	return fmt.Errorf("not supported on darwin")
+}
+
 // newSysProcAttr returns default struct for non-linux builds
-func NewSysProcAttr(_ int) *syscall.SysProcAttr {
+func NewSysProcAttr(_ int, _, _ []IDMap) *syscall.SysProcAttr {
 	return &syscall.SysProcAttr{}
 }
 
@@ -23,6 +64,10 @@ func GetRootDeviceMajorMinor() (uint, uint, error) {
 	return 0, 0, fmt.Errorf("not supported on darwin")
 }
 
+func ResolveBlockDevice(_ string) (uint, uint, error) {
+	return 0, 0, fmt.Errorf("not supported on darwin")
+}
+
 func SetRootMountPrivate() error {
 	return nil
 }
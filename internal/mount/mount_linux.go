@@ -5,39 +5,654 @@ package mount
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
+const sysBlockPath = "/sys/dev/block"
+
 // HideMounts makes all mounts points private (MS_REC) so that the child can then mount tmpfs/proc or any other fs
-// without spilling in the root mount namespace
-func HideMounts() error {
+// without spilling in the root mount namespace. The sandbox gets its own /proc, a read only /sys, a minimal /dev
+// and the filesystems of tmpfs, then the host paths of binds are mounted. The targets must exist.
+func HideMounts(binds []Bind, tmpfs []Tmpfs) error {
 	// Recursively shop sharing mounts
 	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
 		return fmt.Errorf("could not make / private: %v", err)
 	}
+	// The sources are opened before /tmp and /dev are hidden
+	sources, err := openSources(binds)
+	if err != nil {
+		return err
+	}
+	defer closeSources(sources)
+	devSources, err := openSources(deviceBinds)
+	if err != nil {
+		return err
+	}
+	defer closeSources(devSources)
 	// Then mount the process proc fs in /proc
 	if err := unix.Mount("", "/proc", "proc", 0, ""); err != nil {
 		return fmt.Errorf("error mounting /proc: %v", err)
 	}
-	// Then mount the process tmpfs in /tmp
-	if err := unix.Mount("", "/tmp", "tmpfs", 0, ""); err != nil {
-		return fmt.Errorf("error mounting /tmp: %v", err)
+	// The sysfs of the network namespace of the process replaces the one of the host
+	if err := unix.Mount("sysfs", "/sys", "sysfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("error mounting /sys: %v", err)
+	}
+	if err := mountDev(devSources); err != nil {
+		return err
+	}
+	if err := maskPaths(); err != nil {
+		return err
+	}
+	// Then mount the process tmpfs like /tmp
+	if err := mountTmpfs(tmpfs, false); err != nil {
+		return err
+	}
+	return bindMounts(binds, sources, false)
+}
+
+// rootFSMounts are the kernel filesystems mounted in the new root filesystem by PivotRoot
+var rootFSMounts = []struct {
+	source string
+	target string
+	fstype string
+	flags  uintptr
+}{
+	{"proc", "/proc", "proc", unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	{"sysfs", "/sys", "sysfs", unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+}
+
+// PivotRoot makes root the root filesystem of the calling process with its own /proc, a read only /sys,
+// a minimal /dev, the filesystems of tmpfs and the host paths of binds. The previous root is detached so
+// that the host filesystem can no longer be reached. Missing targets are created in root.
+func PivotRoot(root string, binds []Bind, tmpfs []Tmpfs) error {
+	if err := unix.Mount("", "/", "", unix.MS_PRIVATE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("could not make / private: %w", err)
+	}
+	// The sources are opened before the host filesystem is detached
+	sources, err := openSources(binds)
+	if err != nil {
+		return err
+	}
+	defer closeSources(sources)
+	devSources, err := openSources(deviceBinds)
+	if err != nil {
+		return err
+	}
+	defer closeSources(devSources)
+	// pivot_root requires the new root to be a mount point
+	if err := unix.Mount(root, root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("error bind mounting %s: %w", root, err)
+	}
+	oldRoot, err := os.MkdirTemp(root, ".oldroot")
+	if err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(root, oldRoot); err != nil {
+		os.Remove(oldRoot)
+		return fmt.Errorf("error pivoting to %s: %w", root, err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	oldRoot = "/" + filepath.Base(oldRoot)
+
+	// The mounts are created once in the new root so that its symbolic links can not point them to the host
+	for _, m := range rootFSMounts {
+		if err := os.MkdirAll(m.target, 0755); err != nil {
+			return err
+		}
+		if err := unix.Mount(m.source, m.target, m.fstype, m.flags, ""); err != nil {
+			return fmt.Errorf("error mounting %s: %w", m.target, err)
+		}
+	}
+	if err := os.MkdirAll("/dev", 0755); err != nil {
+		return err
+	}
+	if err := mountDev(devSources); err != nil {
+		return err
+	}
+	if err := maskPaths(); err != nil {
+		return err
+	}
+	if err := mountTmpfs(tmpfs, true); err != nil {
+		return err
+	}
+
+	if err := bindMounts(binds, sources, true); err != nil {
+		return err
+	}
+
+	if err := unix.Unmount(oldRoot, unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("error detaching the previous root: %w", err)
+	}
+	return os.Remove(oldRoot)
+}
+
+// deviceBinds are the host devices bind mounted in the minimal /dev of the sandbox, binding them
+// rather than creating the nodes keeps the device cgroup and the host permissions in charge
+var deviceBinds = []Bind{
+	{Source: "/dev/null", Target: "/dev/null", Propagation: "private"},
+	{Source: "/dev/zero", Target: "/dev/zero", Propagation: "private"},
+	{Source: "/dev/full", Target: "/dev/full", Propagation: "private"},
+	{Source: "/dev/random", Target: "/dev/random", Propagation: "private"},
+	{Source: "/dev/urandom", Target: "/dev/urandom", Propagation: "private"},
+	{Source: "/dev/tty", Target: "/dev/tty", Propagation: "private"},
+}
+
+// devLinks are the symbolic links of the minimal /dev
+var devLinks = [][2]string{
+	{"pts/ptmx", "/dev/ptmx"},
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+}
+
+// mountDev replaces /dev with a tmpfs holding the devices of deviceBinds, opened as devSources by openSources,
+// an instance of devpts of its own and an empty /dev/shm
+func mountDev(devSources []*os.File) error {
+	if err := unix.Mount("tmpfs", "/dev", "tmpfs", unix.MS_NOSUID|unix.MS_STRICTATIME, "mode=755,size=65536k"); err != nil {
+		return fmt.Errorf("error mounting /dev: %w", err)
+	}
+	if err := bindMounts(deviceBinds, devSources, true); err != nil {
+		return err
+	}
+	for _, dir := range []string{"/dev/pts", "/dev/shm"} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// newinstance keeps the terminals of the sandbox apart from the ones of the host
+	if err := unix.Mount("devpts", "/dev/pts", "devpts", unix.MS_NOSUID|unix.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620"); err != nil {
+		return fmt.Errorf("error mounting /dev/pts: %w", err)
+	}
+	if err := unix.Mount("shm", "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777,size=65536k"); err != nil {
+		return fmt.Errorf("error mounting /dev/shm: %w", err)
+	}
+	for _, link := range devLinks {
+		if err := os.Symlink(link[0], link[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountTmpfs mounts the filesystems of tmpfs, create creates the missing targets
+func mountTmpfs(tmpfs []Tmpfs, create bool) error {
+	for _, t := range tmpfs {
+		if create {
+			if err := os.MkdirAll(t.Target, 0755); err != nil {
+				return fmt.Errorf("error creating mount target %s: %w", t.Target, err)
+			}
+		}
+		flags := uintptr(unix.MS_NODEV)
+		if t.NoExec {
+			flags |= unix.MS_NOEXEC
+		}
+		if t.NoSuid {
+			flags |= unix.MS_NOSUID
+		}
+		var options []string
+		if t.Size != 0 {
+			options = append(options, fmt.Sprintf("size=%d", t.Size))
+		}
+		if t.Mode != 0 {
+			options = append(options, fmt.Sprintf("mode=%o", t.Mode))
+		}
+		if err := unix.Mount("tmpfs", t.Target, "tmpfs", flags, strings.Join(options, ",")); err != nil {
+			return fmt.Errorf("error mounting tmpfs on %s: %w", t.Target, err)
+		}
+	}
+	return nil
+}
+
+// sandboxWritablePaths are the kernel filesystems of the sandbox left writable by ReadOnlyRoot
+var sandboxWritablePaths = []string{"/proc", "/dev/pts", "/dev/shm"}
+
+// ReadOnlyRoot makes all the mounts of the sandbox read only but /proc, the terminals, /dev/shm, the filesystems
+// of tmpfs and the binds that are not read only. Those writable paths are made noexec, nosuid and nodev so that
+// a process can not execute what it writes. It runs once the sandbox is mounted, the submounts of binds and
+// a bind mounted under another one keep the mode of their own bind.
+func ReadOnlyRoot(binds []Bind, tmpfs []Tmpfs) error {
+	if err := unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return fmt.Errorf("error making / read only: %w", err)
+	}
+	writable := &unix.MountAttr{
+		Attr_set: unix.MOUNT_ATTR_NOEXEC | unix.MOUNT_ATTR_NOSUID | unix.MOUNT_ATTR_NODEV,
+		Attr_clr: unix.MOUNT_ATTR_RDONLY,
+	}
+	paths := slices.Clone(sandboxWritablePaths)
+	for _, t := range tmpfs {
+		paths = append(paths, t.Target)
+	}
+	for _, path := range paths {
+		if err := unix.MountSetattr(unix.AT_FDCWD, path, 0, writable); err != nil {
+			return fmt.Errorf("error making %s writable: %w", path, err)
+		}
+	}
+	// The binds are walked in mount order so that the nested ones are set last
+	for _, b := range binds {
+		attr := writable
+		if b.ReadOnly {
+			attr = &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+		}
+		if err := unix.MountSetattr(unix.AT_FDCWD, b.Target, unix.AT_RECURSIVE, attr); err != nil {
+			return fmt.Errorf("error setting the mode of %s: %w", b.Target, err)
+		}
+	}
+	return nil
+}
+
+// sandboxCapabilities are the capabilities a hardened process keeps, the default set of runc without CAP_MKNOD.
+// The others let a process change the mounts of the sandbox, reach the files of the host through file handles,
+// the block devices or the kernel, or change host settings like the clock.
+var sandboxCapabilities = []uintptr{
+	unix.CAP_AUDIT_WRITE,
+	unix.CAP_CHOWN,
+	unix.CAP_DAC_OVERRIDE,
+	unix.CAP_FOWNER,
+	unix.CAP_FSETID,
+	unix.CAP_KILL,
+	unix.CAP_NET_BIND_SERVICE,
+	unix.CAP_NET_RAW,
+	unix.CAP_SETFCAP,
+	unix.CAP_SETGID,
+	unix.CAP_SETPCAP,
+	unix.CAP_SETUID,
+	unix.CAP_SYS_CHROOT,
+}
+
+// DropCapabilities removes the capabilities but sandboxCapabilities from the bounding, effective, permitted,
+// inheritable and ambient sets of the calling thread and sets no_new_privs, so that the command it executes can not
+// undo ReadOnlyRoot nor regain the capabilities through a set-user-ID or file capability executable. The thread
+// must be locked and execute the command.
+func DropCapabilities() error {
+	var dropped []uintptr
+	// The bounding set can not be read past the last capability of the kernel
+	for c := uintptr(0); ; c++ {
+		if _, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, c, 0, 0, 0); errors.Is(err, unix.EINVAL) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error reading the bounding set: %w", err)
+		}
+		if slices.Contains(sandboxCapabilities, c) {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+			return fmt.Errorf("error dropping capability %d from the bounding set: %w", c, err)
+		}
+		dropped = append(dropped, c)
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("error clearing the ambient capabilities: %w", err)
+	}
+	if err := dropCapabilities(dropped); err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("error setting no_new_privs: %w", err)
+	}
+	return nil
+}
+
+// filePermissionCapabilities bypass the permission checks of the files: CAP_DAC_OVERRIDE reads and writes
+// any file and CAP_DAC_READ_SEARCH reads any file and opens any file handle with open_by_handle_at
+var filePermissionCapabilities = []uintptr{unix.CAP_DAC_OVERRIDE, unix.CAP_DAC_READ_SEARCH}
+
+// DropFilePermissionCapabilities removes filePermissionCapabilities from the effective, permitted and inheritable
+// sets of the calling thread so that it accesses the files with the permissions of its filesystem ids.
+// The thread must be locked and not reused.
+func DropFilePermissionCapabilities() error {
+	return dropCapabilities(filePermissionCapabilities)
+}
+
+// dropCapabilities removes caps from the effective, permitted and inheritable sets of the calling thread
+func dropCapabilities(caps []uintptr) error {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return fmt.Errorf("error reading capabilities: %w", err)
+	}
+	for _, c := range caps {
+		mask := ^uint32(1 << (c % 32))
+		data[c/32].Effective &= mask
+		data[c/32].Permitted &= mask
+		data[c/32].Inheritable &= mask
+	}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("error dropping capabilities: %w", err)
+	}
+	return nil
+}
+
+// maskedPaths expose the host or its kernel and are hidden like runc does by default:
+// directories are covered by an empty read only tmpfs and files by /dev/null
+var maskedPaths = []string{
+	"/proc/acpi",
+	"/proc/asound",
+	"/proc/interrupts",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// readOnlyPaths can change the settings of the host kernel and are made read only like runc does by default
+var readOnlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// maskPaths hides maskedPaths and makes readOnlyPaths read only, the paths missing from the kernel are skipped
+func maskPaths() error {
+	for _, path := range maskedPaths {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			err = unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "")
+		} else {
+			err = unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("error masking %s: %w", path, err)
+		}
+	}
+	for _, path := range readOnlyPaths {
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); errors.Is(err, unix.ENOENT) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error mounting %s: %w", path, err)
+		}
+		attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY | unix.MOUNT_ATTR_NOSUID | unix.MOUNT_ATTR_NODEV | unix.MOUNT_ATTR_NOEXEC}
+		if err := unix.MountSetattr(unix.AT_FDCWD, path, unix.AT_RECURSIVE, attr); err != nil {
+			return fmt.Errorf("error making %s read only: %w", path, err)
+		}
 	}
 	return nil
 }
 
+// propagationFlags are the mount flags of the propagation types of Bind
+var propagationFlags = map[string]uintptr{
+	"private":  unix.MS_PRIVATE,
+	"rprivate": unix.MS_PRIVATE | unix.MS_REC,
+	"slave":    unix.MS_SLAVE,
+	"rslave":   unix.MS_SLAVE | unix.MS_REC,
+	"shared":   unix.MS_SHARED,
+	"rshared":  unix.MS_SHARED | unix.MS_REC,
+}
+
+// openSources opens the sources of binds with O_PATH so that they can be mounted once the host paths are hidden.
+// The sources must not contain symbolic links: the caller checked them and a component replaced by a link
+// since then is refused, the path of every source opened is checked again as a rename could move it.
+func openSources(binds []Bind) ([]*os.File, error) {
+	sources := make([]*os.File, 0, len(binds))
+	for _, b := range binds {
+		f, err := openSource(b.Source)
+		if err != nil {
+			closeSources(sources)
+			return nil, fmt.Errorf("invalid mount source: %w", err)
+		}
+		sources = append(sources, f)
+	}
+	return sources, nil
+}
+
+func openSource(source string) (*os.File, error) {
+	how := &unix.OpenHow{Flags: unix.O_PATH | unix.O_CLOEXEC, Resolve: unix.RESOLVE_NO_SYMLINKS}
+	fd, err := unix.Openat2(unix.AT_FDCWD, source, how)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: source, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), source)
+	opened, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if opened != filepath.Clean(source) {
+		f.Close()
+		return nil, fmt.Errorf("%s was moved to %s", source, opened)
+	}
+	return f, nil
+}
+
+func closeSources(sources []*os.File) {
+	for _, f := range sources {
+		f.Close()
+	}
+}
+
+// bindMounts mounts sources, opened by openSources, on the targets of binds through /proc/self/fd.
+// create creates the missing targets like the sources, a directory or an empty file.
+func bindMounts(binds []Bind, sources []*os.File, create bool) error {
+	for i, b := range binds {
+		flags, found := propagationFlags[b.Propagation]
+		if !found {
+			return fmt.Errorf("invalid propagation %s for %s", b.Propagation, b.Target)
+		}
+		info, err := sources[i].Stat()
+		if err != nil {
+			return fmt.Errorf("invalid mount source: %w", err)
+		}
+		if _, err := os.Stat(b.Target); errors.Is(err, fs.ErrNotExist) && create {
+			if err := createTarget(b.Target, info.IsDir()); err != nil {
+				return fmt.Errorf("error creating mount target %s: %w", b.Target, err)
+			}
+		}
+		source := fmt.Sprintf("/proc/self/fd/%d", sources[i].Fd())
+		if err := unix.Mount(source, b.Target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("error mounting %s on %s: %w", b.Source, b.Target, err)
+		}
+		if b.ReadOnly {
+			// The submounts of the source are read only as well
+			attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+			if err := unix.MountSetattr(unix.AT_FDCWD, b.Target, unix.AT_RECURSIVE, attr); err != nil {
+				return fmt.Errorf("error making %s read only: %w", b.Target, err)
+			}
+		}
+		if err := unix.Mount("", b.Target, "", flags, ""); err != nil {
+			return fmt.Errorf("error setting the propagation of %s: %w", b.Target, err)
+		}
+	}
+	return nil
+}
+
+// createTarget creates the mount point target of a directory or of a file
+func createTarget(target string, dir bool) error {
+	if dir {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// MountOverlay mounts at target an overlayfs stacking the read only directories lower, the top layer first,
+// under the writable directory upper. work must be an empty directory on the filesystem of upper.
+// The mounts are made private first so that the overlay does not propagate to the host. userXattr keeps
+// the overlayfs attributes in the user.overlay namespace for an overlay mounted in a user namespace.
+func MountOverlay(target string, lower []string, upper, work string, userXattr bool) error {
+	if err := unix.Mount("", "/", "", unix.MS_PRIVATE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("could not make / private: %w", err)
+	}
+	for _, dir := range append(slices.Clone(lower), upper, work) {
+		// overlayfs splits its options on commas and lowerdir on colons
+		if strings.ContainsAny(dir, ",:") {
+			return fmt.Errorf("invalid overlay directory %s", dir)
+		}
+	}
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(lower, ":"), upper, work)
+	if userXattr {
+		options += ",userxattr"
+	}
+	if err := unix.Mount("overlay", target, "overlay", 0, options); err != nil {
+		return fmt.Errorf("error mounting overlay at %s: %w", target, err)
+	}
+	return nil
+}
+
+// secbitNoSetuidFixup keeps the capabilities of a thread whose filesystem uid changes from 0, see capabilities(7)
+const secbitNoSetuidFixup = 1 << 2
+
+// SetFilesystemIDs changes the filesystem uid and gid of the calling thread, keeping its capabilities, so that
+// it can work on the filesystems of a user namespace mapping its root to uid and gid: the kernel refuses to
+// create files owned by ids a filesystem does not map. The thread must be locked and not reused.
+func SetFilesystemIDs(uid, gid int) error {
+	bits, err := unix.PrctlRetInt(unix.PR_GET_SECUREBITS, 0, 0, 0, 0)
+	if err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_SET_SECUREBITS, uintptr(bits|secbitNoSetuidFixup), 0, 0, 0); err != nil {
+		return fmt.Errorf("error keeping the capabilities of the thread: %w", err)
+	}
+	if err := unix.Setfsgid(gid); err != nil {
+		return err
+	}
+	return unix.Setfsuid(uid)
+}
+
+// loopAttempts bounds the retries when a free loop device is taken by another process before it is configured
+const loopAttempts = 5
+
+// MountLoop mounts the filesystem image file of type fstype at target through a loop device,
+// the device is released when target is unmounted
+func MountLoop(file, target, fstype string) error {
+	control, err := os.OpenFile("/dev/loop-control", os.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer control.Close()
+	backing, err := os.OpenFile(file, os.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer backing.Close()
+
+	for attempt := 0; ; attempt++ {
+		n, err := unix.IoctlRetInt(int(control.Fd()), unix.LOOP_CTL_GET_FREE)
+		if err != nil {
+			return fmt.Errorf("error finding a free loop device: %w", err)
+		}
+		device := fmt.Sprintf("/dev/loop%d", n)
+		loop, err := os.OpenFile(device, os.O_RDWR|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		config := &unix.LoopConfig{Fd: uint32(backing.Fd())}
+		config.Info.Flags = unix.LO_FLAGS_AUTOCLEAR
+		err = unix.IoctlLoopConfigure(int(loop.Fd()), config)
+		if errors.Is(err, unix.EBUSY) && attempt < loopAttempts {
+			loop.Close()
+			continue
+		} else if err != nil {
+			loop.Close()
+			return fmt.Errorf("error configuring %s: %w", device, err)
+		}
+		err = unix.Mount(device, target, fstype, unix.MS_NOSUID|unix.MS_NODEV, "")
+		// The device is cleared once it is closed and unmounted
+		loop.Close()
+		if err != nil {
+			return fmt.Errorf("error mounting %s at %s: %w", device, target, err)
+		}
+		return nil
+	}
+}
+
+// IsMountPoint returns true if a filesystem is mounted at path
+func IsMountPoint(path string) (bool, error) {
+	var st, parent unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false, err
+	}
+	if err := unix.Stat(filepath.Dir(path), &parent); err != nil {
+		return false, err
+	}
+	return st.Dev != parent.Dev, nil
+}
+
 // newSysProcAttr builds SysProcAttr to support namespaces and Cgroup association
-// if cgroupFD is 0 means we are not creating a new cgroup
-func NewSysProcAttr(cgroupFD int) *syscall.SysProcAttr {
-	return &unix.SysProcAttr{
+// if cgroupFD is 0 means we are not creating a new cgroup. With uids the child gets its own
+// user namespace mapping uids and gids to host ids, it becomes root of the namespace before exec.
+func NewSysProcAttr(cgroupFD int, uids, gids []IDMap) *syscall.SysProcAttr {
+	attr := &unix.SysProcAttr{
 		Cloneflags:  unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWNET,
 		CgroupFD:    cgroupFD,
 		UseCgroupFD: cgroupFD != 0,
 	}
+	if len(uids) == 0 {
+		return attr
+	}
+	attr.Cloneflags |= unix.CLONE_NEWUSER
+	attr.UidMappings = sysProcIDMaps(uids)
+	attr.GidMappings = sysProcIDMaps(gids)
+	// An unprivileged parent can only write the gid map once setgroups is denied in the namespace
+	privileged := os.Geteuid() == 0
+	attr.GidMappingsEnableSetgroups = privileged
+	attr.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: !privileged}
+	return attr
+}
+
+func sysProcIDMaps(maps []IDMap) []syscall.SysProcIDMap {
+	converted := make([]syscall.SysProcIDMap, 0, len(maps))
+	for _, m := range maps {
+		converted = append(converted, syscall.SysProcIDMap{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+	return converted
+}
+
+// OpenIDMapped returns a detached copy of the mount of dir where the owners of the files are mapped through
+// the user namespace of the process pid: a file owned by id 0 on disk is owned by the root of the namespace
+// and a file created by the root of the namespace is owned by id 0 on disk. Only root can create it.
+func OpenIDMapped(dir string, pid int) (*os.File, error) {
+	userns, err := os.Open(fmt.Sprintf("/proc/%d/ns/user", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer userns.Close()
+	fd, err := unix.OpenTree(unix.AT_FDCWD, dir, unix.OPEN_TREE_CLONE|unix.O_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("error cloning the mount of %s: %w", dir, err)
+	}
+	attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_IDMAP, Userns_fd: uint64(userns.Fd())}
+	if err := unix.MountSetattr(fd, "", unix.AT_EMPTY_PATH, attr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("error mapping the owners of %s: %w", dir, err)
+	}
+	return os.NewFile(uintptr(fd), dir), nil
+}
+
+// AttachMount attaches the detached mount m at target in the mount namespace of the caller
+func AttachMount(m *os.File, target string) error {
+	if err := unix.MoveMount(int(m.Fd()), "", unix.AT_FDCWD, target, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+		return fmt.Errorf("error attaching %s at %s: %w", m.Name(), target, err)
+	}
+	return nil
 }
 
 // getRootDeviceMajorMinor automates the process of getting Major and Minor numbers of the block
@@ -45,9 +660,56 @@ func NewSysProcAttr(cgroupFD int) *syscall.SysProcAttr {
 // approaches would be to apply the limit for all mounted devices if we control Chroot and FS namespaces
 // or let the user pick the device the limit applies to by device name (/dev/xxx)
 func GetRootDeviceMajorMinor() (uint, uint, error) {
-	if b, err := os.ReadFile("/proc/self/mountinfo"); err == nil {
-		return ReadRootFSMount(bufio.NewReader(bytes.NewReader(b)))
-	} else {
+	b, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
 		return 0, 0, err
 	}
+	major, minor, err := ReadRootFSMount(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return 0, 0, err
+	}
+	// Keep the partition when / is not on a disk, like overlay in containers, the limit is skipped for those
+	if diskMajor, diskMinor, err := WholeDisk(sysBlockPath, major, minor); err == nil {
+		return diskMajor, diskMinor, nil
+	}
+	return major, minor, nil
+}
+
+// ResolveBlockDevice returns the major:minor of the disk named by path, path is either a block device
+// like /dev/sdb1 or a path on a mounted filesystem like /data. Partitions are resolved to their disk.
+func ResolveBlockDevice(path string) (uint, uint, error) {
+	// The mount points are matched against the resolved path, a link leads to the filesystem of its target
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(resolved, &st); err != nil {
+		return 0, 0, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+		return WholeDisk(sysBlockPath, uint(unix.Major(st.Rdev)), uint(unix.Minor(st.Rdev)))
+	}
+
+	b, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	mounts, err := ReadMountPoints(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0, err
+	}
+	absPath, err := filepath.Abs(resolved)
+	if err != nil {
+		return 0, 0, err
+	}
+	m, err := FindMountPoint(mounts, absPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, minor, err := WholeDisk(sysBlockPath, m.Major, m.Minor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s is mounted from %s (%s) which is not a block device", path, m.Source, m.FSType)
+	}
+	return major, minor, nil
 }
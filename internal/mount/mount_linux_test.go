@@ -0,0 +1,48 @@
+//go:build linux
+
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSources(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "allowed", "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("allowed", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := openSources([]Bind{{Source: filepath.Join(root, "allowed", "data")}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	closeSources(sources)
+	for _, source := range []string{filepath.Join(root, "link", "data"), filepath.Join(root, "link")} {
+		if _, err := openSources([]Bind{{Source: source}}); err == nil {
+			t.Fatalf("error was expected opening %s through a symbolic link", source)
+		}
+	}
+}
+
+func TestResolveBlockDeviceLink(t *testing.T) {
+	major, minor, err := ResolveBlockDevice("/")
+	if err != nil {
+		t.Skipf("the root filesystem is not on a block device: %v", err)
+	}
+	// The link is resolved to the filesystem of its target rather than the one holding it
+	link := filepath.Join(t.TempDir(), "root")
+	if err := os.Symlink("/", link); err != nil {
+		t.Fatal(err)
+	}
+	if linkMajor, linkMinor, err := ResolveBlockDevice(link); err != nil || linkMajor != major || linkMinor != minor {
+		t.Fatalf("expected %d:%d but %d:%d was returned: %v", major, minor, linkMajor, linkMinor, err)
+	}
+}
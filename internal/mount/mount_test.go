@@ -3,6 +3,9 @@ package mount
 import (
 	"bufio"
 	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -43,3 +46,79 @@ func TestMountInfoReaderFailure(t *testing.T) {
 	}
 	t.Fatalf("error was expected but readMountInfo returned nil")
 }
+
+func TestReadMountPoints(t *testing.T) {
+	mountInfo := `28 1 254:0 / / rw,relatime - ext4 /dev/vda rw
+29 28 8:17 /data /mnt/my\040data ro,nosuid shared:5 master:1 - xfs /dev/sdb1 ro
+32 24 0:28 / /sys/fs/cgroup rw,relatime - cgroup2 cgroup2 rw
+`
+	mounts, err := ReadMountPoints(strings.NewReader(mountInfo))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(mounts) != 3 {
+		t.Fatalf("expected 3 mount points but %d were found", len(mounts))
+	}
+	expected := MountPoint{Major: 8, Minor: 17, Root: "/data", Path: "/mnt/my data", FSType: "xfs", Source: "/dev/sdb1"}
+	if mounts[1] != expected {
+		t.Fatalf("expected %+v but %+v was found", expected, mounts[1])
+	}
+
+	if _, err := ReadMountPoints(strings.NewReader("28 1 254:0 / / rw,relatime ext4 /dev/vda rw")); err == nil {
+		t.Fatalf("error was expected for a line without separator")
+	}
+}
+
+func TestFindMountPoint(t *testing.T) {
+	mounts := []MountPoint{
+		{Major: 254, Path: "/"},
+		{Major: 8, Minor: 16, Path: "/data"},
+		{Major: 8, Minor: 32, Path: "/data"},
+		{Major: 8, Minor: 48, Path: "/database"},
+	}
+	tests := []struct {
+		path  string
+		minor uint
+	}{{"/", 0}, {"/usr/bin", 0}, {"/data", 32}, {"/data/x/../y", 32}, {"/database/z", 48}, {"/datab", 0}}
+	for _, test := range tests {
+		m, err := FindMountPoint(mounts, test.path)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", test.path, err)
+		}
+		if m.Minor != test.minor {
+			t.Fatalf("expected minor %d for %s but %d was found", test.minor, test.path, m.Minor)
+		}
+	}
+}
+
+func TestWholeDisk(t *testing.T) {
+	sys := t.TempDir()
+	disk := filepath.Join(sys, "devices", "block", "sdb")
+	if err := os.MkdirAll(filepath.Join(disk, "sdb1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(disk, "dev"), []byte("8:16\n"), 0644)
+	os.WriteFile(filepath.Join(disk, "sdb1", "dev"), []byte("8:17\n"), 0644)
+	os.WriteFile(filepath.Join(disk, "sdb1", "partition"), []byte("1\n"), 0644)
+	block := filepath.Join(sys, "dev", "block")
+	os.MkdirAll(block, 0755)
+	os.Symlink("../../devices/block/sdb", filepath.Join(block, "8:16"))
+	os.Symlink("../../devices/block/sdb/sdb1", filepath.Join(block, "8:17"))
+
+	tests := []struct {
+		name         string
+		major, minor uint
+		err          bool
+	}{{"Disk", 8, 16, false}, {"Partition", 8, 17, false}, {"NotABlockDevice", 0, 24, true}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			major, minor, err := WholeDisk(block, test.major, test.minor)
+			if test.err != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.err && (major != 8 || minor != 16) {
+				t.Fatalf("expected 8:16 but %d:%d was found", major, minor)
+			}
+		})
+	}
+}
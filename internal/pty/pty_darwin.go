@@ -0,0 +1,26 @@
+//go:build darwin
+
+package pty
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// NOTE: The client needs raw mode on darwin, jobs with a terminal only run on linux
+
+const ioctlReadTermios = unix.TIOCGETA
+const ioctlWriteTermios = unix.TIOCSETA
+const recvmsgFlags = 0
+
+// Open is not supported for non-linux builds
+func Open() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("not supported on darwin")
+}
+
+// SetStdio is not supported for non-linux builds
+func SetStdio(_ *os.File) error {
+	return fmt.Errorf("not supported on darwin")
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package pty
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const ioctlReadTermios = unix.TCGETS
+const ioctlWriteTermios = unix.TCSETS
+const recvmsgFlags = unix.MSG_CMSG_CLOEXEC
+
+// Open allocates a new pseudo-terminal and returns its master and slave ends
+func Open() (*os.File, *os.File, error) {
+	masterFD, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening /dev/ptmx: %w", err)
+	}
+	master := os.NewFile(uintptr(masterFD), "/dev/ptmx")
+
+	// Equivalent of unlockpt(3) and ptsname(3)
+	if err := unix.IoctlSetPointerInt(masterFD, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("error unlocking pty: %w", err)
+	}
+	n, err := unix.IoctlGetInt(masterFD, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("error reading pty number: %w", err)
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	slaveFD, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("error opening %s: %w", name, err)
+	}
+	return master, os.NewFile(uintptr(slaveFD), name), nil
+}
+
+// SetStdio makes slave the controlling terminal of a new session and
+// duplicates it over the standard input, output and error of the calling process.
+func SetStdio(slave *os.File) error {
+	if _, err := unix.Setsid(); err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	if err := unix.IoctlSetInt(int(slave.Fd()), unix.TIOCSCTTY, 0); err != nil {
+		return fmt.Errorf("error setting controlling terminal: %w", err)
+	}
+	for fd := 0; fd < 3; fd++ {
+		if err := unix.Dup3(int(slave.Fd()), fd, 0); err != nil {
+			return fmt.Errorf("error duplicating terminal to fd %d: %w", fd, err)
+		}
+	}
+	return nil
+}
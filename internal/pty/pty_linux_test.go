@@ -0,0 +1,80 @@
+//go:build linux
+
+package pty
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOpen(t *testing.T) {
+	master, slave, err := Open()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	if err := SetSize(master, 24, 80); err != nil {
+		t.Fatal(err)
+	}
+	rows, cols, err := GetSize(slave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 24 || cols != 80 {
+		t.Fatalf("expected 24x80 but %dx%d was found", rows, cols)
+	}
+
+	if _, err := slave.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := master.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected hello but '%s' was read", buf)
+	}
+}
+
+func TestSendRecvFD(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := os.NewFile(uintptr(fds[0]), "local")
+	remote := os.NewFile(uintptr(fds[1]), "remote")
+	defer local.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := SendFD(remote, w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	remote.Close()
+
+	received, err := RecvFD(local, "pipe")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := received.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	received.Close()
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil || buf[0] != 'x' {
+		t.Fatalf("expected x but '%s' was read: %v", buf, err)
+	}
+
+	if _, err := RecvFD(local, "closed"); err == nil {
+		t.Fatal("error was expected when the remote end is closed")
+	}
+}
@@ -0,0 +1,251 @@
+package volume
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"minidocker/internal/mount"
+
+	"golang.org/x/sys/unix"
+)
+
+// minSizeMB is the smallest size cap, smaller ext4 filesystems hold almost no data
+const minSizeMB = 8
+
+// MaxSizeMB is the largest size cap, the largest ext4 filesystem with 4KiB blocks
+const MaxSizeMB = 16 << 20
+
+// Volume is a named directory kept across jobs
+type Volume struct {
+	// Name identifies the volume, it is made of letters, digits, '_', '.' and '-'
+	Name string `json:"name"`
+	// Owner is the user who created the volume
+	Owner string `json:"owner"`
+	// Created is when the volume was created
+	Created time.Time `json:"created"`
+	// SizeMB caps the size of the volume in megabytes, 0 means the volume is only bounded by the data root
+	SizeMB uint64 `json:"sizeMB,omitempty"`
+}
+
+// Store keeps the volumes in the directory root: each volume has a data directory under
+// <name>/data and volumes.json describes them. The data directory of a capped volume is
+// the mount point of an ext4 filesystem held by <name>/disk.img and mounted through a loop device.
+type Store struct {
+	root string
+	// mu serializes the changes of the store
+	mu sync.Mutex
+}
+
+// NewStore returns the store kept in the directory root, it is created by the first volume
+func NewStore(root string) *Store {
+	return &Store{root: root}
+}
+
+// ErrNotFound is returned when no volume has a name
+var ErrNotFound = errors.New("volume not found")
+
+// ErrExists is returned when creating a volume whose name is taken
+var ErrExists = errors.New("volume already exists")
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// Create adds the empty volume name owned by owner, a sizeMB other than 0 caps its size
+func (s *Store) Create(name, owner string, sizeMB uint64) (Volume, error) {
+	if !validName.MatchString(name) {
+		return Volume{}, fmt.Errorf("invalid volume name %s", name)
+	}
+	if sizeMB != 0 && sizeMB < minSizeMB {
+		return Volume{}, fmt.Errorf("the size of a volume must be at least %dMB", minSizeMB)
+	}
+	if sizeMB > MaxSizeMB {
+		return Volume{}, fmt.Errorf("the size of a volume must be at most %dMB", MaxSizeMB)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	volumes, err := s.load()
+	if err != nil {
+		return Volume{}, err
+	}
+	if _, err := find(volumes, name); err == nil {
+		return Volume{}, fmt.Errorf("%w: %s", ErrExists, name)
+	}
+
+	v := Volume{Name: name, Owner: owner, Created: time.Now(), SizeMB: sizeMB}
+	if err := os.MkdirAll(s.root, 0700); err != nil {
+		return Volume{}, err
+	}
+	dir := filepath.Join(s.root, name)
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		return Volume{}, err
+	}
+	if sizeMB != 0 {
+		if err := s.createDisk(v); err != nil {
+			os.RemoveAll(dir)
+			return Volume{}, err
+		}
+	}
+	if err := s.save(append(volumes, v)); err != nil {
+		s.unmount(v)
+		os.RemoveAll(dir)
+		return Volume{}, err
+	}
+	return v, nil
+}
+
+// createDisk formats the filesystem image capping the size of v and mounts it
+func (s *Store) createDisk(v Volume) error {
+	disk := filepath.Join(s.root, v.Name, "disk.img")
+	f, err := os.Create(disk)
+	if err != nil {
+		return err
+	}
+	// The image is sparse, the blocks are allocated as the volume fills up
+	err = f.Truncate(int64(v.SizeMB) << 20)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// No block is reserved for root as the jobs run as root
+	if output, err := exec.Command("mkfs.ext4", "-q", "-F", "-m", "0", disk).CombinedOutput(); err != nil {
+		return fmt.Errorf("error formatting volume %s: %w: %s", v.Name, err, output)
+	}
+	return mount.MountLoop(disk, filepath.Join(s.root, v.Name, "data"), "ext4")
+}
+
+// List returns the volumes sorted by name
+func (s *Store) List() ([]Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get returns the volume name
+func (s *Store) Get(name string) (Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	volumes, err := s.load()
+	if err != nil {
+		return Volume{}, err
+	}
+	return find(volumes, name)
+}
+
+// Path returns the data directory of the volume name, the filesystem of a capped volume
+// is mounted again when it is not, like after a restart of the host
+func (s *Store) Path(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	volumes, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	v, err := find(volumes, name)
+	if err != nil {
+		return "", err
+	}
+	data := filepath.Join(s.root, v.Name, "data")
+	if v.SizeMB == 0 {
+		return data, nil
+	}
+	mounted, err := mount.IsMountPoint(data)
+	if err != nil {
+		return "", err
+	}
+	if !mounted {
+		if err := mount.MountLoop(filepath.Join(s.root, v.Name, "disk.img"), data, "ext4"); err != nil {
+			return "", err
+		}
+	}
+	return data, nil
+}
+
+// Remove removes the volume name and its data
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	volumes, err := s.load()
+	if err != nil {
+		return err
+	}
+	v, err := find(volumes, name)
+	if err != nil {
+		return err
+	}
+	if err := s.unmount(v); err != nil {
+		return err
+	}
+	kept := make([]Volume, 0, len(volumes)-1)
+	for _, other := range volumes {
+		if other.Name != name {
+			kept = append(kept, other)
+		}
+	}
+	if err := s.save(kept); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.root, v.Name))
+}
+
+// unmount unmounts the filesystem of a capped volume, the loop device is released with it
+func (s *Store) unmount(v Volume) error {
+	if v.SizeMB == 0 {
+		return nil
+	}
+	data := filepath.Join(s.root, v.Name, "data")
+	if mounted, err := mount.IsMountPoint(data); err != nil || !mounted {
+		return err
+	}
+	if err := unix.Unmount(data, 0); err != nil {
+		return fmt.Errorf("error unmounting volume %s: %w", v.Name, err)
+	}
+	return nil
+}
+
+func find(volumes []Volume, name string) (Volume, error) {
+	for _, v := range volumes {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return Volume{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// load reads volumes.json, the caller must hold mu
+func (s *Store) load() ([]Volume, error) {
+	b, err := os.ReadFile(filepath.Join(s.root, "volumes.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var volumes []Volume
+	if err := json.Unmarshal(b, &volumes); err != nil {
+		return nil, fmt.Errorf("error parsing volumes.json: %w", err)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// save replaces volumes.json atomically, the caller must hold mu
+func (s *Store) save(volumes []Volume) error {
+	b, err := json.MarshalIndent(volumes, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.root, ".volumes.json")
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.root, "volumes.json"))
+}
@@ -0,0 +1,105 @@
+package volume
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestVolumes(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "volumes"))
+	v, err := store.Create("cache", "user2", 0)
+	if err != nil {
+		t.Fatalf("create returned error: %v", err)
+	}
+	if v.Name != "cache" || v.Owner != "user2" || v.SizeMB != 0 {
+		t.Fatalf("unexpected volume %+v", v)
+	}
+	if _, err := store.Create("cache", "user3", 0); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists but %v was returned", err)
+	}
+	for _, name := range []string{"", "../escape", ".hidden", "a/b"} {
+		if _, err := store.Create(name, "user2", 0); err == nil {
+			t.Fatalf("error was expected creating %s", name)
+		}
+	}
+	if _, err := store.Create("small", "user2", 1); err == nil {
+		t.Fatal("error was expected with a size below the minimum")
+	}
+	// The size in bytes would overflow
+	if _, err := store.Create("huge", "user2", 1<<44); err == nil {
+		t.Fatal("error was expected with a size above the maximum")
+	}
+
+	path, err := store.Path("cache")
+	if err != nil {
+		t.Fatalf("path returned error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "kept"), []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A new store reads the volumes kept in the directory
+	store = NewStore(store.root)
+	if volumes, err := store.List(); err != nil || len(volumes) != 1 || volumes[0].Owner != "user2" {
+		t.Fatalf("expected the volume to be listed but %v was returned: %v", volumes, err)
+	}
+	if err := store.Remove("cache"); err != nil {
+		t.Fatalf("remove returned error: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected the data of the volume to be removed")
+	}
+	if _, err := store.Get("cache"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but %v was returned", err)
+	}
+}
+
+func TestCappedVolume(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 is not available")
+	}
+	store := NewStore(filepath.Join(t.TempDir(), "volumes"))
+	if _, err := store.Create("capped", "user2", 8); err != nil {
+		t.Skipf("can't create a loop backed volume: %v", err)
+	}
+	defer store.Remove("capped")
+	path, err := store.Path("capped")
+	if err != nil {
+		t.Fatalf("path returned error: %v", err)
+	}
+
+	// Writing past the cap fails with ENOSPC
+	f, err := os.Create(filepath.Join(path, "fill"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < 16; i++ {
+		if _, err = f.Write(chunk); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if !errors.Is(err, unix.ENOSPC) {
+		t.Fatalf("expected ENOSPC writing 16MB to an 8MB volume but %v was returned", err)
+	}
+
+	// The filesystem is mounted again when it is not
+	f.Close()
+	if err := unix.Unmount(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if path, err = store.Path("capped"); err != nil {
+		t.Fatalf("path returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(path, "fill")); err != nil {
+		t.Fatalf("expected the data to be kept: %v", err)
+	}
+}
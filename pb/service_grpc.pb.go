@@ -19,10 +19,30 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Scheduler_Get_FullMethodName    = "/v1.Scheduler/Get"
-	Scheduler_Start_FullMethodName  = "/v1.Scheduler/Start"
-	Scheduler_Stdout_FullMethodName = "/v1.Scheduler/Stdout"
-	Scheduler_Stop_FullMethodName   = "/v1.Scheduler/Stop"
+	Scheduler_Get_FullMethodName            = "/v1.Scheduler/Get"
+	Scheduler_Start_FullMethodName          = "/v1.Scheduler/Start"
+	Scheduler_StartWithInput_FullMethodName = "/v1.Scheduler/StartWithInput"
+	Scheduler_Stdout_FullMethodName         = "/v1.Scheduler/Stdout"
+	Scheduler_Stop_FullMethodName           = "/v1.Scheduler/Stop"
+	Scheduler_Attach_FullMethodName         = "/v1.Scheduler/Attach"
+	Scheduler_CopyIn_FullMethodName         = "/v1.Scheduler/CopyIn"
+	Scheduler_CopyOut_FullMethodName        = "/v1.Scheduler/CopyOut"
+	Scheduler_Artifacts_FullMethodName      = "/v1.Scheduler/Artifacts"
+	Scheduler_Stats_FullMethodName          = "/v1.Scheduler/Stats"
+	Scheduler_WatchStats_FullMethodName     = "/v1.Scheduler/WatchStats"
+	Scheduler_Update_FullMethodName         = "/v1.Scheduler/Update"
+	Scheduler_HostStats_FullMethodName      = "/v1.Scheduler/HostStats"
+	Scheduler_Report_FullMethodName         = "/v1.Scheduler/Report"
+	Scheduler_Quota_FullMethodName          = "/v1.Scheduler/Quota"
+	Scheduler_ListProfiles_FullMethodName   = "/v1.Scheduler/ListProfiles"
+	Scheduler_ImportImage_FullMethodName    = "/v1.Scheduler/ImportImage"
+	Scheduler_ListImages_FullMethodName     = "/v1.Scheduler/ListImages"
+	Scheduler_RemoveImage_FullMethodName    = "/v1.Scheduler/RemoveImage"
+	Scheduler_Diff_FullMethodName           = "/v1.Scheduler/Diff"
+	Scheduler_Commit_FullMethodName         = "/v1.Scheduler/Commit"
+	Scheduler_CreateVolume_FullMethodName   = "/v1.Scheduler/CreateVolume"
+	Scheduler_ListVolumes_FullMethodName    = "/v1.Scheduler/ListVolumes"
+	Scheduler_RemoveVolume_FullMethodName   = "/v1.Scheduler/RemoveVolume"
 )
 
 // SchedulerClient is the client API for Scheduler service.
@@ -31,8 +51,28 @@ const (
 type SchedulerClient interface {
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	Start(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	StartWithInput(ctx context.Context, opts ...grpc.CallOption) (Scheduler_StartWithInputClient, error)
 	Stdout(ctx context.Context, in *OutputRequest, opts ...grpc.CallOption) (Scheduler_StdoutClient, error)
 	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error)
+	Attach(ctx context.Context, opts ...grpc.CallOption) (Scheduler_AttachClient, error)
+	CopyIn(ctx context.Context, opts ...grpc.CallOption) (Scheduler_CopyInClient, error)
+	CopyOut(ctx context.Context, in *CopyOutRequest, opts ...grpc.CallOption) (Scheduler_CopyOutClient, error)
+	Artifacts(ctx context.Context, in *ArtifactsRequest, opts ...grpc.CallOption) (Scheduler_ArtifactsClient, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (Scheduler_WatchStatsClient, error)
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+	HostStats(ctx context.Context, in *HostStatsRequest, opts ...grpc.CallOption) (*HostStatsResponse, error)
+	Report(ctx context.Context, in *ReportRequest, opts ...grpc.CallOption) (*ReportResponse, error)
+	Quota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error)
+	ListProfiles(ctx context.Context, in *ListProfilesRequest, opts ...grpc.CallOption) (*ListProfilesResponse, error)
+	ImportImage(ctx context.Context, opts ...grpc.CallOption) (Scheduler_ImportImageClient, error)
+	ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error)
+	RemoveImage(ctx context.Context, in *RemoveImageRequest, opts ...grpc.CallOption) (*RemoveImageResponse, error)
+	Diff(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (Scheduler_DiffClient, error)
+	Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error)
+	CreateVolume(ctx context.Context, in *CreateVolumeRequest, opts ...grpc.CallOption) (*CreateVolumeResponse, error)
+	ListVolumes(ctx context.Context, in *ListVolumesRequest, opts ...grpc.CallOption) (*ListVolumesResponse, error)
+	RemoveVolume(ctx context.Context, in *RemoveVolumeRequest, opts ...grpc.CallOption) (*RemoveVolumeResponse, error)
 }
 
 type schedulerClient struct {
@@ -61,158 +101,1011 @@ func (c *schedulerClient) Start(ctx context.Context, in *CreateRequest, opts ...
 	return out, nil
 }
 
+func (c *schedulerClient) StartWithInput(ctx context.Context, opts ...grpc.CallOption) (Scheduler_StartWithInputClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[0], Scheduler_StartWithInput_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerStartWithInputClient{stream}
+	return x, nil
+}
+
+type Scheduler_StartWithInputClient interface {
+	Send(*StartInputRequest) error
+	CloseAndRecv() (*CreateResponse, error)
+	grpc.ClientStream
+}
+
+type schedulerStartWithInputClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerStartWithInputClient) Send(m *StartInputRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *schedulerStartWithInputClient) CloseAndRecv() (*CreateResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(CreateResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *schedulerClient) Stdout(ctx context.Context, in *OutputRequest, opts ...grpc.CallOption) (Scheduler_StdoutClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[0], Scheduler_Stdout_FullMethodName, opts...)
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[1], Scheduler_Stdout_FullMethodName, opts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &schedulerStdoutClient{stream}
-	if err := x.ClientStream.SendMsg(in); err != nil {
-		return nil, err
+	x := &schedulerStdoutClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Scheduler_StdoutClient interface {
+	Recv() (*OutputResponse, error)
+	grpc.ClientStream
+}
+
+type schedulerStdoutClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerStdoutClient) Recv() (*OutputResponse, error) {
+	m := new(OutputResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error) {
+	out := new(StopResponse)
+	err := c.cc.Invoke(ctx, Scheduler_Stop_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) Attach(ctx context.Context, opts ...grpc.CallOption) (Scheduler_AttachClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[2], Scheduler_Attach_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerAttachClient{stream}
+	return x, nil
+}
+
+type Scheduler_AttachClient interface {
+	Send(*AttachRequest) error
+	Recv() (*OutputResponse, error)
+	grpc.ClientStream
+}
+
+type schedulerAttachClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerAttachClient) Send(m *AttachRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *schedulerAttachClient) Recv() (*OutputResponse, error) {
+	m := new(OutputResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) CopyIn(ctx context.Context, opts ...grpc.CallOption) (Scheduler_CopyInClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[3], Scheduler_CopyIn_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerCopyInClient{stream}
+	return x, nil
+}
+
+type Scheduler_CopyInClient interface {
+	Send(*CopyInRequest) error
+	CloseAndRecv() (*CopyInResponse, error)
+	grpc.ClientStream
+}
+
+type schedulerCopyInClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerCopyInClient) Send(m *CopyInRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *schedulerCopyInClient) CloseAndRecv() (*CopyInResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(CopyInResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) CopyOut(ctx context.Context, in *CopyOutRequest, opts ...grpc.CallOption) (Scheduler_CopyOutClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[4], Scheduler_CopyOut_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerCopyOutClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Scheduler_CopyOutClient interface {
+	Recv() (*ArchiveChunk, error)
+	grpc.ClientStream
+}
+
+type schedulerCopyOutClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerCopyOutClient) Recv() (*ArchiveChunk, error) {
+	m := new(ArchiveChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) Artifacts(ctx context.Context, in *ArtifactsRequest, opts ...grpc.CallOption) (Scheduler_ArtifactsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[5], Scheduler_Artifacts_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerArtifactsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Scheduler_ArtifactsClient interface {
+	Recv() (*ArchiveChunk, error)
+	grpc.ClientStream
+}
+
+type schedulerArtifactsClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerArtifactsClient) Recv() (*ArchiveChunk, error) {
+	m := new(ArchiveChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, Scheduler_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (Scheduler_WatchStatsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[6], Scheduler_WatchStats_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerWatchStatsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Scheduler_WatchStatsClient interface {
+	Recv() (*StatsResponse, error)
+	grpc.ClientStream
+}
+
+type schedulerWatchStatsClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerWatchStatsClient) Recv() (*StatsResponse, error) {
+	m := new(StatsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	out := new(UpdateResponse)
+	err := c.cc.Invoke(ctx, Scheduler_Update_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) HostStats(ctx context.Context, in *HostStatsRequest, opts ...grpc.CallOption) (*HostStatsResponse, error) {
+	out := new(HostStatsResponse)
+	err := c.cc.Invoke(ctx, Scheduler_HostStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) Report(ctx context.Context, in *ReportRequest, opts ...grpc.CallOption) (*ReportResponse, error) {
+	out := new(ReportResponse)
+	err := c.cc.Invoke(ctx, Scheduler_Report_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) Quota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error) {
+	out := new(QuotaResponse)
+	err := c.cc.Invoke(ctx, Scheduler_Quota_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) ListProfiles(ctx context.Context, in *ListProfilesRequest, opts ...grpc.CallOption) (*ListProfilesResponse, error) {
+	out := new(ListProfilesResponse)
+	err := c.cc.Invoke(ctx, Scheduler_ListProfiles_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) ImportImage(ctx context.Context, opts ...grpc.CallOption) (Scheduler_ImportImageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[7], Scheduler_ImportImage_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerImportImageClient{stream}
+	return x, nil
+}
+
+type Scheduler_ImportImageClient interface {
+	Send(*ImportImageRequest) error
+	CloseAndRecv() (*ImportImageResponse, error)
+	grpc.ClientStream
+}
+
+type schedulerImportImageClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerImportImageClient) Send(m *ImportImageRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *schedulerImportImageClient) CloseAndRecv() (*ImportImageResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportImageResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error) {
+	out := new(ListImagesResponse)
+	err := c.cc.Invoke(ctx, Scheduler_ListImages_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) RemoveImage(ctx context.Context, in *RemoveImageRequest, opts ...grpc.CallOption) (*RemoveImageResponse, error) {
+	out := new(RemoveImageResponse)
+	err := c.cc.Invoke(ctx, Scheduler_RemoveImage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) Diff(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (Scheduler_DiffClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Scheduler_ServiceDesc.Streams[8], Scheduler_Diff_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerDiffClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Scheduler_DiffClient interface {
+	Recv() (*ArchiveChunk, error)
+	grpc.ClientStream
+}
+
+type schedulerDiffClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerDiffClient) Recv() (*ArchiveChunk, error) {
+	m := new(ArchiveChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schedulerClient) Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error) {
+	out := new(CommitResponse)
+	err := c.cc.Invoke(ctx, Scheduler_Commit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) CreateVolume(ctx context.Context, in *CreateVolumeRequest, opts ...grpc.CallOption) (*CreateVolumeResponse, error) {
+	out := new(CreateVolumeResponse)
+	err := c.cc.Invoke(ctx, Scheduler_CreateVolume_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) ListVolumes(ctx context.Context, in *ListVolumesRequest, opts ...grpc.CallOption) (*ListVolumesResponse, error) {
+	out := new(ListVolumesResponse)
+	err := c.cc.Invoke(ctx, Scheduler_ListVolumes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) RemoveVolume(ctx context.Context, in *RemoveVolumeRequest, opts ...grpc.CallOption) (*RemoveVolumeResponse, error) {
+	out := new(RemoveVolumeResponse)
+	err := c.cc.Invoke(ctx, Scheduler_RemoveVolume_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SchedulerServer is the server API for Scheduler service.
+// All implementations must embed UnimplementedSchedulerServer
+// for forward compatibility
+type SchedulerServer interface {
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Start(context.Context, *CreateRequest) (*CreateResponse, error)
+	StartWithInput(Scheduler_StartWithInputServer) error
+	Stdout(*OutputRequest, Scheduler_StdoutServer) error
+	Stop(context.Context, *StopRequest) (*StopResponse, error)
+	Attach(Scheduler_AttachServer) error
+	CopyIn(Scheduler_CopyInServer) error
+	CopyOut(*CopyOutRequest, Scheduler_CopyOutServer) error
+	Artifacts(*ArtifactsRequest, Scheduler_ArtifactsServer) error
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	WatchStats(*WatchStatsRequest, Scheduler_WatchStatsServer) error
+	Update(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	HostStats(context.Context, *HostStatsRequest) (*HostStatsResponse, error)
+	Report(context.Context, *ReportRequest) (*ReportResponse, error)
+	Quota(context.Context, *QuotaRequest) (*QuotaResponse, error)
+	ListProfiles(context.Context, *ListProfilesRequest) (*ListProfilesResponse, error)
+	ImportImage(Scheduler_ImportImageServer) error
+	ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error)
+	RemoveImage(context.Context, *RemoveImageRequest) (*RemoveImageResponse, error)
+	Diff(*DiffRequest, Scheduler_DiffServer) error
+	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	CreateVolume(context.Context, *CreateVolumeRequest) (*CreateVolumeResponse, error)
+	ListVolumes(context.Context, *ListVolumesRequest) (*ListVolumesResponse, error)
+	RemoveVolume(context.Context, *RemoveVolumeRequest) (*RemoveVolumeResponse, error)
+	mustEmbedUnimplementedSchedulerServer()
+}
+
+// UnimplementedSchedulerServer must be embedded to have forward compatible implementations.
+type UnimplementedSchedulerServer struct {
+}
+
+func (UnimplementedSchedulerServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedSchedulerServer) Start(context.Context, *CreateRequest) (*CreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedSchedulerServer) StartWithInput(Scheduler_StartWithInputServer) error {
+	return status.Errorf(codes.Unimplemented, "method StartWithInput not implemented")
+}
+func (UnimplementedSchedulerServer) Stdout(*OutputRequest, Scheduler_StdoutServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stdout not implemented")
+}
+func (UnimplementedSchedulerServer) Stop(context.Context, *StopRequest) (*StopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedSchedulerServer) Attach(Scheduler_AttachServer) error {
+	return status.Errorf(codes.Unimplemented, "method Attach not implemented")
+}
+func (UnimplementedSchedulerServer) CopyIn(Scheduler_CopyInServer) error {
+	return status.Errorf(codes.Unimplemented, "method CopyIn not implemented")
+}
+func (UnimplementedSchedulerServer) CopyOut(*CopyOutRequest, Scheduler_CopyOutServer) error {
+	return status.Errorf(codes.Unimplemented, "method CopyOut not implemented")
+}
+func (UnimplementedSchedulerServer) Artifacts(*ArtifactsRequest, Scheduler_ArtifactsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Artifacts not implemented")
+}
+func (UnimplementedSchedulerServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedSchedulerServer) WatchStats(*WatchStatsRequest, Scheduler_WatchStatsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStats not implemented")
+}
+func (UnimplementedSchedulerServer) Update(context.Context, *UpdateRequest) (*UpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedSchedulerServer) HostStats(context.Context, *HostStatsRequest) (*HostStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HostStats not implemented")
+}
+func (UnimplementedSchedulerServer) Report(context.Context, *ReportRequest) (*ReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Report not implemented")
+}
+func (UnimplementedSchedulerServer) Quota(context.Context, *QuotaRequest) (*QuotaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Quota not implemented")
+}
+func (UnimplementedSchedulerServer) ListProfiles(context.Context, *ListProfilesRequest) (*ListProfilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProfiles not implemented")
+}
+func (UnimplementedSchedulerServer) ImportImage(Scheduler_ImportImageServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportImage not implemented")
+}
+func (UnimplementedSchedulerServer) ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListImages not implemented")
+}
+func (UnimplementedSchedulerServer) RemoveImage(context.Context, *RemoveImageRequest) (*RemoveImageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveImage not implemented")
+}
+func (UnimplementedSchedulerServer) Diff(*DiffRequest, Scheduler_DiffServer) error {
+	return status.Errorf(codes.Unimplemented, "method Diff not implemented")
+}
+func (UnimplementedSchedulerServer) Commit(context.Context, *CommitRequest) (*CommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedSchedulerServer) CreateVolume(context.Context, *CreateVolumeRequest) (*CreateVolumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateVolume not implemented")
+}
+func (UnimplementedSchedulerServer) ListVolumes(context.Context, *ListVolumesRequest) (*ListVolumesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVolumes not implemented")
+}
+func (UnimplementedSchedulerServer) RemoveVolume(context.Context, *RemoveVolumeRequest) (*RemoveVolumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveVolume not implemented")
+}
+func (UnimplementedSchedulerServer) mustEmbedUnimplementedSchedulerServer() {}
+
+// UnsafeSchedulerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SchedulerServer will
+// result in compilation errors.
+type UnsafeSchedulerServer interface {
+	mustEmbedUnimplementedSchedulerServer()
+}
+
+func RegisterSchedulerServer(s grpc.ServiceRegistrar, srv SchedulerServer) {
+	s.RegisterService(&Scheduler_ServiceDesc, srv)
+}
+
+func _Scheduler_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Start_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Start(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_StartWithInput_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SchedulerServer).StartWithInput(&schedulerStartWithInputServer{stream})
+}
+
+type Scheduler_StartWithInputServer interface {
+	SendAndClose(*CreateResponse) error
+	Recv() (*StartInputRequest, error)
+	grpc.ServerStream
+}
+
+type schedulerStartWithInputServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerStartWithInputServer) SendAndClose(m *CreateResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *schedulerStartWithInputServer) Recv() (*StartInputRequest, error) {
+	m := new(StartInputRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Scheduler_Stdout_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(OutputRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SchedulerServer).Stdout(m, &schedulerStdoutServer{stream})
+}
+
+type Scheduler_StdoutServer interface {
+	Send(*OutputResponse) error
+	grpc.ServerStream
+}
+
+type schedulerStdoutServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerStdoutServer) Send(m *OutputResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Scheduler_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Stop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Stop(ctx, req.(*StopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_Attach_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SchedulerServer).Attach(&schedulerAttachServer{stream})
+}
+
+type Scheduler_AttachServer interface {
+	Send(*OutputResponse) error
+	Recv() (*AttachRequest, error)
+	grpc.ServerStream
+}
+
+type schedulerAttachServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerAttachServer) Send(m *OutputResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *schedulerAttachServer) Recv() (*AttachRequest, error) {
+	m := new(AttachRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Scheduler_CopyIn_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SchedulerServer).CopyIn(&schedulerCopyInServer{stream})
+}
+
+type Scheduler_CopyInServer interface {
+	SendAndClose(*CopyInResponse) error
+	Recv() (*CopyInRequest, error)
+	grpc.ServerStream
+}
+
+type schedulerCopyInServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerCopyInServer) SendAndClose(m *CopyInResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *schedulerCopyInServer) Recv() (*CopyInRequest, error) {
+	m := new(CopyInRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Scheduler_CopyOut_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CopyOutRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SchedulerServer).CopyOut(m, &schedulerCopyOutServer{stream})
+}
+
+type Scheduler_CopyOutServer interface {
+	Send(*ArchiveChunk) error
+	grpc.ServerStream
+}
+
+type schedulerCopyOutServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerCopyOutServer) Send(m *ArchiveChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Scheduler_Artifacts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ArtifactsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
 	}
-	if err := x.ClientStream.CloseSend(); err != nil {
+	return srv.(SchedulerServer).Artifacts(m, &schedulerArtifactsServer{stream})
+}
+
+type Scheduler_ArtifactsServer interface {
+	Send(*ArchiveChunk) error
+	grpc.ServerStream
+}
+
+type schedulerArtifactsServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerArtifactsServer) Send(m *ArchiveChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Scheduler_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return x, nil
+	if interceptor == nil {
+		return srv.(SchedulerServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type Scheduler_StdoutClient interface {
-	Recv() (*OutputResponse, error)
-	grpc.ClientStream
+func _Scheduler_WatchStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SchedulerServer).WatchStats(m, &schedulerWatchStatsServer{stream})
 }
 
-type schedulerStdoutClient struct {
-	grpc.ClientStream
+type Scheduler_WatchStatsServer interface {
+	Send(*StatsResponse) error
+	grpc.ServerStream
 }
 
-func (x *schedulerStdoutClient) Recv() (*OutputResponse, error) {
-	m := new(OutputResponse)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
+type schedulerWatchStatsServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerWatchStatsServer) Send(m *StatsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Scheduler_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return m, nil
+	if interceptor == nil {
+		return srv.(SchedulerServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *schedulerClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error) {
-	out := new(StopResponse)
-	err := c.cc.Invoke(ctx, Scheduler_Stop_FullMethodName, in, out, opts...)
-	if err != nil {
+func _Scheduler_HostStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostStatsRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(SchedulerServer).HostStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_HostStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).HostStats(ctx, req.(*HostStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// SchedulerServer is the server API for Scheduler service.
-// All implementations must embed UnimplementedSchedulerServer
-// for forward compatibility
-type SchedulerServer interface {
-	Get(context.Context, *GetRequest) (*GetResponse, error)
-	Start(context.Context, *CreateRequest) (*CreateResponse, error)
-	Stdout(*OutputRequest, Scheduler_StdoutServer) error
-	Stop(context.Context, *StopRequest) (*StopResponse, error)
-	mustEmbedUnimplementedSchedulerServer()
+func _Scheduler_Report_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).Report(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Report_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Report(ctx, req.(*ReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// UnimplementedSchedulerServer must be embedded to have forward compatible implementations.
-type UnimplementedSchedulerServer struct {
+func _Scheduler_Quota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).Quota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_Quota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).Quota(ctx, req.(*QuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (UnimplementedSchedulerServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+func _Scheduler_ListProfiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProfilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).ListProfiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_ListProfiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).ListProfiles(ctx, req.(*ListProfilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
-func (UnimplementedSchedulerServer) Start(context.Context, *CreateRequest) (*CreateResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+
+func _Scheduler_ImportImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SchedulerServer).ImportImage(&schedulerImportImageServer{stream})
 }
-func (UnimplementedSchedulerServer) Stdout(*OutputRequest, Scheduler_StdoutServer) error {
-	return status.Errorf(codes.Unimplemented, "method Stdout not implemented")
+
+type Scheduler_ImportImageServer interface {
+	SendAndClose(*ImportImageResponse) error
+	Recv() (*ImportImageRequest, error)
+	grpc.ServerStream
 }
-func (UnimplementedSchedulerServer) Stop(context.Context, *StopRequest) (*StopResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+
+type schedulerImportImageServer struct {
+	grpc.ServerStream
 }
-func (UnimplementedSchedulerServer) mustEmbedUnimplementedSchedulerServer() {}
 
-// UnsafeSchedulerServer may be embedded to opt out of forward compatibility for this service.
-// Use of this interface is not recommended, as added methods to SchedulerServer will
-// result in compilation errors.
-type UnsafeSchedulerServer interface {
-	mustEmbedUnimplementedSchedulerServer()
+func (x *schedulerImportImageServer) SendAndClose(m *ImportImageResponse) error {
+	return x.ServerStream.SendMsg(m)
 }
 
-func RegisterSchedulerServer(s grpc.ServiceRegistrar, srv SchedulerServer) {
-	s.RegisterService(&Scheduler_ServiceDesc, srv)
+func (x *schedulerImportImageServer) Recv() (*ImportImageRequest, error) {
+	m := new(ImportImageRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func _Scheduler_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetRequest)
+func _Scheduler_ListImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListImagesRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SchedulerServer).Get(ctx, in)
+		return srv.(SchedulerServer).ListImages(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Scheduler_Get_FullMethodName,
+		FullMethod: Scheduler_ListImages_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SchedulerServer).Get(ctx, req.(*GetRequest))
+		return srv.(SchedulerServer).ListImages(ctx, req.(*ListImagesRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Scheduler_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(CreateRequest)
+func _Scheduler_RemoveImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveImageRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SchedulerServer).Start(ctx, in)
+		return srv.(SchedulerServer).RemoveImage(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Scheduler_Start_FullMethodName,
+		FullMethod: Scheduler_RemoveImage_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SchedulerServer).Start(ctx, req.(*CreateRequest))
+		return srv.(SchedulerServer).RemoveImage(ctx, req.(*RemoveImageRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Scheduler_Stdout_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(OutputRequest)
+func _Scheduler_Diff_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DiffRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
-	return srv.(SchedulerServer).Stdout(m, &schedulerStdoutServer{stream})
+	return srv.(SchedulerServer).Diff(m, &schedulerDiffServer{stream})
 }
 
-type Scheduler_StdoutServer interface {
-	Send(*OutputResponse) error
+type Scheduler_DiffServer interface {
+	Send(*ArchiveChunk) error
 	grpc.ServerStream
 }
 
-type schedulerStdoutServer struct {
+type schedulerDiffServer struct {
 	grpc.ServerStream
 }
 
-func (x *schedulerStdoutServer) Send(m *OutputResponse) error {
+func (x *schedulerDiffServer) Send(m *ArchiveChunk) error {
 	return x.ServerStream.SendMsg(m)
 }
 
-func _Scheduler_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(StopRequest)
+func _Scheduler_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SchedulerServer).Stop(ctx, in)
+		return srv.(SchedulerServer).Commit(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Scheduler_Stop_FullMethodName,
+		FullMethod: Scheduler_Commit_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SchedulerServer).Stop(ctx, req.(*StopRequest))
+		return srv.(SchedulerServer).Commit(ctx, req.(*CommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_CreateVolume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateVolumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).CreateVolume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_CreateVolume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).CreateVolume(ctx, req.(*CreateVolumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_ListVolumes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVolumesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).ListVolumes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_ListVolumes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).ListVolumes(ctx, req.(*ListVolumesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_RemoveVolume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveVolumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).RemoveVolume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Scheduler_RemoveVolume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).RemoveVolume(ctx, req.(*RemoveVolumeRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -236,13 +1129,102 @@ var Scheduler_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Stop",
 			Handler:    _Scheduler_Stop_Handler,
 		},
+		{
+			MethodName: "Stats",
+			Handler:    _Scheduler_Stats_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _Scheduler_Update_Handler,
+		},
+		{
+			MethodName: "HostStats",
+			Handler:    _Scheduler_HostStats_Handler,
+		},
+		{
+			MethodName: "Report",
+			Handler:    _Scheduler_Report_Handler,
+		},
+		{
+			MethodName: "Quota",
+			Handler:    _Scheduler_Quota_Handler,
+		},
+		{
+			MethodName: "ListProfiles",
+			Handler:    _Scheduler_ListProfiles_Handler,
+		},
+		{
+			MethodName: "ListImages",
+			Handler:    _Scheduler_ListImages_Handler,
+		},
+		{
+			MethodName: "RemoveImage",
+			Handler:    _Scheduler_RemoveImage_Handler,
+		},
+		{
+			MethodName: "Commit",
+			Handler:    _Scheduler_Commit_Handler,
+		},
+		{
+			MethodName: "CreateVolume",
+			Handler:    _Scheduler_CreateVolume_Handler,
+		},
+		{
+			MethodName: "ListVolumes",
+			Handler:    _Scheduler_ListVolumes_Handler,
+		},
+		{
+			MethodName: "RemoveVolume",
+			Handler:    _Scheduler_RemoveVolume_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StartWithInput",
+			Handler:       _Scheduler_StartWithInput_Handler,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "Stdout",
 			Handler:       _Scheduler_Stdout_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Attach",
+			Handler:       _Scheduler_Attach_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "CopyIn",
+			Handler:       _Scheduler_CopyIn_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "CopyOut",
+			Handler:       _Scheduler_CopyOut_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Artifacts",
+			Handler:       _Scheduler_Artifacts_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchStats",
+			Handler:       _Scheduler_WatchStats_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportImage",
+			Handler:       _Scheduler_ImportImage_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Diff",
+			Handler:       _Scheduler_Diff_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "service.proto",
 }
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"minidocker/executor"
+	"os"
+)
+
+// Config is the server policy, it is loaded from a JSON file
+type Config struct {
+	// RoleQuotas bounds the jobs of the users of each role
+	RoleQuotas map[string]Quota `json:"roleQuotas"`
+	// UserQuotas bounds the jobs of single users, a user quota replaces the quota of the user role
+	UserQuotas map[string]Quota `json:"userQuotas"`
+	// RolePolicies sets the default, maximum and required limits of the jobs of each role
+	RolePolicies map[string]LimitPolicy `json:"rolePolicies"`
+	// Profiles are named limit sets jobs can be started with
+	Profiles map[string]Profile `json:"profiles"`
+	// RoleMounts lists the host paths the users of each role may bind mount in their jobs
+	RoleMounts map[string][]MountRule `json:"roleMounts"`
+	// HardenedRoles sets whether the jobs of each role run in the hardened sandbox whatever the request,
+	// the roles that are not listed are hardened unless they are admin roles
+	HardenedRoles map[string]bool `json:"hardenedRoles"`
+}
+
+// hardened returns true if a job of role runs in the hardened sandbox, a job may always request it
+func (c *Config) hardened(role string, admin, requested bool) bool {
+	if hardened, found := c.HardenedRoles[role]; found {
+		return hardened || requested
+	}
+	return !admin || requested
+}
+
+// LoadConfig reads the server policy from file, an empty file name returns an empty policy
+func LoadConfig(file string) (*Config, error) {
+	config := &Config{}
+	if file == "" {
+		return config, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	if err := config.parseQuotas(); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	return config, nil
+}
+
+// parseQuotas parses the CPU quantities of the quotas
+func (c *Config) parseQuotas() error {
+	for _, quotas := range []map[string]Quota{c.RoleQuotas, c.UserQuotas} {
+		for name, q := range quotas {
+			if q.MaxCPUs == "" {
+				continue
+			}
+			var err error
+			if q.maxCPUMillis, err = executor.ParseCPUQuantity(q.MaxCPUs); err != nil {
+				return fmt.Errorf("invalid quota for %s: %w", name, err)
+			}
+			quotas[name] = q
+		}
+	}
+	return nil
+}
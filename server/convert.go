@@ -0,0 +1,268 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"minidocker/executor"
+	"minidocker/internal/image"
+	"minidocker/internal/volume"
+	"minidocker/pb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// limitFields maps the executor limits to the request fields reported in validation errors
+var limitFields = map[string]string{
+	"CPUPercent":    "limits.cpuPercentage",
+	"CPUMillis":     "limits.cpus",
+	"CPUPeriodUsec": "limits.cpuPeriodUsec",
+	"CPUBurstUsec":  "limits.cpuBurstUsec",
+	"CPUWeight":     "limits.cpuWeight",
+	"CpusetCpus":    "limits.cpusetCpus",
+	"CpusetMems":    "limits.cpusetMems",
+	"MemoryMB":      "limits.memoryMB",
+	"MemoryHighMB":  "limits.memoryHighMB",
+	"MemoryLowMB":   "limits.memoryLowMB",
+	"MemoryMinMB":   "limits.memoryMinMB",
+	"MemorySwapMB":  "limits.memorySwapMB",
+	"NoSwap":        "limits.noSwap",
+	"IOWeight":      "limits.ioWeight",
+	"ReadBPS":       "limits.readBPS",
+	"WriteBPS":      "limits.writeBPS",
+	"IODevices":     "limits.devices",
+	"PidsMax":       "limits.pidsMax",
+}
+
+// statusFromError converts validation errors to an InvalidArgument status listing
+// the rejected fields, other errors are returned unchanged.
+func statusFromError(err error) error {
+	var invalid *executor.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range invalid.Violations {
+		field, found := limitFields[v.Field]
+		if !found {
+			field = v.Field
+		}
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Description,
+		})
+	}
+	st, detailsErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(badRequest)
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return st.Err()
+}
+
+// limitsFromPB converts GRPC resource limits to executor limits, nil means no limits
+func limitsFromPB(l *pb.ResourceLimits) (executor.Limits, error) {
+	if l == nil {
+		return executor.Limits{}, nil
+	}
+	var cpuMillis uint
+	if l.Cpus != "" {
+		var err error
+		if cpuMillis, err = executor.ParseCPUQuantity(l.Cpus); err != nil {
+			return executor.Limits{}, &executor.ValidationError{
+				Violations: []executor.FieldViolation{{Field: "CPUMillis", Description: err.Error()}},
+			}
+		}
+	}
+	return executor.Limits{
+		CPUPercent:    uint(l.CpuPercentage),
+		CPUMillis:     cpuMillis,
+		CPUPeriodUsec: uint(l.CpuPeriodUsec),
+		CPUBurstUsec:  uint(l.CpuBurstUsec),
+		CPUWeight:     uint(l.CpuWeight),
+		CpusetCpus:    l.CpusetCpus,
+		CpusetMems:    l.CpusetMems,
+		MemoryMB:      uint(l.MemoryMB),
+		MemoryHighMB:  uint(l.MemoryHighMB),
+		MemoryLowMB:   uint(l.MemoryLowMB),
+		MemoryMinMB:   uint(l.MemoryMinMB),
+		MemorySwapMB:  uint(l.MemorySwapMB),
+		NoSwap:        l.NoSwap,
+		IOWeight:      uint(l.IoWeight),
+		ReadBPS:       uint(l.ReadBPS),
+		WriteBPS:      uint(l.WriteBPS),
+		PidsMax:       uint(l.PidsMax),
+		IODevices:     ioDevicesFromPB(l.Devices),
+	}, nil
+}
+
+// limitsToPB converts executor limits to the GRPC representation
+func limitsToPB(l executor.Limits) *pb.ResourceLimits {
+	r := &pb.ResourceLimits{
+		CpuPercentage: uint32(l.CPUPercent),
+		CpuPeriodUsec: uint32(l.CPUPeriodUsec),
+		CpuBurstUsec:  uint32(l.CPUBurstUsec),
+		CpuWeight:     uint32(l.CPUWeight),
+		CpusetCpus:    l.CpusetCpus,
+		CpusetMems:    l.CpusetMems,
+		MemoryMB:      uint64(l.MemoryMB),
+		MemoryHighMB:  uint64(l.MemoryHighMB),
+		MemoryLowMB:   uint64(l.MemoryLowMB),
+		MemoryMinMB:   uint64(l.MemoryMinMB),
+		MemorySwapMB:  uint64(l.MemorySwapMB),
+		NoSwap:        l.NoSwap,
+		IoWeight:      uint32(l.IOWeight),
+		ReadBPS:       uint32(l.ReadBPS),
+		WriteBPS:      uint32(l.WriteBPS),
+		PidsMax:       uint32(l.PidsMax),
+	}
+	if l.CPUMillis > 0 {
+		r.Cpus = fmt.Sprintf("%dm", l.CPUMillis)
+	}
+	for _, d := range l.IODevices {
+		r.Devices = append(r.Devices, &pb.IODeviceLimit{
+			Device:    d.Device,
+			ReadBPS:   uint64(d.ReadBPS),
+			WriteBPS:  uint64(d.WriteBPS),
+			ReadIOPS:  uint64(d.ReadIOPS),
+			WriteIOPS: uint64(d.WriteIOPS),
+		})
+	}
+	return r
+}
+
+// historyToPB converts the job events to the GRPC representation
+func historyToPB(history []executor.Event) []*pb.JobEvent {
+	var events []*pb.JobEvent
+	for _, e := range history {
+		events = append(events, &pb.JobEvent{Time: timestamppb.New(e.Time), Type: e.Type.String(), Message: e.Message})
+	}
+	return events
+}
+
+func ioDevicesFromPB(devices []*pb.IODeviceLimit) []executor.IODeviceLimit {
+	var limits []executor.IODeviceLimit
+	for _, d := range devices {
+		limits = append(limits, executor.IODeviceLimit{
+			Device:    d.Device,
+			ReadBPS:   uint(d.ReadBPS),
+			WriteBPS:  uint(d.WriteBPS),
+			ReadIOPS:  uint(d.ReadIOPS),
+			WriteIOPS: uint(d.WriteIOPS),
+		})
+	}
+	return limits
+}
+
+func tmpfsFromPB(tmpfs []*pb.Tmpfs) []executor.Tmpfs {
+	var converted []executor.Tmpfs
+	for _, t := range tmpfs {
+		converted = append(converted, executor.Tmpfs{
+			Target: t.Target,
+			SizeMB: t.SizeMB,
+			Mode:   t.Mode,
+			NoExec: t.NoExec,
+			NoSuid: t.NoSuid,
+		})
+	}
+	return converted
+}
+
+// statsToPB converts executor statistics to the GRPC representation
+func statsToPB(pid uint64, s *executor.Stats) *pb.StatsResponse {
+	r := &pb.StatsResponse{
+		Pid:           pid,
+		Time:          timestamppb.New(s.Time),
+		CpuUsageUsec:  s.CPUUsageUsec,
+		CpuUserUsec:   s.CPUUserUsec,
+		CpuSystemUsec: s.CPUSystemUsec,
+		NrPeriods:     s.NrPeriods,
+		NrThrottled:   s.NrThrottled,
+		ThrottledUsec: s.ThrottledUsec,
+		MemoryCurrent: s.MemoryCurrent,
+		MemoryPeak:    s.MemoryPeak,
+		MemoryMax:     s.MemoryMax,
+		MemoryEvents: &pb.MemoryEvents{
+			Low:     s.MemoryEvents.Low,
+			High:    s.MemoryEvents.High,
+			Max:     s.MemoryEvents.Max,
+			Oom:     s.MemoryEvents.OOM,
+			OomKill: s.MemoryEvents.OOMKill,
+		},
+		PidsCurrent: s.PidsCurrent,
+		Pressure:    pressureToPB(s.Pressure),
+	}
+	r.Io = ioStatsToPB(s.IO)
+	return r
+}
+
+func ioStatsToPB(stats []executor.IOStat) []*pb.IOStat {
+	var devices []*pb.IOStat
+	for _, io := range stats {
+		devices = append(devices, &pb.IOStat{
+			Major:      uint32(io.Major),
+			Minor:      uint32(io.Minor),
+			ReadBytes:  io.ReadBytes,
+			WriteBytes: io.WriteBytes,
+			ReadOps:    io.ReadOps,
+			WriteOps:   io.WriteOps,
+		})
+	}
+	return devices
+}
+
+// accountingToPB converts the accounting of a terminated job to the GRPC representation, nil stays nil
+func accountingToPB(a *executor.Accounting) *pb.JobAccounting {
+	if a == nil {
+		return nil
+	}
+	return &pb.JobAccounting{
+		CpuUserUsec:   a.CPUUserUsec,
+		CpuSystemUsec: a.CPUSystemUsec,
+		MemoryPeak:    a.MemoryPeak,
+		Io:            ioStatsToPB(a.IO),
+		PidsPeak:      a.PidsPeak,
+	}
+}
+
+// pressureToPB converts the pressure stall information to the GRPC representation
+func pressureToPB(p executor.ResourcePressure) *pb.ResourcePressure {
+	convert := func(p executor.Pressure) *pb.Pressure {
+		values := func(v executor.PressureValues) *pb.PressureValues {
+			return &pb.PressureValues{Avg10: v.Avg10, Avg60: v.Avg60, Avg300: v.Avg300, TotalUsec: v.TotalUsec}
+		}
+		return &pb.Pressure{Some: values(p.Some), Full: values(p.Full)}
+	}
+	return &pb.ResourcePressure{Cpu: convert(p.CPU), Memory: convert(p.Memory), Io: convert(p.IO)}
+}
+
+func imagesToPB(images []image.Image) []*pb.Image {
+	converted := make([]*pb.Image, 0, len(images))
+	for _, img := range images {
+		converted = append(converted, &pb.Image{
+			Name:       img.Name,
+			Id:         img.ID,
+			Imported:   timestamppb.New(img.Imported),
+			Size:       uint64(img.Size),
+			Entrypoint: img.Config.Entrypoint,
+			Cmd:        img.Config.Cmd,
+			Env:        img.Config.Env,
+			WorkingDir: img.Config.WorkingDir,
+		})
+	}
+	return converted
+}
+
+func volumesToPB(volumes []volume.Volume) []*pb.Volume {
+	converted := make([]*pb.Volume, 0, len(volumes))
+	for _, v := range volumes {
+		converted = append(converted, &pb.Volume{
+			Name:    v.Name,
+			Owner:   v.Owner,
+			Created: timestamppb.New(v.Created),
+			SizeMB:  v.SizeMB,
+		})
+	}
+	return converted
+}
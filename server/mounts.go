@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"minidocker/executor"
+	"minidocker/pb"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MountRule allows the users of a role to bind mount a host path in their jobs
+type MountRule struct {
+	// Path is the host file or directory, the paths under a directory may be mounted as well
+	Path string
+	// ReadOnly only allows read only mounts of Path
+	ReadOnly bool
+}
+
+// UnmarshalJSON parses a rule like {"path": "/srv/data", "readOnly": true}, symbolic links in the path
+// are resolved so that the rule matches the resolved sources of the mounts
+func (r *MountRule) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Path     string `json:"path"`
+		ReadOnly bool   `json:"readOnly"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if !filepath.IsAbs(raw.Path) {
+		return fmt.Errorf("mount path %s is not an absolute path", raw.Path)
+	}
+	r.Path = filepath.Clean(raw.Path)
+	if resolved, err := filepath.EvalSymlinks(r.Path); err == nil {
+		r.Path = resolved
+	}
+	r.ReadOnly = raw.ReadOnly
+	return nil
+}
+
+// allows returns true if the rule allows to mount the resolved host path source
+func (r MountRule) allows(source string, readOnly bool) bool {
+	rel, err := filepath.Rel(r.Path, source)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	return readOnly || !r.ReadOnly
+}
+
+// authorizeMounts converts the mounts of a job of role, every mount must be allowed by a rule of the role.
+// The sources are resolved so that a symbolic link can not lead to a path the role may not mount.
+func (c *Config) authorizeMounts(role string, mounts []*pb.Mount) ([]executor.Mount, error) {
+	converted := make([]executor.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		propagation, err := executor.ParsePropagation(m.Propagation)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Target) {
+			return nil, status.Errorf(codes.InvalidArgument, "mount %s:%s must use absolute paths", m.Source, m.Target)
+		}
+		source, err := filepath.EvalSymlinks(m.Source)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid mount source %s: %v", m.Source, err)
+		}
+		allowed := false
+		for _, rule := range c.RoleMounts[role] {
+			allowed = allowed || rule.allows(source, m.ReadOnly)
+		}
+		if !allowed {
+			mode := "read-write"
+			if m.ReadOnly {
+				mode = "read-only"
+			}
+			return nil, status.Errorf(codes.PermissionDenied, "role %s is not allowed to mount %s %s", role, m.Source, mode)
+		}
+		converted = append(converted, executor.Mount{Source: source, Target: m.Target, ReadOnly: m.ReadOnly, Propagation: propagation})
+	}
+	return converted, nil
+}
+
+// authorizeDevices verifies the role may name the devices of the IO limits of a job: admins name any path while
+// the other roles name the devices under /dev and the paths they may mount. The paths the role may not name are
+// all refused with the same error so that it does not tell whether they exist.
+func (c *Config) authorizeDevices(role string, admin bool, devices []executor.IODeviceLimit) error {
+	if admin {
+		return nil
+	}
+	for _, d := range devices {
+		resolved, err := filepath.EvalSymlinks(d.Device)
+		allowed := err == nil && filepath.IsAbs(resolved) && strings.HasPrefix(resolved, "/dev/")
+		for _, rule := range c.RoleMounts[role] {
+			allowed = allowed || (err == nil && filepath.IsAbs(resolved) && rule.allows(resolved, true))
+		}
+		if !allowed {
+			return status.Errorf(codes.PermissionDenied, "role %s is not allowed to limit device %s", role, d.Device)
+		}
+	}
+	return nil
+}
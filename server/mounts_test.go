@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"minidocker/executor"
+	"minidocker/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizeMounts(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"shared", "work/job", "secret"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A link in a writable directory can not lead to another path
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(dir, "work/link")); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{}
+	err := json.Unmarshal([]byte(`{"roleMounts": {"user": [
+		{"path": "`+dir+`/shared", "readOnly": true},
+		{"path": "`+dir+`/work/"}
+	]}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mounts, err := config.authorizeMounts("user", []*pb.Mount{
+		{Source: dir + "/shared", Target: "/data", ReadOnly: true},
+		{Source: dir + "/work/job", Target: "/work", Propagation: "rslave"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mounts) != 2 || mounts[1] != (executor.Mount{Source: dir + "/work/job", Target: "/work", Propagation: executor.PropagationRSlave}) {
+		t.Fatalf("unexpected mounts %+v", mounts)
+	}
+
+	for _, c := range []struct {
+		role     string
+		mount    *pb.Mount
+		expected codes.Code
+	}{
+		{"user", &pb.Mount{Source: dir + "/shared", Target: "/data"}, codes.PermissionDenied},
+		{"user", &pb.Mount{Source: dir + "/secret", Target: "/data", ReadOnly: true}, codes.PermissionDenied},
+		{"user", &pb.Mount{Source: dir + "/work/link", Target: "/data", ReadOnly: true}, codes.PermissionDenied},
+		{"user", &pb.Mount{Source: dir + "/work/../secret", Target: "/data", ReadOnly: true}, codes.PermissionDenied},
+		{"admin", &pb.Mount{Source: dir + "/shared", Target: "/data", ReadOnly: true}, codes.PermissionDenied},
+		{"user", &pb.Mount{Source: "work", Target: "/data"}, codes.InvalidArgument},
+		{"user", &pb.Mount{Source: dir + "/missing", Target: "/data"}, codes.InvalidArgument},
+		{"user", &pb.Mount{Source: dir + "/shared", Target: "/data", ReadOnly: true, Propagation: "both"}, codes.InvalidArgument},
+	} {
+		if _, err := config.authorizeMounts(c.role, []*pb.Mount{c.mount}); status.Code(err) != c.expected {
+			t.Fatalf("expected %s mounting %s as %s but %v was returned", c.expected, c.mount.Source, c.role, err)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"roleMounts": {"user": [{"path": "relative"}]}}`), &Config{}); err == nil {
+		t.Fatal("error was expected with a relative mount path")
+	}
+}
+
+func TestAuthorizeDevices(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(dir, "data", "link")); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{}
+	if err := json.Unmarshal([]byte(`{"roleMounts": {"user": [{"path": "`+dir+`/data", "readOnly": true}]}}`), config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		device string
+		admin  bool
+		err    bool
+	}{
+		{"/dev/null", false, false},
+		{dir + "/data", false, false},
+		{"/etc", true, false},
+		{"/etc", false, true},
+		{"/dev/../etc", false, true},
+		{dir + "/data/link", false, true},
+		// A missing path gets the error of a forbidden one
+		{"/dev/missing", false, true},
+	} {
+		err := config.authorizeDevices("user", c.admin, []executor.IODeviceLimit{{Device: c.device}})
+		if c.err != (err != nil) || (err != nil && status.Code(err) != codes.PermissionDenied) {
+			t.Fatalf("unexpected result naming %s as admin %t: %v", c.device, c.admin, err)
+		}
+	}
+}
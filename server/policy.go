@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"minidocker/executor"
+	"minidocker/pb"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// LimitPolicy constrains the limits of the jobs of a role. Limits are written with the
+// field names of ResourceLimits, like {"cpus": "500m", "memoryMB": 512}.
+type LimitPolicy struct {
+	// Defaults are applied to the limits a job does not set
+	Defaults executor.Limits
+	// Max are the highest limits a job can set, a job must set the limits bounded by Max
+	// that are unlimited when not set, like memoryMB or pidsMax. readBPS and writeBPS also bound the device rules.
+	Max executor.Limits
+	// MaxReadIOPS and MaxWriteIOPS bound the operations per second of the device rules, they are written
+	// readIOPS and writeIOPS in max as the limits of the root device have no operations per second
+	MaxReadIOPS  uint
+	MaxWriteIOPS uint
+	// Required lists the ResourceLimits fields a job must set once the defaults are applied,
+	// "cpus" and "cpuPercentage" are both satisfied by either CPU limit
+	Required []string
+}
+
+// UnmarshalJSON parses a policy like {"defaults": {...}, "max": {...}, "required": ["memoryMB"]}
+func (p *LimitPolicy) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Defaults json.RawMessage `json:"defaults"`
+		Max      json.RawMessage `json:"max"`
+		Required []string        `json:"required"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	var err error
+	if p.Defaults, err = limitsFromJSON(raw.Defaults); err != nil {
+		return fmt.Errorf("invalid defaults: %w", err)
+	}
+	max, err := p.parseMaxIOPS(raw.Max)
+	if err != nil {
+		return fmt.Errorf("invalid max: %w", err)
+	}
+	if p.Max, err = limitsFromJSON(max); err != nil {
+		return fmt.Errorf("invalid max: %w", err)
+	}
+	for _, field := range raw.Required {
+		if _, found := requiredFields[field]; !found {
+			return fmt.Errorf("unknown required limit %s", field)
+		}
+	}
+	p.Required = raw.Required
+	return nil
+}
+
+// parseMaxIOPS reads readIOPS and writeIOPS from the max limits b and returns the other limits
+func (p *LimitPolicy) parseMaxIOPS(b json.RawMessage) (json.RawMessage, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for name, bound := range map[string]*uint{"readIOPS": &p.MaxReadIOPS, "writeIOPS": &p.MaxWriteIOPS} {
+		if v, found := fields[name]; found {
+			if err := json.Unmarshal(v, bound); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			delete(fields, name)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// limitsFromJSON parses limits written as a ResourceLimits JSON object
+func limitsFromJSON(b json.RawMessage) (executor.Limits, error) {
+	if len(b) == 0 {
+		return executor.Limits{}, nil
+	}
+	limits := &pb.ResourceLimits{}
+	if err := protojson.Unmarshal(b, limits); err != nil {
+		return executor.Limits{}, err
+	}
+	return limitsFromPB(limits)
+}
+
+// requiredFields maps the ResourceLimits fields to the executor limits they set
+var requiredFields = map[string]string{}
+
+func init() {
+	for field, path := range limitFields {
+		requiredFields[strings.TrimPrefix(path, "limits.")] = field
+	}
+}
+
+// unlimitedWhenZero lists the limits not bounding the job when they are 0, like memory.max.
+// Other limits like weights and memory protections fall back to a kernel default.
+var unlimitedWhenZero = map[string]bool{
+	"MemoryMB":     true,
+	"MemorySwapMB": true,
+	"ReadBPS":      true,
+	"WriteBPS":     true,
+	"PidsMax":      true,
+}
+
+// applyPolicy applies the limit policy of role to limits, roles without a policy are not constrained
+func (c *Config) applyPolicy(role string, limits executor.Limits) (executor.Limits, error) {
+	policy, found := c.RolePolicies[role]
+	if !found {
+		return limits, nil
+	}
+	return policy.apply(limits)
+}
+
+// apply returns limits with the defaults of the policy applied, an error lists
+// the limits that are missing or above the maximum of the policy.
+func (p LimitPolicy) apply(limits executor.Limits) (executor.Limits, error) {
+	limits = mergeLimits(limits, p.Defaults)
+
+	invalid := &executor.ValidationError{}
+	violation := func(field, format string, args ...any) {
+		invalid.Violations = append(invalid.Violations, executor.FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+	}
+	for _, path := range p.Required {
+		field := requiredFields[path]
+		if field == "CPUPercent" || field == "CPUMillis" {
+			if limits.CPUMillicores() == 0 {
+				violation("CPUMillis", "a CPU limit is required")
+			}
+		} else if reflect.ValueOf(limits).FieldByName(field).IsZero() {
+			violation(field, "the limit is required")
+		}
+	}
+
+	if max := p.Max.CPUMillicores(); max > 0 {
+		if cpu := limits.CPUMillicores(); cpu == 0 || cpu > max {
+			violation("CPUMillis", "%s exceeds the maximum of %dm", formatMillicores(cpu), max)
+		}
+	}
+	requested, bounds := reflect.ValueOf(limits), reflect.ValueOf(p.Max)
+	for i := 0; i < bounds.NumField(); i++ {
+		name := bounds.Type().Field(i).Name
+		if name == "CPUPercent" || name == "CPUMillis" || bounds.Field(i).Kind() != reflect.Uint || bounds.Field(i).Uint() == 0 {
+			continue
+		}
+		v := requested.Field(i).Uint()
+		if v == 0 && (!unlimitedWhenZero[name] || (name == "MemorySwapMB" && limits.NoSwap)) {
+			continue
+		}
+		if v == 0 || v > bounds.Field(i).Uint() {
+			violation(name, "%s exceeds the maximum of %d", formatLimit(v), bounds.Field(i).Uint())
+		}
+	}
+	// A device rule replaces ReadBPS and WriteBPS on its device, which may be the root device:
+	// the rules are bounded and required like ReadBPS and WriteBPS, their operations per second are bounded alike
+	required := map[string]bool{}
+	for _, path := range p.Required {
+		required[requiredFields[path]] = true
+	}
+	for i, d := range limits.IODevices {
+		for _, rule := range []struct {
+			name     string
+			v, bound uint
+		}{
+			{"ReadBPS", d.ReadBPS, p.Max.ReadBPS}, {"WriteBPS", d.WriteBPS, p.Max.WriteBPS},
+			{"ReadIOPS", d.ReadIOPS, p.MaxReadIOPS}, {"WriteIOPS", d.WriteIOPS, p.MaxWriteIOPS},
+		} {
+			field := fmt.Sprintf("IODevices[%d].%s", i, rule.name)
+			if rule.bound > 0 && (rule.v == 0 || rule.v > rule.bound) {
+				violation(field, "%s exceeds the maximum of %d", formatLimit(uint64(rule.v)), rule.bound)
+			} else if required[rule.name] && rule.v == 0 {
+				violation(field, "the limit is required")
+			}
+		}
+	}
+	if len(invalid.Violations) > 0 {
+		return limits, invalid
+	}
+	return limits, nil
+}
+
+// mergeLimits sets the limits that are not set to defaults, the CPU percentage and millicores
+// are a single limit and so are the swap quota and NoSwap.
+func mergeLimits(limits, defaults executor.Limits) executor.Limits {
+	result := reflect.ValueOf(&limits).Elem()
+	values := reflect.ValueOf(defaults)
+	for i := 0; i < values.NumField(); i++ {
+		switch values.Type().Field(i).Name {
+		case "CPUPercent", "CPUMillis", "MemorySwapMB", "NoSwap":
+			continue
+		}
+		if result.Field(i).IsZero() {
+			result.Field(i).Set(values.Field(i))
+		}
+	}
+	if limits.CPUMillicores() == 0 {
+		limits.CPUPercent = defaults.CPUPercent
+		limits.CPUMillis = defaults.CPUMillis
+	}
+	if limits.MemorySwapMB == 0 && !limits.NoSwap {
+		limits.MemorySwapMB = defaults.MemorySwapMB
+		limits.NoSwap = defaults.NoSwap
+	}
+	return limits
+}
+
+func formatMillicores(m uint) string {
+	if m == 0 {
+		return "no limit"
+	}
+	return fmt.Sprintf("%dm", m)
+}
+
+func formatLimit(v uint64) string {
+	if v == 0 {
+		return "no limit"
+	}
+	return fmt.Sprint(v)
+}
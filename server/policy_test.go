@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"minidocker/executor"
+)
+
+func TestLimitPolicy(t *testing.T) {
+	var policy LimitPolicy
+	err := json.Unmarshal([]byte(`{
+		"defaults": {"cpus": "500m", "memoryMB": 256, "cpuWeight": 50},
+		"max": {"cpus": "2", "memoryMB": 1024, "cpuWeight": 200},
+		"required": ["pidsMax"]
+	}`), &policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		limits     executor.Limits
+		expected   executor.Limits
+		violations []string
+	}{
+		{"Defaults", executor.Limits{PidsMax: 10},
+			executor.Limits{CPUMillis: 500, MemoryMB: 256, CPUWeight: 50, PidsMax: 10}, nil},
+		{"PercentKeepsDefaultCPU", executor.Limits{CPUPercent: 20, PidsMax: 10},
+			executor.Limits{CPUPercent: 20, MemoryMB: 256, CPUWeight: 50, PidsMax: 10}, nil},
+		{"Overrides", executor.Limits{CPUMillis: 2000, MemoryMB: 1024, PidsMax: 10},
+			executor.Limits{CPUMillis: 2000, MemoryMB: 1024, CPUWeight: 50, PidsMax: 10}, nil},
+		{"Required", executor.Limits{}, executor.Limits{}, []string{"PidsMax"}},
+		{"AboveMax", executor.Limits{CPUMillis: 2001, MemoryMB: 1025, CPUWeight: 201, PidsMax: 10},
+			executor.Limits{}, []string{"CPUMillis", "CPUWeight", "MemoryMB"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limits, err := policy.apply(test.limits)
+			var invalid *executor.ValidationError
+			if test.violations == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if limits.CPUMillis != test.expected.CPUMillis || limits.CPUPercent != test.expected.CPUPercent ||
+					limits.MemoryMB != test.expected.MemoryMB || limits.CPUWeight != test.expected.CPUWeight {
+					t.Fatalf("expected %+v but %+v was returned", test.expected, limits)
+				}
+				return
+			}
+			if !errors.As(err, &invalid) || len(invalid.Violations) != len(test.violations) {
+				t.Fatalf("expected violations of %v but %v was returned", test.violations, err)
+			}
+			for i, v := range invalid.Violations {
+				if v.Field != test.violations[i] {
+					t.Fatalf("expected a violation of %s but %s was found", test.violations[i], v.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitPolicyUnbounded(t *testing.T) {
+	policy := LimitPolicy{Max: executor.Limits{MemoryMB: 1024, MemorySwapMB: 128, MemoryLowMB: 512}}
+	_, err := policy.apply(executor.Limits{NoSwap: true})
+	var invalid *executor.ValidationError
+	// Only memory.max is unlimited, memory.low has no protection and NoSwap disables swap
+	if !errors.As(err, &invalid) || len(invalid.Violations) != 1 || invalid.Violations[0].Field != "MemoryMB" {
+		t.Fatalf("expected an unlimited MemoryMB violation but %v was returned", err)
+	}
+}
+
+func TestLimitPolicyIODevices(t *testing.T) {
+	policy := LimitPolicy{Max: executor.Limits{ReadBPS: 1000}, MaxReadIOPS: 500, Required: []string{"writeBPS"}}
+	tests := []struct {
+		name       string
+		devices    []executor.IODeviceLimit
+		violations []string
+	}{
+		{"Bounded", []executor.IODeviceLimit{{Device: "/", ReadBPS: 1000, WriteBPS: 1000, ReadIOPS: 500}}, nil},
+		// A rule for the root device would replace ReadBPS and WriteBPS
+		{"AboveMax", []executor.IODeviceLimit{{Device: "/", ReadBPS: 1001, WriteBPS: 1000, ReadIOPS: 500}}, []string{"IODevices[0].ReadBPS"}},
+		{"Unlimited", []executor.IODeviceLimit{{Device: "/", ReadIOPS: 100}},
+			[]string{"IODevices[0].ReadBPS", "IODevices[0].WriteBPS"}},
+		{"IOPSAboveMax", []executor.IODeviceLimit{{Device: "/", ReadBPS: 1000, WriteBPS: 1000, ReadIOPS: 501}}, []string{"IODevices[0].ReadIOPS"}},
+		{"IOPSUnlimited", []executor.IODeviceLimit{{Device: "/", ReadBPS: 1000, WriteBPS: 1000, WriteIOPS: 100}}, []string{"IODevices[0].ReadIOPS"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := policy.apply(executor.Limits{ReadBPS: 1000, WriteBPS: 1000, IODevices: test.devices})
+			var invalid *executor.ValidationError
+			if test.violations == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &invalid) || len(invalid.Violations) != len(test.violations) {
+				t.Fatalf("expected violations of %v but %v was returned", test.violations, err)
+			}
+			for i, v := range invalid.Violations {
+				if v.Field != test.violations[i] {
+					t.Fatalf("expected a violation of %s but %s was found", test.violations[i], v.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitPolicyMaxIOPS(t *testing.T) {
+	var policy LimitPolicy
+	if err := json.Unmarshal([]byte(`{"max": {"memoryMB": 512, "readIOPS": 100, "writeIOPS": 200}}`), &policy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.Max.MemoryMB != 512 || policy.MaxReadIOPS != 100 || policy.MaxWriteIOPS != 200 {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+}
+
+func TestMergeSwapLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   executor.Limits
+		defaults executor.Limits
+		expected executor.Limits
+	}{
+		{"SwapSet", executor.Limits{MemorySwapMB: 128}, executor.Limits{NoSwap: true}, executor.Limits{MemorySwapMB: 128}},
+		{"NoSwapSet", executor.Limits{NoSwap: true}, executor.Limits{MemorySwapMB: 128}, executor.Limits{NoSwap: true}},
+		{"DefaultNoSwap", executor.Limits{}, executor.Limits{NoSwap: true}, executor.Limits{NoSwap: true}},
+		{"DefaultSwap", executor.Limits{}, executor.Limits{MemorySwapMB: 128}, executor.Limits{MemorySwapMB: 128}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := mergeLimits(test.limits, test.defaults)
+			if merged.MemorySwapMB != test.expected.MemorySwapMB || merged.NoSwap != test.expected.NoSwap {
+				t.Fatalf("expected %+v but %+v was found", test.expected, merged)
+			}
+		})
+	}
+}
+
+func TestLimitPolicyUnknownRequired(t *testing.T) {
+	var policy LimitPolicy
+	if err := json.Unmarshal([]byte(`{"required": ["memory"]}`), &policy); err == nil {
+		t.Fatalf("an unknown required limit should be rejected")
+	}
+}
+
+func TestHardenedRoles(t *testing.T) {
+	config := &Config{}
+	if err := json.Unmarshal([]byte(`{"hardenedRoles": {"trusted": false, "admin": true}}`), config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		role      string
+		admin     bool
+		requested bool
+		expected  bool
+	}{
+		// Roles that are not listed are hardened unless they are admin roles
+		{"user", false, false, true},
+		{"operator", true, false, false},
+		{"operator", true, true, true},
+		{"trusted", false, false, false},
+		{"trusted", false, true, true},
+		{"admin", true, false, true},
+	} {
+		if hardened := config.hardened(c.role, c.admin, c.requested); hardened != c.expected {
+			t.Fatalf("expected hardened %t for %+v", c.expected, c)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"minidocker/executor"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Profile is a named limit set defined by the server, like "small" or "io-heavy"
+type Profile struct {
+	Description string
+	// Limits are written with the field names of ResourceLimits
+	Limits executor.Limits
+	// Roles lists the roles allowed to use the profile, every role may use it if empty
+	Roles []string
+}
+
+// UnmarshalJSON parses a profile like {"description": "...", "limits": {...}, "roles": ["user"]}
+func (p *Profile) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Description string          `json:"description"`
+		Limits      json.RawMessage `json:"limits"`
+		Roles       []string        `json:"roles"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	var err error
+	if p.Limits, err = limitsFromJSON(raw.Limits); err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+	p.Description = raw.Description
+	p.Roles = raw.Roles
+	return nil
+}
+
+// allowed returns true if role may use the profile
+func (p Profile) allowed(role string) bool {
+	return len(p.Roles) == 0 || slices.Contains(p.Roles, role)
+}
+
+// applyProfile returns limits set over the limits of profile name, an empty name applies no profile
+func (c *Config) applyProfile(role, name string, limits executor.Limits) (executor.Limits, error) {
+	if name == "" {
+		return limits, nil
+	}
+	profile, found := c.Profiles[name]
+	if !found {
+		return limits, status.Errorf(codes.NotFound, "profile %s does not exist", name)
+	}
+	if !profile.allowed(role) {
+		return limits, status.Errorf(codes.PermissionDenied, "role %s is not allowed to use profile %s", role, name)
+	}
+	return mergeLimits(limits, profile.Limits), nil
+}
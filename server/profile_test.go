@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"minidocker/executor"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestApplyProfile(t *testing.T) {
+	config := &Config{}
+	err := json.Unmarshal([]byte(`{"profiles": {
+		"small": {"description": "half a CPU", "limits": {"cpus": "500m", "memoryMB": 512}},
+		"large": {"limits": {"cpus": "4", "memoryMB": 8192}, "roles": ["admin"]}
+	}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limits, err := config.applyProfile("user", "small", executor.Limits{MemoryMB: 1024, PidsMax: 64})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits.CPUMillis != 500 || limits.MemoryMB != 1024 || limits.PidsMax != 64 {
+		t.Fatalf("the request limits should override the profile: %+v", limits)
+	}
+	if limits, _ := config.applyProfile("user", "small", executor.Limits{CPUPercent: 20}); limits.CPUMillis != 0 || limits.CPUPercent != 20 {
+		t.Fatalf("a CPU percentage should override the CPU of the profile: %+v", limits)
+	}
+	if limits, err := config.applyProfile("user", "", executor.Limits{PidsMax: 64}); err != nil || !reflect.DeepEqual(limits, executor.Limits{PidsMax: 64}) {
+		t.Fatalf("no profile should leave the limits unchanged: %+v %v", limits, err)
+	}
+	if _, err := config.applyProfile("user", "large", executor.Limits{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied but %v was returned", err)
+	}
+	if _, err := config.applyProfile("admin", "large", executor.Limits{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := config.applyProfile("user", "huge", executor.Limits{}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound but %v was returned", err)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"fmt"
+	"minidocker/executor"
+	"minidocker/internal/volume"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quotaWindow is the period MaxJobsPerHour is accounted over
+const quotaWindow = time.Hour
+
+// Quota bounds the jobs of a user, zero values mean no limit
+type Quota struct {
+	// MaxJobs is the maximum number of jobs Queued or Running at once
+	MaxJobs uint `json:"maxJobs"`
+	// MaxCPUs is the CPU reserved by the active jobs as a quantity like "4" or "2500m"
+	MaxCPUs string `json:"maxCpus"`
+	// MaxMemoryMB is the memory reserved by the active jobs in Megabytes
+	MaxMemoryMB uint `json:"maxMemoryMB"`
+	// MaxJobsPerHour is the maximum number of jobs started in the last hour
+	MaxJobsPerHour uint `json:"maxJobsPerHour"`
+	// MaxVolumes is the maximum number of volumes owned at once
+	MaxVolumes uint `json:"maxVolumes"`
+	// MaxVolumeMB is the total size of the volumes owned in Megabytes
+	MaxVolumeMB uint64 `json:"maxVolumeMB"`
+	// maxCPUMillis is MaxCPUs parsed when the configuration is loaded
+	maxCPUMillis uint
+}
+
+// quotaUsage is what a user reserves, jobs are active while Queued or Running
+type quotaUsage struct {
+	jobs         uint
+	cpuMillis    uint
+	memoryMB     uint
+	jobsLastHour uint
+}
+
+// reservation is a job being started, it is accounted to its user until the start completes
+type reservation struct {
+	limits executor.Limits
+}
+
+// quotaTracker accounts the jobs of each user to enforce their quota when jobs are started or updated
+type quotaTracker struct {
+	config   *Config
+	executor *executor.Executor
+	// mu guards the accounting, a job is reserved under it so that concurrent requests can not exceed a quota
+	mu sync.Mutex
+	// jobs are the active jobs of each user
+	jobs map[string][]uint64
+	// pending are the jobs of each user being started
+	pending map[string][]*reservation
+	// volumesMu serializes the check and the creation of a volume so that concurrent requests can not exceed a quota
+	volumesMu sync.Mutex
+	// starts are the start times of the jobs of each user in the last quotaWindow
+	starts map[string][]time.Time
+}
+
+func newQuotaTracker(config *Config, e *executor.Executor) *quotaTracker {
+	return &quotaTracker{
+		config:   config,
+		executor: e,
+		jobs:     map[string][]uint64{},
+		pending:  map[string][]*reservation{},
+		starts:   map[string][]time.Time{},
+	}
+}
+
+// quota returns the quota of user, false means the user has no quota
+func (t *quotaTracker) quota(user, role string) (Quota, bool) {
+	if q, found := t.config.UserQuotas[user]; found {
+		return q, true
+	}
+	q, found := t.config.RoleQuotas[role]
+	return q, found
+}
+
+// start calls start if the job fits in the quota of user and accounts the started job. The job is reserved
+// while start runs without the lock so that the starts of the jobs do not wait for each other.
+func (t *quotaTracker) start(user, role string, limits executor.Limits, start func() (uint64, error)) (uint64, error) {
+	r, err := t.reserve(user, role, limits)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := start()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.release(user, r)
+	if err != nil {
+		return pid, err
+	}
+	t.jobs[user] = append(t.jobs[user], pid)
+	t.starts[user] = append(t.starts[user], time.Now())
+	return pid, nil
+}
+
+// reserve accounts a job of user being started if it fits in the quota
+func (t *quotaTracker) reserve(user, role string, limits executor.Limits) (*reservation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, found := t.quota(user, role); found {
+		u := t.usage(user, noJob)
+		if q.MaxJobs > 0 && u.jobs >= q.MaxJobs {
+			return nil, quotaError(user, "%d of %d concurrent jobs are active", u.jobs, q.MaxJobs)
+		}
+		if q.MaxJobsPerHour > 0 && u.jobsLastHour >= q.MaxJobsPerHour {
+			return nil, quotaError(user, "%d of %d jobs were started in the last hour", u.jobsLastHour, q.MaxJobsPerHour)
+		}
+		if err := checkReservation(user, q, u, limits); err != nil {
+			return nil, err
+		}
+	}
+	r := &reservation{limits: limits}
+	t.pending[user] = append(t.pending[user], r)
+	return r, nil
+}
+
+// release removes the reservation r of user once its job is accounted or failed to start. The caller must hold mu.
+func (t *quotaTracker) release(user string, r *reservation) {
+	pending := t.pending[user]
+	for i, p := range pending {
+		if p == r {
+			t.pending[user] = append(pending[:i], pending[i+1:]...)
+			break
+		}
+	}
+	if len(t.pending[user]) == 0 {
+		delete(t.pending, user)
+	}
+}
+
+// update calls update if the new limits of job pid fit in the quota of user
+func (t *quotaTracker) update(user, role string, pid uint64, limits executor.Limits, update func() error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, found := t.quota(user, role); found {
+		if err := checkReservation(user, q, t.usage(user, pid), limits); err != nil {
+			return err
+		}
+	}
+	return update()
+}
+
+// createVolume calls create if a volume of sizeMB fits in the quota of user
+func (t *quotaTracker) createVolume(user, role string, sizeMB uint64, create func() error) error {
+	t.volumesMu.Lock()
+	defer t.volumesMu.Unlock()
+	if q, found := t.quota(user, role); found && (q.MaxVolumes > 0 || q.MaxVolumeMB > 0) {
+		volumes, err := t.executor.ListVolumes()
+		if err != nil {
+			return err
+		}
+		if err := checkVolumeQuota(user, q, volumes, sizeMB); err != nil {
+			return err
+		}
+	}
+	return create()
+}
+
+// current returns the quota of user and the resources reserved by its jobs
+func (t *quotaTracker) current(user, role string) (Quota, bool, quotaUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	q, found := t.quota(user, role)
+	return q, found, t.usage(user, noJob)
+}
+
+// noJob is passed to usage to account every job
+const noJob = ^uint64(0)
+
+// usage returns the resources reserved by the active and pending jobs of user except job exclude,
+// terminated jobs and starts older than quotaWindow are forgotten. The caller must hold mu.
+func (t *quotaTracker) usage(user string, exclude uint64) quotaUsage {
+	var u quotaUsage
+	for _, r := range t.pending[user] {
+		u.jobs++
+		u.cpuMillis += r.limits.CPUMillicores()
+		u.memoryMB += r.limits.MemoryMB
+	}
+	active := t.jobs[user][:0]
+	for _, pid := range t.jobs[user] {
+		info := t.executor.Get(pid)
+		if info == nil || (info.State != executor.Queued.String() && info.State != executor.Running.String()) {
+			continue
+		}
+		active = append(active, pid)
+		if pid == exclude {
+			continue
+		}
+		u.jobs++
+		u.cpuMillis += info.Limits.CPUMillicores()
+		u.memoryMB += info.Limits.MemoryMB
+	}
+	t.jobs[user] = active
+
+	since := time.Now().Add(-quotaWindow)
+	starts := t.starts[user][:0]
+	for _, s := range t.starts[user] {
+		if s.After(since) {
+			starts = append(starts, s)
+		}
+	}
+	t.starts[user] = starts
+	u.jobsLastHour = uint(len(starts) + len(t.pending[user]))
+	return u
+}
+
+// checkReservation verifies the CPU and memory of a job fit in the quota left by the other jobs,
+// a job must be limited when the quota bounds the resource.
+func checkReservation(user string, q Quota, u quotaUsage, limits executor.Limits) error {
+	if q.maxCPUMillis > 0 {
+		cpu := limits.CPUMillicores()
+		if cpu == 0 {
+			return quotaError(user, "the CPU reserved is bounded to %dm, the job must set a CPU limit", q.maxCPUMillis)
+		}
+		if u.cpuMillis+cpu > q.maxCPUMillis {
+			return quotaError(user, "%dm of %dm CPU are reserved and the job requests %dm", u.cpuMillis, q.maxCPUMillis, cpu)
+		}
+	}
+	if q.MaxMemoryMB > 0 {
+		if limits.MemoryMB == 0 {
+			return quotaError(user, "the memory reserved is bounded to %dMB, the job must set a memory limit", q.MaxMemoryMB)
+		}
+		if u.memoryMB+limits.MemoryMB > q.MaxMemoryMB {
+			return quotaError(user, "%dMB of %dMB memory are reserved and the job requests %dMB", u.memoryMB, q.MaxMemoryMB, limits.MemoryMB)
+		}
+	}
+	return nil
+}
+
+// checkVolumeQuota verifies a volume of sizeMB fits in the quota left by the volumes user owns,
+// a volume must be capped when the quota bounds their size.
+func checkVolumeQuota(user string, q Quota, volumes []volume.Volume, sizeMB uint64) error {
+	var owned uint
+	var usedMB uint64
+	for _, v := range volumes {
+		if v.Owner == user {
+			owned++
+			usedMB += v.SizeMB
+		}
+	}
+	if q.MaxVolumes > 0 && owned >= q.MaxVolumes {
+		return quotaError(user, "%d of %d volumes are owned", owned, q.MaxVolumes)
+	}
+	if q.MaxVolumeMB > 0 {
+		if sizeMB == 0 {
+			return quotaError(user, "the size of the volumes is bounded to %dMB, the volume must set a size", q.MaxVolumeMB)
+		}
+		if usedMB+sizeMB > q.MaxVolumeMB {
+			return quotaError(user, "%dMB of %dMB volume size are owned and the volume requests %dMB", usedMB, q.MaxVolumeMB, sizeMB)
+		}
+	}
+	return nil
+}
+
+func quotaError(user string, format string, args ...any) error {
+	return status.Errorf(codes.ResourceExhausted, "quota of %s exceeded: %s", user, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"minidocker/executor"
+	"minidocker/internal/volume"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	content := `{"roleQuotas": {"user": {"maxJobs": 2, "maxCpus": "1.5"}}, "userQuotas": {"user3": {"maxMemoryMB": 512}}}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q := config.RoleQuotas["user"]; q.MaxJobs != 2 || q.maxCPUMillis != 1500 {
+		t.Fatalf("unexpected role quota %+v", q)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"roleQuotas": {"user": {"maxCpus": "lots"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(file); err == nil {
+		t.Fatalf("an invalid CPU quantity should be rejected")
+	}
+}
+
+func TestQuotaResolution(t *testing.T) {
+	tracker := newQuotaTracker(&Config{
+		RoleQuotas: map[string]Quota{"user": {MaxJobs: 2}},
+		UserQuotas: map[string]Quota{"user3": {MaxJobs: 5}},
+	}, &executor.Executor{})
+	if q, found := tracker.quota("user2", "user"); !found || q.MaxJobs != 2 {
+		t.Fatalf("user2 should have the quota of its role")
+	}
+	if q, found := tracker.quota("user3", "user"); !found || q.MaxJobs != 5 {
+		t.Fatalf("the quota of user3 should replace the quota of its role")
+	}
+	if _, found := tracker.quota("user1", "admin"); found {
+		t.Fatalf("admins should have no quota")
+	}
+}
+
+func TestQuotaJobsPerHour(t *testing.T) {
+	tracker := newQuotaTracker(&Config{RoleQuotas: map[string]Quota{"user": {MaxJobsPerHour: 2}}}, &executor.Executor{})
+	started := 0
+	start := func() (uint64, error) {
+		started++
+		return uint64(started), nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := tracker.start("user2", "user", executor.Limits{}, start); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	_, err := tracker.start("user2", "user", executor.Limits{}, start)
+	if status.Code(err) != codes.ResourceExhausted || started != 2 {
+		t.Fatalf("the third job of the hour should be rejected: %v", err)
+	}
+	// Other users are accounted separately
+	if _, err := tracker.start("user3", "user", executor.Limits{}, start); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestQuotaPendingStart(t *testing.T) {
+	tracker := newQuotaTracker(&Config{RoleQuotas: map[string]Quota{"user": {MaxJobs: 1, MaxMemoryMB: 512}}}, &executor.Executor{})
+	// The quota is neither locked nor exceeded by a job being started
+	_, err := tracker.start("user2", "user", executor.Limits{MemoryMB: 256}, func() (uint64, error) {
+		if _, _, u := tracker.current("user2", "user"); u.jobs != 1 || u.memoryMB != 256 {
+			t.Fatalf("expected the pending job to be accounted but %+v was found", u)
+		}
+		_, err := tracker.start("user2", "user", executor.Limits{MemoryMB: 256}, func() (uint64, error) { return 2, nil })
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("a second concurrent job should be rejected: %v", err)
+		}
+		return 0, fmt.Errorf("start failed")
+	})
+	if err == nil {
+		t.Fatal("the error of start should be returned")
+	}
+	// A failed start gives its reservation back
+	if _, _, u := tracker.current("user2", "user"); u.jobs != 0 || u.jobsLastHour != 0 {
+		t.Fatalf("expected the reservation to be released but %+v was found", u)
+	}
+}
+
+func TestCheckReservation(t *testing.T) {
+	quota := Quota{MaxMemoryMB: 1024, maxCPUMillis: 2000}
+	used := quotaUsage{cpuMillis: 1500, memoryMB: 512}
+	tests := []struct {
+		name   string
+		limits executor.Limits
+		err    bool
+	}{
+		{"Fits", executor.Limits{CPUMillis: 500, MemoryMB: 512}, false},
+		{"PercentFits", executor.Limits{CPUPercent: 50, MemoryMB: 512}, false},
+		{"CPUExceeded", executor.Limits{CPUMillis: 501, MemoryMB: 512}, true},
+		{"MemoryExceeded", executor.Limits{CPUMillis: 500, MemoryMB: 513}, true},
+		{"NoCPULimit", executor.Limits{MemoryMB: 512}, true},
+		{"NoMemoryLimit", executor.Limits{CPUMillis: 500}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkReservation("user2", quota, used, test.limits)
+			if test.err != (err != nil) {
+				t.Fatalf("unexpected result: %v", err)
+			}
+			if err != nil && status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("expected ResourceExhausted but %v was returned", err)
+			}
+		})
+	}
+}
+
+func TestCheckVolumeQuota(t *testing.T) {
+	volumes := []volume.Volume{{Name: "cache", Owner: "user2", SizeMB: 512}, {Name: "data", Owner: "user3", SizeMB: 1024}}
+	tests := []struct {
+		name   string
+		quota  Quota
+		sizeMB uint64
+		err    bool
+	}{
+		{"Fits", Quota{MaxVolumes: 2, MaxVolumeMB: 1024}, 512, false},
+		{"CountExceeded", Quota{MaxVolumes: 1}, 512, true},
+		{"SizeExceeded", Quota{MaxVolumeMB: 1024}, 513, true},
+		{"Uncapped", Quota{MaxVolumeMB: 1024}, 0, true},
+		{"UncappedWithoutSizeQuota", Quota{MaxVolumes: 2}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkVolumeQuota("user2", test.quota, volumes, test.sizeMB)
+			if test.err != (err != nil) {
+				t.Fatalf("unexpected result: %v", err)
+			}
+			if err != nil && status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("expected ResourceExhausted but %v was returned", err)
+			}
+		})
+	}
+}
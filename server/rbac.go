@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"minidocker/pb"
 	"reflect"
+	"strconv"
 	"sync"
 
 	log "log/slog"
@@ -32,19 +33,39 @@ type wrappedStream struct {
 	ctx  context.Context
 	i    *RBACInterceptor
 	user string
+	role string
 }
 
 func (s *wrappedStream) Context() context.Context {
 	return s.ctx
 }
 
+// RecvMsg authorizes every message received, the message must be read first as
+// m is empty until the underlying stream fills it
 func (s *wrappedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
 	switch msg := m.(type) {
-	case *pb.OutputRequest:
-		if s.i.VerifyOwnership(s.user, msg.Pid) {
-			return s.ServerStream.RecvMsg(m)
+	case PIDGetter:
+		if s.i.VerifyOwnership(s.user, msg.GetPid()) {
+			return nil
+		}
+		return fmt.Errorf("user %s not authorized for pid %d", s.user, msg.GetPid())
+	case *pb.StartInputRequest:
+		// Only the first message carries the command, the following ones are data
+		if msg.Request == nil || s.i.AuthorizeCmd(s.role, msg.Request.GetCmd()) {
+			return nil
 		}
-		return fmt.Errorf("user %s not authorized for pid %d", s.user, msg.Pid)
+		log.Warn("user unauthorized", "user", s.user, "role", s.role, "cmd", msg.Request.GetCmd())
+		return fmt.Errorf("user %s/%s not authorized to run %s", s.role, s.user, msg.Request.GetCmd())
+	case *pb.ImportImageRequest:
+		// Images are shared by every user
+		if s.i.roleIsAdmin(s.role) {
+			return nil
+		}
+		log.Warn("user unauthorized", "user", s.user, "role", s.role, "request", "ImportImage")
+		return fmt.Errorf("user %s/%s not authorized to import images", s.role, s.user)
 	default:
 		return fmt.Errorf("user %s not authorized to this operation: %s", s.user, reflect.TypeOf(m))
 	}
@@ -90,6 +111,8 @@ func (i *RBACInterceptor) UnaryInterceptor(ctx context.Context, req any, info *g
 	}
 	user := md["user"][0]
 	role := md["role"][0]
+	// Handlers read the identity of the caller from the metadata, as with streams
+	ctx = metadata.NewIncomingContext(ctx, md)
 	switch r := req.(type) {
 	case CmdGetter:
 		if !i.AuthorizeCmd(role, r.GetCmd()) {
@@ -97,14 +120,23 @@ func (i *RBACInterceptor) UnaryInterceptor(ctx context.Context, req any, info *g
 			return nil, fmt.Errorf("user %s/%s not authorized to run %s", role, user, r.GetCmd())
 		}
 		resp, e := handler(ctx, req)
-		pidResponse := resp.(PIDGetter)
-		i.AttributeOwnership(user, uint64(pidResponse.GetPid()))
+		// Rejected requests have no response and failed executions report the error in the body
+		if created, ok := resp.(*pb.CreateResponse); e == nil && ok && created.Error == nil {
+			i.AttributeOwnership(user, created.GetPid())
+		}
 
 		//if log.Level() == log.LevelDebug {
 		//
 		log.Debug("command execution", "user", user, "role", role, "command", r.GetCmd())
 
 		return resp, e
+	case *pb.CommitRequest:
+		// Committing adds an image to the store like importing does
+		if !i.roleIsAdmin(role) {
+			log.Warn("user unauthorized", "user", user, "role", role, "process", r.GetPid())
+			return nil, fmt.Errorf("user %s/%s not authorized to commit images", role, user)
+		}
+		return handler(ctx, req)
 	case PIDGetter:
 		if !i.VerifyOwnership(user, uint64(r.GetPid())) {
 			log.Warn("user unauthorized", "user", user, "role", role, "process", r.GetPid())
@@ -113,6 +145,33 @@ func (i *RBACInterceptor) UnaryInterceptor(ctx context.Context, req any, info *g
 		//if log.Level() == log.LevelDebug {
 		//
 		log.Debug("reading process", "user", user, "role", role, "PID", r.GetPid())
+		i.attachOwner(md, r.GetPid())
+		return handler(metadata.NewIncomingContext(ctx, md), req)
+	case *pb.ReportRequest:
+		resp, e := handler(ctx, req)
+		if report, ok := resp.(*pb.ReportResponse); e == nil && ok {
+			i.filterReport(user, report)
+		}
+		return resp, e
+	case *pb.QuotaRequest:
+		// The quota of the caller is returned
+		return handler(ctx, req)
+	case *pb.ListProfilesRequest:
+		// The profiles the role of the caller may use are returned
+		return handler(ctx, req)
+	case *pb.ListImagesRequest:
+		return handler(ctx, req)
+	case *pb.RemoveImageRequest:
+		if !i.roleIsAdmin(role) {
+			log.Warn("user unauthorized", "user", user, "role", role, "image", r.GetName())
+			return nil, fmt.Errorf("user %s/%s not authorized to remove images", role, user)
+		}
+		return handler(ctx, req)
+	case *pb.CreateVolumeRequest, *pb.ListVolumesRequest, *pb.RemoveVolumeRequest:
+		// Every user may have volumes, the handlers only give access to the volumes of the caller
+		return handler(ctx, req)
+	case *pb.HostStatsRequest:
+		// Host statistics do not reveal the jobs of other users
 		return handler(ctx, req)
 	default:
 		log.Error("unrecognized request", "user", user, "role", role, "request", reflect.TypeOf(req).String())
@@ -127,7 +186,12 @@ func (i *RBACInterceptor) StreamInterceptor(srv any, ss grpc.ServerStream, info
 		log.Error("error getting user information", "error", err)
 		return fmt.Errorf("error identifying user: %v", err)
 	}
-	return handler(srv, &wrappedStream{ss, metadata.NewIncomingContext(ss.Context(), md), i, md["user"][0]})
+	user := md["user"][0]
+	// Streaming calls respond once the upload completes, the jobs they start are owned as soon as they run
+	ctx := context.WithValue(metadata.NewIncomingContext(ss.Context(), md), ownershipKey{}, func(pid uint64) {
+		i.AttributeOwnership(user, pid)
+	})
+	return handler(srv, &wrappedStream{ss, ctx, i, user, md["role"][0]})
 }
 
 // AuthorizeCmd verifies the role is allowed to execute the command specified
@@ -172,8 +236,8 @@ func (i *RBACInterceptor) userIsAdmin(user string) bool {
 
 // AttributeOwnership updates the userToPID ownership map to determine which users started a process
 func (i *RBACInterceptor) AttributeOwnership(user string, pid uint64) {
-	i.mu.RLock()
-	defer i.mu.RUnlock()
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	if _, ok := i.userToPID[user]; !ok {
 		i.userToPID[user] = map[uint64]struct{}{pid: {}}
 	} else {
@@ -181,6 +245,80 @@ func (i *RBACInterceptor) AttributeOwnership(user string, pid uint64) {
 	}
 }
 
+// filterReport removes the jobs user does not own from report and fills the owner of the others
+func (i *RBACInterceptor) filterReport(user string, report *pb.ReportResponse) {
+	jobs := report.Jobs[:0]
+	for _, job := range report.Jobs {
+		if !i.VerifyOwnership(user, job.Pid) {
+			continue
+		}
+		job.User = i.owner(job.Pid)
+		jobs = append(jobs, job)
+	}
+	report.Jobs = jobs
+}
+
+// owner returns the user that started the process, empty if unknown
+func (i *RBACInterceptor) owner(pid uint64) string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for user, pids := range i.userToPID {
+		if _, found := pids[pid]; found {
+			return user
+		}
+	}
+	return ""
+}
+
+// attachOwner adds the user that started the process pid and its role to md, so that the handlers acting
+// on the process of another user, like Update, apply the policy and the quota of the owner
+func (i *RBACInterceptor) attachOwner(md metadata.MD, pid uint64) {
+	owner := i.owner(pid)
+	md.Set("owner", owner)
+	md.Set("owner-role", i.users[owner])
+}
+
+// jobOwner returns the owner of the job a request acts on and its role as attached by the interceptor,
+// the caller is returned when the owner is unknown
+func jobOwner(ctx context.Context) (user, role string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("owner"); len(values) > 0 && values[0] != "" {
+		return values[0], md.Get("owner-role")[0]
+	}
+	return identity(ctx)
+}
+
+// ownershipKey is the context key of the function attributing the jobs started by a streaming call
+type ownershipKey struct{}
+
+// attributeOwnership gives the job pid to the caller of the streaming call of ctx,
+// nothing happens if the call did not go through the interceptor
+func attributeOwnership(ctx context.Context, pid uint64) {
+	if attribute, ok := ctx.Value(ownershipKey{}).(func(uint64)); ok {
+		attribute(pid)
+	}
+}
+
+// identity returns the user and the role the interceptor attached to the context of a request,
+// both are empty if the request did not go through the interceptor
+func identity(ctx context.Context) (user, role string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user"); len(values) > 0 {
+		user = values[0]
+	}
+	if values := md.Get("role"); len(values) > 0 {
+		role = values[0]
+	}
+	return user, role
+}
+
+// isAdmin returns true if the interceptor found the caller of a request to have an admin role
+func isAdmin(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("admin")
+	return len(values) > 0 && values[0] == "true"
+}
+
 // parseMetadata will extract Metadata from GRPC context to retrieve the user and it's role
 func (i *RBACInterceptor) parseMetadata(ctx context.Context) (metadata.MD, error) {
 	if p, ok := peer.FromContext(ctx); ok {
@@ -193,8 +331,10 @@ func (i *RBACInterceptor) parseMetadata(ctx context.Context) (metadata.MD, error
 		if !found {
 			md = metadata.MD{}
 		}
-		md.Append("user", user)
-		md.Append("role", i.users[user])
+		// Set replaces the values a client could send to impersonate another user
+		md.Set("user", user)
+		md.Set("role", i.users[user])
+		md.Set("admin", strconv.FormatBool(i.roleIsAdmin(i.users[user])))
 		return md, nil
 	}
 	return nil, fmt.Errorf("no peer found from context")
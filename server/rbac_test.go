@@ -1,6 +1,13 @@
 package server
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	"minidocker/pb"
+
+	"google.golang.org/grpc/metadata"
+)
 
 func TestCommandAuthorization(t *testing.T) {
 	i := NewRBACInterceptor()
@@ -16,3 +23,40 @@ func TestCommandAuthorization(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestFilterReport(t *testing.T) {
+	i := NewRBACInterceptor()
+	i.AttributeOwnership("user1", 0)
+	i.AttributeOwnership("user2", 1)
+	i.AttributeOwnership("user3", 2)
+
+	report := &pb.ReportResponse{Jobs: []*pb.JobReport{{Pid: 0}, {Pid: 1}, {Pid: 2}}}
+	i.filterReport("user2", report)
+	if len(report.Jobs) != 1 || report.Jobs[0].Pid != 1 || report.Jobs[0].User != "user2" {
+		t.Fatalf("user2 should only see its job: %v", report.Jobs)
+	}
+
+	report = &pb.ReportResponse{Jobs: []*pb.JobReport{{Pid: 0}, {Pid: 1}, {Pid: 2}}}
+	i.filterReport("user1", report)
+	if len(report.Jobs) != 3 || report.Jobs[2].User != "user3" {
+		t.Fatalf("admin should see all jobs with their owner: %v", report.Jobs)
+	}
+}
+
+func TestJobOwner(t *testing.T) {
+	i := NewRBACInterceptor()
+	i.AttributeOwnership("user2", 1)
+
+	// An admin acting on the job of another user gets the owner
+	md := metadata.Pairs("user", "user1", "role", "admin")
+	i.attachOwner(md, 1)
+	if user, role := jobOwner(metadata.NewIncomingContext(context.Background(), md)); user != "user2" || role != "user" {
+		t.Fatalf("expected user2/user but %s/%s was returned", user, role)
+	}
+
+	md = metadata.Pairs("user", "user1", "role", "admin")
+	i.attachOwner(md, 2)
+	if user, role := jobOwner(metadata.NewIncomingContext(context.Background(), md)); user != "user1" || role != "admin" {
+		t.Fatalf("expected the caller user1/admin for a job without owner but %s/%s was returned", user, role)
+	}
+}
@@ -1,18 +1,41 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	log "log/slog"
 	"minidocker/executor"
+	"minidocker/internal/image"
 	"minidocker/pb"
+	"slices"
 	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// archiveChunkSize is the size of the messages streaming archives
+const archiveChunkSize = 32 * 1024
+
+// minStatsInterval bounds the sampling frequency of WatchStats
+const minStatsInterval = 100 * time.Millisecond
+
 type SchedulerServer struct {
 	pb.UnimplementedSchedulerServer
 	Executor *executor.Executor
+	config   *Config
+	quotas   *quotaTracker
+}
+
+// NewSchedulerServer returns a server running jobs with e and enforcing the policy of config
+func NewSchedulerServer(e *executor.Executor, config *Config) *SchedulerServer {
+	return &SchedulerServer{Executor: e, config: config, quotas: newQuotaTracker(config, e)}
 }
 
 func (s *SchedulerServer) Get(ctx context.Context, r *pb.GetRequest) (*pb.GetResponse, error) {
@@ -20,13 +43,132 @@ func (s *SchedulerServer) Get(ctx context.Context, r *pb.GetRequest) (*pb.GetRes
 	if p == nil {
 		return &pb.GetResponse{Found: false, Pid: 0}, nil
 	}
-	return &pb.GetResponse{Found: true, Pid: p.ID, Status: p.State}, nil
+	return &pb.GetResponse{
+		Found:      true,
+		Pid:        p.ID,
+		Status:     p.State,
+		Cause:      p.Cause,
+		ExitCode:   int32(p.ExitCode),
+		PeakMemory: p.PeakMemory,
+		MemoryMax:  p.MemoryMax,
+		Limits:     limitsToPB(p.Limits),
+		History:    historyToPB(p.History),
+		Accounting: accountingToPB(p.Accounting),
+	}, nil
 }
 
 func (s *SchedulerServer) Start(ctx context.Context, r *pb.CreateRequest) (*pb.CreateResponse, error) {
+	var stdin io.Reader
+	if len(r.Stdin) > 0 {
+		stdin = bytes.NewReader(r.Stdin)
+	}
+	return s.start(ctx, r, stdin)
+}
+
+// StartWithInput starts a job and streams the uploaded data to its standard input, the job is owned by the
+// caller once it runs and the response is sent once the upload completes or the job stops reading.
+func (s *SchedulerServer) StartWithInput(stream pb.Scheduler_StartWithInputServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Request == nil {
+		return fmt.Errorf("the first message must contain the request")
+	}
+	if len(first.Request.Stdin) > 0 {
+		return fmt.Errorf("inline stdin can not be used with StartWithInput")
+	}
+
+	// io.Pipe has no buffer: the stream is read only as fast as the job consumes its input
+	reader, writer := io.Pipe()
+	response, err := s.start(stream.Context(), first.Request, reader)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	if response.Error != nil {
+		writer.Close()
+		return stream.SendAndClose(response)
+	}
+	// The job can be inspected or stopped while its input uploads
+	attributeOwnership(stream.Context(), response.Pid)
+
+	data := first.Data
+	for {
+		if len(data) > 0 {
+			if _, err := writer.Write(data); err != nil {
+				// The executor closed the reader, the job is not reading anymore
+				break
+			}
+		}
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			writer.CloseWithError(err)
+			return err
+		}
+		data = msg.Data
+	}
+	writer.Close()
+	return stream.SendAndClose(response)
+}
+
+// start runs the job requested by r, invalid limits and exceeded quotas are reported as
+// InvalidArgument and ResourceExhausted status while execution failures are reported in the response.
+func (s *SchedulerServer) start(ctx context.Context, r *pb.CreateRequest, stdin io.Reader) (*pb.CreateResponse, error) {
 	var errorStr string
-	pid, err := s.Executor.Start(&executor.ProcessConfig{Cmd: r.Cmd, Args: r.Args})
+	user, role := identity(ctx)
+	limits, err := limitsFromPB(r.Limits)
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	// The devices of the profiles and the policies are named by the configuration
+	if err := s.config.authorizeDevices(role, isAdmin(ctx), limits.IODevices); err != nil {
+		return nil, err
+	}
+	limits, err = s.config.applyProfile(role, r.Profile, limits)
+	if err == nil {
+		limits, err = s.config.applyPolicy(role, limits)
+	}
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	mounts, err := s.config.authorizeMounts(role, r.Mounts)
 	if err != nil {
+		return nil, err
+	}
+	var volumes []executor.VolumeMount
+	if len(r.Volumes) > 0 {
+		existing, err := s.Executor.ListVolumes()
+		if err != nil {
+			return nil, err
+		}
+		if volumes, err = authorizeVolumes(r.Volumes, existing, user, isAdmin(ctx)); err != nil {
+			return nil, err
+		}
+	}
+	pid, err := s.quotas.start(user, role, limits, func() (uint64, error) {
+		return s.Executor.Start(&executor.ProcessConfig{
+			Cmd:       r.Cmd,
+			Args:      r.Args,
+			Limits:    limits,
+			TTY:       r.Tty,
+			Stdin:     stdin,
+			Artifacts: r.Artifacts,
+			Image:     r.Image,
+			Mounts:    mounts,
+			Volumes:   volumes,
+			Tmpfs:     tmpfsFromPB(r.Tmpfs),
+			Hardened:  s.config.hardened(role, isAdmin(ctx), r.Hardened),
+		})
+	})
+	var invalid *executor.ValidationError
+	if errors.As(err, &invalid) {
+		return nil, statusFromError(err)
+	} else if status.Code(err) == codes.ResourceExhausted {
+		return nil, err
+	} else if err != nil {
 		log.Warn("command execution failed", "command", r.Cmd, "args", strings.Join(r.Args, " "))
 		errorStr = err.Error()
 		return &pb.CreateResponse{Pid: pid, Error: &errorStr}, nil
@@ -39,7 +181,11 @@ func (s *SchedulerServer) Stdout(r *pb.OutputRequest, stream pb.Scheduler_Stdout
 	if job == nil {
 		return fmt.Errorf("job does not exists")
 	}
-	reader, _ := s.Executor.Stdout(job.ID)
+	reader, err := s.Executor.Stdout(job.ID)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
 
 	var buffer = make([]byte, 1024)
 	for {
@@ -64,3 +210,305 @@ func (s *SchedulerServer) Stop(ctx context.Context, r *pb.StopRequest) (*pb.Stop
 	s.Executor.StopProcess(r.Pid)
 	return &pb.StopResponse{}, nil
 }
+
+// Attach connects the client to the terminal of a job: the first message selects the job,
+// every message can carry input bytes and window size changes.
+func (s *SchedulerServer) Attach(stream pb.Scheduler_AttachServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	reader, writer, err := s.Executor.Attach(stream.Context(), first.Pid, first.Replay)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	go func() {
+		msg := first
+		for {
+			if msg.Resize != nil {
+				if err := s.Executor.Resize(first.Pid, uint16(msg.Resize.Rows), uint16(msg.Resize.Cols)); err != nil {
+					log.Warn("error resizing terminal", "process", first.Pid, "error", err)
+				}
+			}
+			if len(msg.Input) > 0 {
+				if _, err := writer.Write(msg.Input); err != nil {
+					log.Warn("error writing to terminal", "process", first.Pid, "error", err)
+					return
+				}
+			}
+			var recvErr error
+			if msg, recvErr = stream.Recv(); recvErr != nil {
+				return
+			}
+		}
+	}()
+
+	var buffer = make([]byte, 1024)
+	for stream.Context().Err() == nil {
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			if sendErr := stream.Send(&pb.OutputResponse{Output: buffer[:n]}); sendErr != nil {
+				log.Warn("error writing to stream", "process", first.Pid, "error", sendErr)
+				break
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Warn("error reading from stream", "process", first.Pid, "error", err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// CopyIn extracts the uploaded tar archive into a directory of the job sandbox
+func (s *SchedulerServer) CopyIn(stream pb.Scheduler_CopyInServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	reader := &chunkReader{buf: first.Data, recv: func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Data, nil
+	}}
+	if err := s.Executor.CopyIn(first.Pid, first.Path, reader); err != nil {
+		log.Warn("error copying into job", "process", first.Pid, "path", first.Path, "error", err)
+		return err
+	}
+	return stream.SendAndClose(&pb.CopyInResponse{})
+}
+
+// CopyOut streams a tar archive of a path of the job sandbox
+func (s *SchedulerServer) CopyOut(r *pb.CopyOutRequest, stream pb.Scheduler_CopyOutServer) error {
+	writer := bufio.NewWriterSize(chunkWriter{func(b []byte) error {
+		return stream.Send(&pb.ArchiveChunk{Data: b})
+	}}, archiveChunkSize)
+	if err := s.Executor.CopyOut(r.Pid, r.Path, writer); err != nil {
+		log.Warn("error copying from job", "process", r.Pid, "path", r.Path, "error", err)
+		return err
+	}
+	return writer.Flush()
+}
+
+// Artifacts streams the tar archive of the artifacts saved when the job terminated
+func (s *SchedulerServer) Artifacts(r *pb.ArtifactsRequest, stream pb.Scheduler_ArtifactsServer) error {
+	reader, err := s.Executor.Artifacts(r.Pid)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer := chunkWriter{func(b []byte) error {
+		return stream.Send(&pb.ArchiveChunk{Data: b})
+	}}
+	_, err = io.CopyBuffer(writer, reader, make([]byte, archiveChunkSize))
+	return err
+}
+
+func (s *SchedulerServer) Stats(ctx context.Context, r *pb.StatsRequest) (*pb.StatsResponse, error) {
+	stats, err := s.Executor.Stats(r.Pid)
+	if err != nil {
+		return nil, err
+	}
+	return statsToPB(r.Pid, stats), nil
+}
+
+// WatchStats streams the job statistics at every interval until the job terminates
+func (s *SchedulerServer) WatchStats(r *pb.WatchStatsRequest, stream pb.Scheduler_WatchStatsServer) error {
+	interval := time.Second
+	if r.IntervalMs > 0 {
+		interval = max(minStatsInterval, time.Duration(r.IntervalMs)*time.Millisecond)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		stats, err := s.Executor.Stats(r.Pid)
+		if err != nil {
+			// The stream ends normally when the job terminates
+			if job := s.Executor.Get(r.Pid); job != nil && job.State != executor.Running.String() {
+				return nil
+			}
+			return err
+		}
+		if err := stream.Send(statsToPB(r.Pid, stats)); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// HostStats returns the pressure of the cgroup holding the jobs and the jobs held by the admission control
+func (s *SchedulerServer) HostStats(ctx context.Context, r *pb.HostStatsRequest) (*pb.HostStatsResponse, error) {
+	pressure, err := s.Executor.HostPressure()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.HostStatsResponse{
+		Time:     timestamppb.Now(),
+		Pressure: pressureToPB(pressure),
+		Queued:   uint32(s.Executor.QueuedJobs()),
+	}, nil
+}
+
+// Report returns the accounting of the jobs terminated in the requested time range ordered by PID,
+// the RBAC interceptor fills the owner of each job and removes the jobs of other users.
+func (s *SchedulerServer) Report(ctx context.Context, r *pb.ReportRequest) (*pb.ReportResponse, error) {
+	pids := s.Executor.List()
+	slices.Sort(pids)
+	response := &pb.ReportResponse{}
+	for _, pid := range pids {
+		p := s.Executor.Get(pid)
+		if p == nil || p.Accounting == nil {
+			continue
+		}
+		if r.From != nil && p.TerminatedAt.Before(r.From.AsTime()) {
+			continue
+		}
+		if r.To != nil && !p.TerminatedAt.Before(r.To.AsTime()) {
+			continue
+		}
+		response.Jobs = append(response.Jobs, &pb.JobReport{
+			Pid:          p.ID,
+			Cmd:          p.Cmd,
+			Args:         p.Args,
+			Status:       p.State,
+			Cause:        p.Cause,
+			ExitCode:     int32(p.ExitCode),
+			StartedAt:    timestamppb.New(p.StartedAt),
+			TerminatedAt: timestamppb.New(p.TerminatedAt),
+			Accounting:   accountingToPB(p.Accounting),
+		})
+	}
+	return response, nil
+}
+
+// ListProfiles returns the profiles the role of the caller may use ordered by name
+func (s *SchedulerServer) ListProfiles(ctx context.Context, r *pb.ListProfilesRequest) (*pb.ListProfilesResponse, error) {
+	_, role := identity(ctx)
+	response := &pb.ListProfilesResponse{}
+	for name, p := range s.config.Profiles {
+		if !p.allowed(role) {
+			continue
+		}
+		response.Profiles = append(response.Profiles, &pb.Profile{Name: name, Description: p.Description, Limits: limitsToPB(p.Limits)})
+	}
+	slices.SortFunc(response.Profiles, func(a, b *pb.Profile) int { return strings.Compare(a.Name, b.Name) })
+	return response, nil
+}
+
+// ImportImage imports the images of the uploaded OCI image layout or docker save archive
+func (s *SchedulerServer) ImportImage(stream pb.Scheduler_ImportImageServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	reader := &chunkReader{buf: first.Data, recv: func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Data, nil
+	}}
+	images, err := s.Executor.ImportImage(reader, first.Name)
+	if err != nil {
+		log.Warn("error importing image", "name", first.Name, "error", err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return stream.SendAndClose(&pb.ImportImageResponse{Images: imagesToPB(images)})
+}
+
+// ListImages returns the imported images ordered by name
+func (s *SchedulerServer) ListImages(ctx context.Context, r *pb.ListImagesRequest) (*pb.ListImagesResponse, error) {
+	images, err := s.Executor.ListImages()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListImagesResponse{Images: imagesToPB(images)}, nil
+}
+
+// RemoveImage removes an image that no active job uses
+func (s *SchedulerServer) RemoveImage(ctx context.Context, r *pb.RemoveImageRequest) (*pb.RemoveImageResponse, error) {
+	if err := s.Executor.RemoveImage(r.Name); errors.Is(err, image.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.RemoveImageResponse{}, nil
+}
+
+// Diff streams the layer archive of the changes a terminated job made to the root filesystem of its image
+func (s *SchedulerServer) Diff(r *pb.DiffRequest, stream pb.Scheduler_DiffServer) error {
+	writer := bufio.NewWriterSize(chunkWriter{func(b []byte) error {
+		return stream.Send(&pb.ArchiveChunk{Data: b})
+	}}, archiveChunkSize)
+	if err := s.Executor.Diff(r.Pid, writer); err != nil {
+		log.Warn("error writing job changes", "process", r.Pid, "error", err)
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return writer.Flush()
+}
+
+// Commit imports the image of a terminated job extended by the changes of the job
+func (s *SchedulerServer) Commit(ctx context.Context, r *pb.CommitRequest) (*pb.CommitResponse, error) {
+	img, err := s.Executor.Commit(r.Pid, r.Name)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.CommitResponse{Image: imagesToPB([]image.Image{img})[0]}, nil
+}
+
+// Quota returns the quota of the caller and the resources reserved by its jobs
+func (s *SchedulerServer) Quota(ctx context.Context, r *pb.QuotaRequest) (*pb.QuotaResponse, error) {
+	user, role := identity(ctx)
+	q, found, u := s.quotas.current(user, role)
+	response := &pb.QuotaResponse{
+		User:         user,
+		Role:         role,
+		Jobs:         uint32(u.jobs),
+		Cpus:         fmt.Sprintf("%dm", u.cpuMillis),
+		MemoryMB:     uint64(u.memoryMB),
+		JobsLastHour: uint32(u.jobsLastHour),
+	}
+	if found {
+		response.Limits = &pb.QuotaLimits{
+			MaxJobs:        uint32(q.MaxJobs),
+			MaxCpus:        q.MaxCPUs,
+			MaxMemoryMB:    uint64(q.MaxMemoryMB),
+			MaxJobsPerHour: uint32(q.MaxJobsPerHour),
+		}
+	}
+	return response, nil
+}
+
+// Update replaces the resource limits of a running job, the policy and the quota of the owner of the job apply
+func (s *SchedulerServer) Update(ctx context.Context, r *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	user, role := jobOwner(ctx)
+	limits, err := limitsFromPB(r.Limits)
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	// The caller names the devices, its role decides which ones it may name
+	_, callerRole := identity(ctx)
+	if err := s.config.authorizeDevices(callerRole, isAdmin(ctx), limits.IODevices); err != nil {
+		return nil, err
+	}
+	if limits, err = s.config.applyPolicy(role, limits); err != nil {
+		return nil, statusFromError(err)
+	}
+	err = s.quotas.update(user, role, r.Pid, limits, func() error {
+		return s.Executor.UpdateLimits(r.Pid, limits)
+	})
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	return &pb.UpdateResponse{}, nil
+}
@@ -0,0 +1,32 @@
+package server
+
+// chunkWriter implements io.Writer sending every write as a stream message
+type chunkWriter struct {
+	send func([]byte) error
+}
+
+func (w chunkWriter) Write(b []byte) (int, error) {
+	if err := w.send(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// chunkReader implements io.Reader over the data carried by stream messages
+type chunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"minidocker/executor"
+	"minidocker/internal/volume"
+	"minidocker/pb"
+	"path/filepath"
+
+	log "log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateVolume creates an empty volume owned by the caller, the quota of the caller bounds its volumes
+func (s *SchedulerServer) CreateVolume(ctx context.Context, r *pb.CreateVolumeRequest) (*pb.CreateVolumeResponse, error) {
+	user, role := identity(ctx)
+	var v volume.Volume
+	err := s.quotas.createVolume(user, role, r.SizeMB, func() (err error) {
+		v, err = s.Executor.CreateVolume(r.Name, user, r.SizeMB)
+		return err
+	})
+	if status.Code(err) == codes.ResourceExhausted {
+		return nil, err
+	} else if errors.Is(err, volume.ErrExists) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	} else if err != nil {
+		log.Warn("error creating volume", "name", r.Name, "error", err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &pb.CreateVolumeResponse{Volume: volumesToPB([]volume.Volume{v})[0]}, nil
+}
+
+// ListVolumes returns the volumes of the caller ordered by name, admins see all the volumes
+func (s *SchedulerServer) ListVolumes(ctx context.Context, r *pb.ListVolumesRequest) (*pb.ListVolumesResponse, error) {
+	user, _ := identity(ctx)
+	volumes, err := s.Executor.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListVolumesResponse{Volumes: volumesToPB(accessibleVolumes(volumes, user, isAdmin(ctx)))}, nil
+}
+
+// RemoveVolume removes a volume of the caller that no active job uses, admins may remove any volume
+func (s *SchedulerServer) RemoveVolume(ctx context.Context, r *pb.RemoveVolumeRequest) (*pb.RemoveVolumeResponse, error) {
+	user, _ := identity(ctx)
+	v, err := s.Executor.GetVolume(r.Name)
+	if errors.Is(err, volume.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+	if len(accessibleVolumes([]volume.Volume{v}, user, isAdmin(ctx))) == 0 {
+		return nil, status.Errorf(codes.PermissionDenied, "user %s is not allowed to remove volume %s", user, r.Name)
+	}
+	if err := s.Executor.RemoveVolume(r.Name); errors.Is(err, volume.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.RemoveVolumeResponse{}, nil
+}
+
+// accessibleVolumes returns the volumes user owns, admins may access all the volumes
+func accessibleVolumes(volumes []volume.Volume, user string, admin bool) []volume.Volume {
+	if admin {
+		return volumes
+	}
+	owned := make([]volume.Volume, 0, len(volumes))
+	for _, v := range volumes {
+		if v.Owner == user {
+			owned = append(owned, v)
+		}
+	}
+	return owned
+}
+
+// authorizeVolumes converts the volume mounts of a job of user, every volume must be accessible to user
+func authorizeVolumes(mounts []*pb.VolumeMount, volumes []volume.Volume, user string, admin bool) ([]executor.VolumeMount, error) {
+	converted := make([]executor.VolumeMount, 0, len(mounts))
+	accessible := accessibleVolumes(volumes, user, admin)
+	for _, m := range mounts {
+		if !filepath.IsAbs(m.Target) {
+			return nil, status.Errorf(codes.InvalidArgument, "volume %s must be mounted on an absolute path", m.Name)
+		}
+		found, allowed := false, false
+		for _, v := range volumes {
+			found = found || v.Name == m.Name
+		}
+		for _, v := range accessible {
+			allowed = allowed || v.Name == m.Name
+		}
+		if !found {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found", m.Name)
+		} else if !allowed {
+			return nil, status.Errorf(codes.PermissionDenied, "user %s is not allowed to use volume %s", user, m.Name)
+		}
+		converted = append(converted, executor.VolumeMount{Name: m.Name, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	return converted, nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	"minidocker/executor"
+	"minidocker/internal/volume"
+	"minidocker/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizeVolumes(t *testing.T) {
+	volumes := []volume.Volume{{Name: "cache", Owner: "user2"}, {Name: "data", Owner: "user3"}}
+
+	if owned := accessibleVolumes(volumes, "user2", false); len(owned) != 1 || owned[0].Name != "cache" {
+		t.Fatalf("expected only the volume of the user but found %+v", owned)
+	}
+	if all := accessibleVolumes(volumes, "user1", true); len(all) != 2 {
+		t.Fatalf("expected admins to access all the volumes but found %+v", all)
+	}
+
+	mounts, err := authorizeVolumes([]*pb.VolumeMount{{Name: "cache", Target: "/cache", ReadOnly: true}}, volumes, "user2", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mounts) != 1 || mounts[0] != (executor.VolumeMount{Name: "cache", Target: "/cache", ReadOnly: true}) {
+		t.Fatalf("unexpected mounts %+v", mounts)
+	}
+	if _, err := authorizeVolumes([]*pb.VolumeMount{{Name: "data", Target: "/data"}}, volumes, "user1", true); err != nil {
+		t.Fatalf("expected admins to use any volume: %v", err)
+	}
+
+	for _, c := range []struct {
+		mount    *pb.VolumeMount
+		expected codes.Code
+	}{
+		{&pb.VolumeMount{Name: "data", Target: "/data"}, codes.PermissionDenied},
+		{&pb.VolumeMount{Name: "missing", Target: "/data"}, codes.NotFound},
+		{&pb.VolumeMount{Name: "cache", Target: "cache"}, codes.InvalidArgument},
+	} {
+		_, err := authorizeVolumes([]*pb.VolumeMount{c.mount}, volumes, "user2", false)
+		if status.Code(err) != c.expected {
+			t.Fatalf("expected %s mounting %+v but got %v", c.expected, c.mount, err)
+		}
+	}
+}